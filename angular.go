@@ -0,0 +1,296 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/samber/lo"
+)
+
+// ANGULAR_RESPONSE_PERCENTILES are the percentiles of the backscatter
+// reported for each angular bin of an AngularResponseCurve.
+var ANGULAR_RESPONSE_PERCENTILES = []float64{10, 25, 50, 75, 90}
+
+// resolution (dB) of the histograms used to estimate the percentiles
+const angularHistogramResolution = 0.1
+
+// angularKey identifies an angular bin of a curve.
+type angularKey struct {
+	sector    uint16
+	frequency float64
+	bin       int
+}
+
+// angularBin accumulates the backscatter for a single angular bin, with a
+// histogram of the backscatter for estimating the percentiles.
+type angularBin struct {
+	count uint64
+	mean  float64
+	m2    float64
+	hist  map[int32]uint64
+}
+
+// add accumulates a backscatter value using Welford's algorithm.
+func (ab *angularBin) add(value float64) {
+	ab.count++
+	delta := value - ab.mean
+	ab.mean += delta / float64(ab.count)
+	ab.m2 += delta * (value - ab.mean)
+	ab.hist[int32(math.Round(value/angularHistogramResolution))]++
+}
+
+// percentiles estimates the percentiles (nearest rank) of the accumulated
+// backscatter, to within the histogram resolution.
+func (ab *angularBin) percentiles(pct []float64) []float64 {
+	keys := lo.Keys(ab.hist)
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	result := make([]float64, len(pct))
+	for i, p := range pct {
+		rank := uint64(math.Ceil(p / 100.0 * float64(ab.count)))
+		if rank < 1 {
+			rank = 1
+		}
+
+		cumulative := uint64(0)
+		for _, key := range keys {
+			cumulative += ab.hist[key]
+			if cumulative >= rank {
+				result[i] = float64(key) * angularHistogramResolution
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// AngularResponseCurve is the backscatter (dB) as a function of the beam
+// angle (degrees from vertical) for a single transmit sector and frequency.
+// Only angular bins containing backscatter are included, with Angle being
+// the centre of each bin. Percentiles contains the backscatter for each of
+// ANGULAR_RESPONSE_PERCENTILES, i.e. [bin][percentile].
+// Frequency is as recorded in the sensor metadata, or zero if the sensor
+// metadata doesn't record a frequency.
+type AngularResponseCurve struct {
+	Sector      uint16
+	Frequency   float64
+	Angle       []float64
+	Count       []uint64
+	Mean        []float64
+	Std         []float64
+	Percentiles [][]float64
+}
+
+// AngularResponse contains the angular response curves of a GSF file, for
+// each transmit sector and frequency.
+type AngularResponse struct {
+	Source            BackscatterSource
+	Bin_width         float64
+	Incident_adjusted bool
+	Percentiles       []float64
+	Curves            []AngularResponseCurve
+}
+
+// AngularResponseBuilder aggregates the backscatter against the absolute
+// beam angle into angular bins of Bin_width degrees, streaming over chunks
+// of PingData.
+// If Incident_adjust is true, the beam angle is adjusted by IncidentBeamAdj
+// (if it exists), which accounts for the roll and seafloor slope.
+// Only beams that are not rejected (see BeamFlag.IsRejected, if the beam flags
+// exist) are included. Beams without a SectorNumber are assigned to sector zero.
+type AngularResponseBuilder struct {
+	Source          BackscatterSource
+	Bin_width       float64
+	Incident_adjust bool
+	bins            map[angularKey]*angularBin
+}
+
+// NewAngularResponseBuilder constructs an AngularResponseBuilder for the
+// backscatter source, using angular bins of bin_width degrees.
+func NewAngularResponseBuilder(source BackscatterSource, bin_width float64, incident_adjust bool) (*AngularResponseBuilder, error) {
+	if !(bin_width > 0.0) {
+		return nil, errors.Join(ErrAngularResponse, errors.New("Angular bin width must be positive"))
+	}
+
+	if !lo.Contains(BackscatterSources, source) {
+		return nil, errors.Join(ErrAngularResponse, errors.New("Unsupported backscatter source: "+string(source)))
+	}
+
+	ab := AngularResponseBuilder{
+		Source:          source,
+		Bin_width:       bin_width,
+		Incident_adjust: incident_adjust,
+		bins:            make(map[angularKey]*angularBin),
+	}
+
+	return &ab, nil
+}
+
+// sectorIndex finds the index of the transmit sector within a ping's sector
+// numbers, otherwise the sector number is assumed to be the index.
+func sectorIndex(sectors []uint8, sector uint16) int {
+	idx := lo.IndexOf(sectors, uint8(sector))
+	if idx < 0 {
+		return int(sector)
+	}
+	return idx
+}
+
+// sectorFrequency retrieves the frequency of the transmit sector for the ping
+// (row) of the SensorMetadata. Sensors that record a frequency per sector
+// (EM4, KMALL) use the sector's centre frequency, and sensors that record a
+// single frequency per ping (Reson 7100, Reson TSeries, R2Sonic) use the
+// ping's frequency. Zero is returned if the frequency is unavailable.
+func (sm *SensorMetadata) sectorFrequency(sensor_id SubRecordID, ping int, sector uint16) float64 {
+	per_sector := func(frequency [][]float64, idx int) float64 {
+		if ping >= len(frequency) || idx >= len(frequency[ping]) {
+			return 0.0
+		}
+		return frequency[ping][idx]
+	}
+	per_ping := func(frequency []float64) float64 {
+		if ping >= len(frequency) {
+			return 0.0
+		}
+		return frequency[ping]
+	}
+
+	switch sensor_id {
+	case EM710, EM302, EM122, EM2040, ME70BO:
+		return per_sector(sm.Em4.CenterFrequency, int(sector))
+	case KMALL:
+		idx := int(sector)
+		if ping < len(sm.Kmall.TxSectorNumber) {
+			idx = sectorIndex(sm.Kmall.TxSectorNumber[ping], sector)
+		}
+		return per_sector(sm.Kmall.CentreFrequencyHz, idx)
+	case RESON_7125:
+		return per_ping(sm.Reson7100.Frequency)
+	case RESON_TSERIES:
+		return per_ping(sm.ResonTSeries.Frequency)
+	case R2SONIC_2022, R2SONIC_2024, R2SONIC_2020:
+		return per_ping(sm.R2Sonic.Frequency)
+	}
+
+	return 0.0
+}
+
+// add accumulates a backscatter value into the bin given by key.
+func (ab *AngularResponseBuilder) add(key angularKey, value float64) {
+	bin, ok := ab.bins[key]
+	if !ok {
+		bin = &angularBin{hist: make(map[int32]uint64)}
+		ab.bins[key] = bin
+	}
+	bin.add(value)
+}
+
+// Add aggregates the backscatter of the PingData. The sensor_id determines
+// where the frequency of each transmit sector is retrieved from.
+func (ab *AngularResponseBuilder) Add(pd *PingData, sensor_id SubRecordID) {
+	ba := &pd.Beam_array
+	nbeams := len(pd.Lon_lat.Longitude)
+	if len(ba.BeamAngle) != nbeams {
+		return
+	}
+
+	var (
+		values  []float64
+		offsets []int
+	)
+
+	if ab.Source == BS_TIME_SERIES {
+		offsets = beamSamples(&pd.Brb_intensity, nbeams)
+		if offsets == nil {
+			return
+		}
+	} else {
+		values = beamBackscatter(pd, ab.Source, nbeams)
+		if values == nil {
+			return
+		}
+	}
+
+	has_flags := len(ba.BeamFlags) == nbeams
+	has_sector := len(ba.SectorNumber) == nbeams
+	has_adj := ab.Incident_adjust && len(ba.IncidentBeamAdj) == nbeams
+
+	// only the beams of each ping, excluding any padding
+	for ping, rng := range pd.pingBeamRanges() {
+		for i := rng[0]; i < rng[1]; i++ {
+			if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+				continue
+			}
+
+			angle := float64(ba.BeamAngle[i])
+			if has_adj {
+				angle += float64(ba.IncidentBeamAdj[i])
+			}
+			angle = math.Abs(angle)
+			if math.IsNaN(angle) {
+				continue
+			}
+
+			key := angularKey{bin: int(math.Floor(angle / ab.Bin_width))}
+			if has_sector {
+				key.sector = ba.SectorNumber[i]
+			}
+			key.frequency = pd.Sensor_metadata.sectorFrequency(sensor_id, ping, key.sector)
+
+			if ab.Source == BS_TIME_SERIES {
+				for _, value := range pd.Brb_intensity.TimeSeries[offsets[i]:offsets[i+1]] {
+					if !math.IsNaN(value) {
+						ab.add(key, value)
+					}
+				}
+				continue
+			}
+
+			if !math.IsNaN(values[i]) {
+				ab.add(key, values[i])
+			}
+		}
+	}
+}
+
+// AngularResponse computes the angular response curves for each transmit
+// sector and frequency, ordered by sector, frequency and angle.
+func (ab *AngularResponseBuilder) AngularResponse() AngularResponse {
+	ar := AngularResponse{
+		Source:            ab.Source,
+		Bin_width:         ab.Bin_width,
+		Incident_adjusted: ab.Incident_adjust,
+		Percentiles:       ANGULAR_RESPONSE_PERCENTILES,
+		Curves:            make([]AngularResponseCurve, 0),
+	}
+
+	keys := lo.Keys(ab.bins)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sector != keys[j].sector {
+			return keys[i].sector < keys[j].sector
+		}
+		if keys[i].frequency != keys[j].frequency {
+			return keys[i].frequency < keys[j].frequency
+		}
+		return keys[i].bin < keys[j].bin
+	})
+
+	var curve *AngularResponseCurve
+	for _, key := range keys {
+		if curve == nil || curve.Sector != key.sector || curve.Frequency != key.frequency {
+			ar.Curves = append(ar.Curves, AngularResponseCurve{Sector: key.sector, Frequency: key.frequency})
+			curve = &ar.Curves[len(ar.Curves)-1]
+		}
+
+		bin := ab.bins[key]
+		curve.Angle = append(curve.Angle, (float64(key.bin)+0.5)*ab.Bin_width)
+		curve.Count = append(curve.Count, bin.count)
+		curve.Mean = append(curve.Mean, bin.mean)
+		curve.Std = append(curve.Std, math.Sqrt(bin.m2/float64(bin.count)))
+		curve.Percentiles = append(curve.Percentiles, bin.percentiles(ANGULAR_RESPONSE_PERCENTILES))
+	}
+
+	return ar
+}
@@ -6,19 +6,64 @@ import (
 	"errors"
 	"math"
 	"reflect"
+	"sort"
 	"time"
 
 	tiledb "github.com/TileDB-Inc/TileDB-Go"
 	stgpsr "github.com/yuin/stagparser"
 )
 
-// The start and end datetimes, might not reflect the true start and end datetimes.
-// The records use and offset for each measurement, so the end time will surely
-// occur after the base time for the last attitude record.
+// DEFAULT_ATTITUDE_TOLERANCE is the maximum interval between attitude
+// measurements before reporting a gap in the attitude.
+const DEFAULT_ATTITUDE_TOLERANCE = time.Second
+
+// AttitudeSummary summarises the attitude time series and its quality.
+// The start and end datetimes are of the individual measurements (base time
+// of the record plus the measurement's offset).
+// The sample interval statistics (seconds) exclude the gaps, with the
+// standard deviation of the interval being the jitter, and Sample_rate (Hz)
+// derived from the mean interval. Gaps are the intervals between successive
+// measurements larger than the Gap_tolerance (seconds).
+// Null_counts are the measurements set to the GSF null values, and
+// Out_of_range_counts are the (non-null) measurements outside the valid
+// domain; pitch outside [-90, 90], roll outside [-180, 180], and heading
+// outside [0, 360). Heave has no defined domain and is only checked for nulls.
+// Covers_pings reports whether the attitude time span contains the ping time
+// span, and Pings_not_covered is the number of pings for which the attitude
+// can't be interpolated (outside the time span or within a gap).
 type AttitudeSummary struct {
-	Start_datetime    time.Time
-	End_datetime      time.Time
-	Measurement_count uint64
+	Start_datetime      time.Time
+	End_datetime        time.Time
+	Measurement_count   uint64
+	Sample_rate         float64
+	Interval_mean       float64
+	Interval_std        float64
+	Interval_min        float64
+	Interval_max        float64
+	Gap_tolerance       float64
+	Gaps                []AttitudeGap
+	Null_counts         AttitudeCounts
+	Out_of_range_counts AttitudeCounts
+	Ping_start_datetime time.Time
+	Ping_end_datetime   time.Time
+	Covers_pings        bool
+	Pings_not_covered   uint64
+}
+
+// AttitudeGap is an interval between successive attitude measurements that
+// exceeds the tolerance, with Duration in seconds.
+type AttitudeGap struct {
+	Start_datetime time.Time
+	End_datetime   time.Time
+	Duration       float64
+}
+
+// AttitudeCounts contains a count for each of the attitude measurements.
+type AttitudeCounts struct {
+	Pitch   uint64
+	Roll    uint64
+	Heave   uint64
+	Heading uint64
 }
 
 // Attitude contains the measurements as reported by the vessel attitude sensor.
@@ -392,3 +437,256 @@ func (a *Attitude) ToTileDB(file_uri string, ctx *tiledb.Context) error {
 
 	return nil
 }
+
+// PingAttitude contains the attitude interpolated from the Attitude records
+// at the timestamp of each ping. It is intended as additional PingHeaders
+// columns for checking the consistency of the ping header Pitch, Roll, Heave
+// and Heading against the attitude time series.
+// Attitude_gap is 1 where no attitude measurements exist within the tolerance
+// of the ping's timestamp, in which case the interpolated values are NaN.
+type PingAttitude struct {
+	Attitude_pitch   []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Attitude_roll    []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Attitude_heave   []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Attitude_heading []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Attitude_gap     []uint8   `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// interpolateHeading interpolates between two headings (degrees) taking the
+// shortest path around the circle, such that interpolating between 359 and 1
+// passes through 0, rather than 180. The result is in the range [0, 360).
+func interpolateHeading(h0, h1, frac float64) float64 {
+	delta := math.Mod(h1-h0+540.0, 360.0) - 180.0
+	heading := math.Mod(h0+frac*delta, 360.0)
+	if heading < 0.0 {
+		heading += 360.0
+	}
+
+	return heading
+}
+
+// bracket finds the indices of the attitude measurements either side of t,
+// along with the fractional position of t between them.
+// The returned bool is false if t lies outside the time series, or the
+// bracketing measurements are further apart than the tolerance.
+func (a *Attitude) bracket(t time.Time, tolerance time.Duration) (int, int, float64, bool) {
+	n := len(a.Timestamp)
+	if n == 0 {
+		return 0, 0, 0.0, false
+	}
+
+	// first measurement at or after t
+	i1 := sort.Search(n, func(i int) bool { return !a.Timestamp[i].Before(t) })
+	if i1 == n {
+		return 0, 0, 0.0, false
+	}
+
+	if a.Timestamp[i1].Equal(t) {
+		return i1, i1, 0.0, true
+	}
+
+	if i1 == 0 {
+		return 0, 0, 0.0, false
+	}
+
+	i0 := i1 - 1
+	span := a.Timestamp[i1].Sub(a.Timestamp[i0])
+	if span > tolerance {
+		return 0, 0, 0.0, false
+	}
+
+	frac := float64(t.Sub(a.Timestamp[i0])) / float64(span)
+
+	return i0, i1, frac, true
+}
+
+// Interpolate computes the attitude at each of the requested timestamps.
+// Pitch, roll and heave are linearly interpolated, and heading is interpolated
+// along the shortest arc, accounting for the wrap around at 0/360 degrees.
+// The attitude measurements are assumed to be in ascending time order, as
+// decoded from the ATTITUDE records. A timestamp that lies outside the time
+// series, or between measurements that are further apart than the tolerance,
+// is reported as a gap and given NaN values.
+// A field is given a NaN value if either of the bracketing measurements is
+// null (NULL_PITCH_F32, NULL_ROLL_F32, NULL_HEAVE_F32, NULL_HEADING_F32), and
+// the timestamp is reported as a gap.
+func (a *Attitude) Interpolate(timestamps []time.Time, tolerance time.Duration) PingAttitude {
+	n := len(timestamps)
+	pa := PingAttitude{
+		Attitude_pitch:   make([]float32, n),
+		Attitude_roll:    make([]float32, n),
+		Attitude_heave:   make([]float32, n),
+		Attitude_heading: make([]float32, n),
+		Attitude_gap:     make([]uint8, n),
+	}
+
+	nan := float32(math.NaN())
+
+	// interpolated values are NaN if either measurement is null
+	lerp := func(v []float32, null float32, i0, i1 int, frac float64) (float32, bool) {
+		if v[i0] == null || v[i1] == null {
+			return nan, false
+		}
+		return float32(float64(v[i0]) + frac*(float64(v[i1])-float64(v[i0]))), true
+	}
+
+	for i, t := range timestamps {
+		i0, i1, frac, ok := a.bracket(t, tolerance)
+		if !ok {
+			pa.Attitude_pitch[i] = nan
+			pa.Attitude_roll[i] = nan
+			pa.Attitude_heave[i] = nan
+			pa.Attitude_heading[i] = nan
+			pa.Attitude_gap[i] = uint8(1)
+			continue
+		}
+
+		var pitch_ok, roll_ok, heave_ok bool
+		pa.Attitude_pitch[i], pitch_ok = lerp(a.Pitch, NULL_PITCH_F32, i0, i1, frac)
+		pa.Attitude_roll[i], roll_ok = lerp(a.Roll, NULL_ROLL_F32, i0, i1, frac)
+		pa.Attitude_heave[i], heave_ok = lerp(a.Heave, NULL_HEAVE_F32, i0, i1, frac)
+
+		heading_ok := a.Heading[i0] != NULL_HEADING_F32 && a.Heading[i1] != NULL_HEADING_F32
+		pa.Attitude_heading[i] = nan
+		if heading_ok {
+			pa.Attitude_heading[i] = float32(interpolateHeading(float64(a.Heading[i0]), float64(a.Heading[i1]), frac))
+		}
+
+		if !(pitch_ok && roll_ok && heave_ok && heading_ok) {
+			pa.Attitude_gap[i] = uint8(1)
+		}
+	}
+
+	return pa
+}
+
+// Gaps returns the number of timestamps for which the attitude could not be
+// interpolated.
+func (pa *PingAttitude) Gaps() int {
+	count := 0
+	for _, gap := range pa.Attitude_gap {
+		count += int(gap)
+	}
+
+	return count
+}
+
+// AttitudeQA summarises the attitude time series, reporting the sample rate
+// and its jitter, gaps larger than the tolerance, null and out of range
+// measurements, and whether the attitude covers the pings, recording the
+// result in the Metadata as Attitude_Summary.
+// The attitude measurements are assumed to be in ascending time order, as
+// decoded from the ATTITUDE records.
+func (fi *FileInfo) AttitudeQA(att *Attitude, tolerance time.Duration) {
+	n := len(att.Timestamp)
+	summary := AttitudeSummary{
+		Measurement_count: uint64(n),
+		Gap_tolerance:     tolerance.Seconds(),
+		Gaps:              make([]AttitudeGap, 0),
+	}
+
+	// sample interval statistics using Welford's algorithm
+	var (
+		count uint64
+		mean  float64
+		m2    float64
+	)
+
+	for i := 0; i < n; i++ {
+		if i == 0 || att.Timestamp[i].Before(summary.Start_datetime) {
+			summary.Start_datetime = att.Timestamp[i]
+		}
+		if i == 0 || att.Timestamp[i].After(summary.End_datetime) {
+			summary.End_datetime = att.Timestamp[i]
+		}
+
+		pitch := att.Pitch[i]
+		roll := att.Roll[i]
+		heading := att.Heading[i]
+
+		switch {
+		case pitch == NULL_PITCH_F32:
+			summary.Null_counts.Pitch++
+		case pitch < -90.0 || pitch > 90.0:
+			summary.Out_of_range_counts.Pitch++
+		}
+
+		switch {
+		case roll == NULL_ROLL_F32:
+			summary.Null_counts.Roll++
+		case roll < -180.0 || roll > 180.0:
+			summary.Out_of_range_counts.Roll++
+		}
+
+		if att.Heave[i] == NULL_HEAVE_F32 {
+			summary.Null_counts.Heave++
+		}
+
+		switch {
+		case heading == NULL_HEADING_F32:
+			summary.Null_counts.Heading++
+		case heading < 0.0 || heading >= 360.0:
+			summary.Out_of_range_counts.Heading++
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		interval := att.Timestamp[i].Sub(att.Timestamp[i-1])
+		if interval > tolerance {
+			gap := AttitudeGap{
+				Start_datetime: att.Timestamp[i-1],
+				End_datetime:   att.Timestamp[i],
+				Duration:       interval.Seconds(),
+			}
+			summary.Gaps = append(summary.Gaps, gap)
+			continue
+		}
+
+		// out of order measurements are excluded from the interval statistics
+		if interval < 0 {
+			continue
+		}
+
+		seconds := interval.Seconds()
+		if count == 0 {
+			summary.Interval_min = seconds
+			summary.Interval_max = seconds
+		}
+		count++
+		delta := seconds - mean
+		mean += delta / float64(count)
+		m2 += delta * (seconds - mean)
+		summary.Interval_min = math.Min(summary.Interval_min, seconds)
+		summary.Interval_max = math.Max(summary.Interval_max, seconds)
+	}
+
+	if count > 0 {
+		summary.Interval_mean = mean
+		summary.Interval_std = math.Sqrt(m2 / float64(count))
+		if mean > 0.0 {
+			summary.Sample_rate = 1.0 / mean
+		}
+	}
+
+	// ping time span, and the pings that the attitude doesn't cover
+	for i, ping := range fi.Ping_Info {
+		if i == 0 || ping.Timestamp.Before(summary.Ping_start_datetime) {
+			summary.Ping_start_datetime = ping.Timestamp
+		}
+		if i == 0 || ping.Timestamp.After(summary.Ping_end_datetime) {
+			summary.Ping_end_datetime = ping.Timestamp
+		}
+
+		if _, _, _, ok := att.bracket(ping.Timestamp, tolerance); !ok {
+			summary.Pings_not_covered++
+		}
+	}
+
+	if n > 0 && len(fi.Ping_Info) > 0 {
+		summary.Covers_pings = !summary.Start_datetime.After(summary.Ping_start_datetime) && !summary.End_datetime.Before(summary.Ping_end_datetime)
+	}
+
+	fi.Metadata.Attitude_Summary = summary
+}
@@ -0,0 +1,134 @@
+package gsf
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testAttitude constructs an attitude time series sampled at 1 second
+// intervals, with the given headings and constant pitch, roll and heave.
+func testAttitude(start time.Time, headings []float32) Attitude {
+	n := len(headings)
+	att := Attitude{
+		Timestamp: make([]time.Time, n),
+		Pitch:     make([]float32, n),
+		Roll:      make([]float32, n),
+		Heave:     make([]float32, n),
+		Heading:   headings,
+	}
+
+	for i := range headings {
+		att.Timestamp[i] = start.Add(time.Duration(i) * time.Second)
+		att.Pitch[i] = 1.0 + float32(i)
+		att.Roll[i] = -2.0 - float32(i)
+		att.Heave[i] = 0.5
+	}
+
+	return att
+}
+
+// TestInterpolate checks the linear interpolation of pitch, roll and heave,
+// and that timestamps outside the time series are reported as gaps.
+func TestInterpolate(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	att := testAttitude(start, []float32{10.0, 20.0, 30.0})
+
+	timestamps := []time.Time{
+		start.Add(500 * time.Millisecond),
+		start.Add(2 * time.Second),
+		start.Add(-time.Second),
+		start.Add(3 * time.Second),
+	}
+	pa := att.Interpolate(timestamps, 2*time.Second)
+
+	want := [][4]float32{
+		{1.5, -2.5, 0.5, 15.0},
+		{3.0, -4.0, 0.5, 30.0},
+	}
+	for i, w := range want {
+		got := [4]float32{pa.Attitude_pitch[i], pa.Attitude_roll[i], pa.Attitude_heave[i], pa.Attitude_heading[i]}
+		for j := range w {
+			if math.Abs(float64(got[j]-w[j])) > 1e-5 {
+				t.Errorf("timestamp %d: got %v, want %v", i, got, w)
+				break
+			}
+		}
+		if pa.Attitude_gap[i] != 0 {
+			t.Errorf("timestamp %d: unexpected gap", i)
+		}
+	}
+
+	for i := 2; i < 4; i++ {
+		if pa.Attitude_gap[i] != 1 || !math.IsNaN(float64(pa.Attitude_pitch[i])) {
+			t.Errorf("timestamp %d: expected a gap outside the time series", i)
+		}
+	}
+
+	if pa.Gaps() != 2 {
+		t.Errorf("Gaps() = %d, want 2", pa.Gaps())
+	}
+}
+
+// TestInterpolateHeadingWrap checks that heading is interpolated along the
+// shortest arc across 0/360 degrees, in both directions.
+func TestInterpolateHeadingWrap(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	att := testAttitude(start, []float32{359.0, 1.0, 359.0})
+
+	timestamps := []time.Time{
+		start.Add(250 * time.Millisecond),
+		start.Add(500 * time.Millisecond),
+		start.Add(1750 * time.Millisecond),
+	}
+	pa := att.Interpolate(timestamps, 2*time.Second)
+
+	want := []float32{359.5, 0.0, 359.5}
+	for i, w := range want {
+		if math.Abs(float64(pa.Attitude_heading[i]-w)) > 1e-4 {
+			t.Errorf("timestamp %d: heading = %v, want %v", i, pa.Attitude_heading[i], w)
+		}
+	}
+}
+
+// TestInterpolateNull checks that a null measurement isn't interpolated,
+// giving NaN for the affected field, and reporting a gap.
+func TestInterpolateNull(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	att := testAttitude(start, []float32{10.0, 20.0, NULL_HEADING_F32, 40.0, 50.0, 60.0})
+	att.Pitch[3] = NULL_PITCH_F32
+	att.Roll[4] = NULL_ROLL_F32
+	att.Heave[5] = NULL_HEAVE_F32
+
+	timestamps := []time.Time{
+		start.Add(500 * time.Millisecond),
+		start.Add(1500 * time.Millisecond),
+		start.Add(2500 * time.Millisecond),
+		start.Add(3500 * time.Millisecond),
+		start.Add(4500 * time.Millisecond),
+	}
+	pa := att.Interpolate(timestamps, 2*time.Second)
+
+	if pa.Attitude_gap[0] != 0 {
+		t.Errorf("timestamp 0: unexpected gap")
+	}
+
+	// the field given NaN for each timestamp; heading, heading, pitch, roll, heave
+	fields := [][]float32{pa.Attitude_heading, pa.Attitude_heading, pa.Attitude_pitch, pa.Attitude_roll, pa.Attitude_heave}
+	for i := 1; i < len(timestamps); i++ {
+		if pa.Attitude_gap[i] != 1 {
+			t.Errorf("timestamp %d: expected a gap for a null measurement", i)
+		}
+		if !math.IsNaN(float64(fields[i][i])) {
+			t.Errorf("timestamp %d: expected NaN, got %v", i, fields[i][i])
+		}
+	}
+
+	// the fields without a null measurement are still interpolated
+	if math.Abs(float64(pa.Attitude_heading[3]-45.0)) > 1e-4 {
+		t.Errorf("timestamp 3: heading = %v, want 45", pa.Attitude_heading[3])
+	}
+	if math.Abs(float64(pa.Attitude_pitch[1]-2.5)) > 1e-5 {
+		t.Errorf("timestamp 1: pitch = %v, want 2.5", pa.Attitude_pitch[1])
+	}
+}
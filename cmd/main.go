@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	tiledb "github.com/TileDB-Inc/TileDB-Go"
 	"github.com/alitto/pond"
@@ -16,31 +19,174 @@ import (
 	"github.com/sixy6e/go-gsf"
 )
 
+// convert_options contains the user options that control the conversion of
+// each GSF file.
+type convert_options struct {
+	config_uri           string
+	outdir_uri           string
+	in_memory            bool
+	metadata_only        bool
+	dense                bool
+	no_coverage          bool
+	kml                  bool
+	stac                 bool
+	iso19115             bool
+	simplify_tolerance   float64
+	backend              string
+	geodesic             bool
+	projection           string
+	projected_dims       bool
+	vertical_reference   string
+	interpolate_attitude bool
+	attitude_tolerance   time.Duration
+	svp_selection        string
+	grid_resolution      float64
+	mosaic_resolution    float64
+	mosaic_source        string
+	mosaic_normalise     bool
+	angular_response     bool
+	angular_source       string
+	angular_bin_width    float64
+	incident_beam_adj    bool
+	decode_flags         bool
+	reject_policy        string
+	nav_time_gap         time.Duration
+	nav_speed_limit      float64
+	nav_heading_limit    float64
+	validate_summary     bool
+	split_heads          bool
+	s44_order            string
+	s44_scale            float64
+}
+
 // convert_gsf handles the conversion process for a single GSF file.
-func convert_gsf(gsf_uri, config_uri, outdir_uri string, in_memory, metadata_only, dense bool) error {
+func convert_gsf(gsf_uri string, opts convert_options) error {
 	var (
 		out_uri string
 		err     error
 		dir     string
 		file    string
-		config  *tiledb.Config
 	)
 
+	config_uri := opts.config_uri
+	outdir_uri := opts.outdir_uri
+
 	dir, file = filepath.Split(gsf_uri)
 	if outdir_uri == "" {
 		outdir_uri = dir
 	}
 
 	log.Println("Processing GSF:", gsf_uri)
-	src := gsf.OpenGSF(gsf_uri, config_uri, in_memory)
+	src := gsf.OpenGSF(gsf_uri, config_uri, opts.in_memory)
 	defer src.Close()
 
 	log.Println("Building index; Collating metadata; Computing general QA")
 	file_info := src.Info()
+	file_info.NavigationQA(gsf.NavigationThresholds{
+		Time_Gap:       opts.nav_time_gap.Seconds(),
+		Speed:          opts.nav_speed_limit,
+		Heading_Change: opts.nav_heading_limit,
+	})
+	if events := file_info.Metadata.Quality_Info.Navigation.Events(); events > 0 {
+		log.Println("Navigation QA events found:", events)
+	}
 	proc_info := src.ProcInfo(&file_info)
 
+	// computed prior to any vertical reduction or re-georeferencing, to be
+	// comparable with the stored summary
+	if opts.validate_summary {
+		log.Println("Validating the swath bathymetry summary against the ping data")
+		computed, err := src.ComputeSwathSummary(&file_info)
+		if err != nil {
+			// nothing to compare against, rather than reporting every extent
+			log.Println(err)
+			log.Println("Skipping the swath bathymetry summary validation")
+		} else {
+			file_info.SummaryQA(computed, gsf.DEFAULT_SUMMARY_TOLERANCES)
+			if sv := file_info.Metadata.Quality_Info.Summary_Validation; sv.Summary_Present && !sv.Consistent {
+				log.Println("Swath bathymetry summary discrepancies found:", len(sv.Discrepancies))
+			}
+		}
+	}
+
+	att := src.AttitudeRecords(&file_info)
+	file_info.AttitudeQA(&att, opts.attitude_tolerance)
+	if !file_info.Metadata.Attitude_Summary.Covers_pings {
+		log.Println("Attitude doesn't cover the ping time span")
+	}
+	if gaps := len(file_info.Metadata.Attitude_Summary.Gaps); gaps > 0 {
+		log.Println("Attitude gaps found:", gaps)
+	}
+
+	vertical, err := gsf.NewVerticalReduction(gsf.VerticalReference(opts.vertical_reference), &proc_info)
+	if err != nil {
+		return err
+	}
+	src.Vertical = &vertical
+	if vertical.Reference != gsf.VREF_RECORDED {
+		log.Println("Reducing soundings to vertical reference:", vertical.Reference)
+	}
+
+	if opts.geodesic {
+		ellipsoid, ok := file_info.Metadata.CRS.Ellipsoid()
+		if !ok {
+			log.Println("Unrecognised horizontal datum:", file_info.Metadata.CRS.Horizontal_Datum)
+		}
+		log.Println("Georeferencing beams using geodesics on the ellipsoid:", ellipsoid.Name)
+		src.Georef = gsf.GEOREF_GEODESIC
+	}
+
+	if opts.interpolate_attitude {
+		log.Println("Interpolating attitude at ping timestamps; gap tolerance:", opts.attitude_tolerance)
+		src.Processing.Attitude = &att
+		src.Processing.Attitude_tolerance = opts.attitude_tolerance
+	}
+
+	if opts.svp_selection != "" {
+		resolver, inferred, err := src.SvpResolver(&file_info, gsf.SvpSelection(opts.svp_selection))
+		if err != nil {
+			return err
+		}
+		log.Println("Associating pings with SVPs by:", resolver.Selection)
+		if inferred > 0 {
+			log.Println("SVP positions inferred from the closest ping:", inferred)
+		}
+		src.Processing.Svp = &resolver
+	}
+
+	if opts.angular_response && !opts.metadata_only {
+		builder, err := gsf.NewAngularResponseBuilder(gsf.BackscatterSource(opts.angular_source), opts.angular_bin_width, opts.incident_beam_adj)
+		if err != nil {
+			return err
+		}
+		log.Println("Computing angular response curves from:", builder.Source)
+		src.Processing.Angular_response = builder
+	}
+
+	if opts.decode_flags {
+		log.Println("Decoding beam flags")
+		src.Processing.Decode_flags = true
+	}
+
+	src.Processing.Reject_policy = gsf.RejectPolicy(opts.reject_policy)
+
+	if opts.s44_order != "" && !opts.metadata_only {
+		assessor, err := gsf.NewS44Assessor(gsf.S44Order(opts.s44_order), opts.s44_scale)
+		if err != nil {
+			return err
+		}
+		log.Println("Assessing S-44 compliance for order:", assessor.Order)
+		src.Processing.S44 = assessor
+	}
+
+	// assets to be referenced by the STAC Item
+	assets := map[string]gsf.StacAsset{
+		"gsf": {Href: gsf_uri, Title: file, Roles: []string{"data", "source"}},
+	}
+
 	log.Println("Writing metadata")
 	out_uri = filepath.Join(outdir_uri, file+"-metadata.json")
+	assets["metadata"] = gsf.StacAsset{Href: out_uri, Type: "application/json", Roles: []string{"metadata"}}
 	_, err = gsf.WriteJson(out_uri, config_uri, file_info.Metadata)
 	if err != nil {
 		return err
@@ -48,94 +194,263 @@ func convert_gsf(gsf_uri, config_uri, outdir_uri string, in_memory, metadata_onl
 
 	log.Println("Writing index")
 	out_uri = filepath.Join(outdir_uri, file+"-index.json")
+	assets["index"] = gsf.StacAsset{Href: out_uri, Type: "application/json", Roles: []string{"metadata"}}
 	_, err = gsf.WriteJson(out_uri, config_uri, file_info.Index)
 	if err != nil {
 		return err
 	}
 
-	if !metadata_only {
-		// get a generic config if no path provided
-		if config_uri == "" {
-			config, err = tiledb.NewConfig()
-			if err != nil {
-				return err
-			}
-		} else {
-			config, err = tiledb.LoadConfig(config_uri)
-			if err != nil {
-				return err
-			}
-		}
-
-		defer config.Free()
+	// the coverage requires a full pass over the ping data, so is only
+	// computed when exported, or when the survey extent can't be sourced
+	// from the swath bathymetry summary for the UTM zone selection or the
+	// ISO 19115-3 extent
+	var coverage gsf.SwathCoverage
+	has_summary := file_info.Metadata.Record_Counts[gsf.RecordNames[gsf.SWATH_BATHY_SUMMARY]] > 0
+	utm_zone := opts.projection == "utm" && !opts.metadata_only && !has_summary
+	iso_extent := opts.iso19115 && !has_summary
+	if !opts.no_coverage || opts.kml || opts.stac || utm_zone || iso_extent {
+		log.Println("Computing trackline and swath coverage")
+		coverage = src.SwathCoverage(&file_info, opts.simplify_tolerance)
+	}
 
-		ctx, err := tiledb.NewContext(config)
+	if !opts.no_coverage {
+		out_uri = filepath.Join(outdir_uri, file+"-coverage.geojson")
+		assets["coverage"] = gsf.StacAsset{Href: out_uri, Type: "application/geo+json", Roles: []string{"metadata"}}
+		_, err = gsf.WriteJson(out_uri, config_uri, coverage.GeoJson())
 		if err != nil {
 			return err
 		}
-		defer ctx.Free()
+	}
 
-		grp_uri := filepath.Join(outdir_uri, file+".tiledb")
-		grp, err := tiledb.NewGroup(ctx, grp_uri)
+	if opts.projection != "" && !opts.metadata_only {
+		proj, err := projection(&file_info, &coverage, opts.projection)
 		if err != nil {
 			return err
 		}
-		defer grp.Free()
+		log.Println("Projecting beams using:", proj.Definition)
+		src.Projection = &proj
+	}
 
-		err = grp.Create()
+	if opts.kml {
+		kml, err := coverage.Kml()
 		if err != nil {
-			return errors.Join(err, errors.New("Error creating tiledb group"))
+			return err
 		}
-
-		err = grp.Open(tiledb.TILEDB_WRITE)
+		out_uri = filepath.Join(outdir_uri, file+"-coverage.kml")
+		assets["coverage-kml"] = gsf.StacAsset{Href: out_uri, Type: "application/vnd.google-earth.kml+xml", Roles: []string{"metadata"}}
+		_, err = gsf.WriteBytes(out_uri, config_uri, kml)
 		if err != nil {
-			return errors.Join(err, errors.New("Error opening tiledb group in write mode"))
+			return err
 		}
+	}
 
-		log.Println("Writing GSF data processing information to group metadata")
-		jsn, err := gsf.JsonIndentDumps(proc_info)
+	if opts.iso19115 {
+		log.Println("Writing ISO 19115-3 metadata")
+		iso, err := gsf.IsoMetadata(&file_info.Metadata, &proc_info, &coverage)
 		if err != nil {
 			return err
 		}
-		err = grp.PutMetadata("Data-Processing-Information", jsn)
+		out_uri = filepath.Join(outdir_uri, file+"-iso19115.xml")
+		assets["iso19115"] = gsf.StacAsset{Href: out_uri, Type: "application/xml", Roles: []string{"metadata"}}
+		_, err = gsf.WriteBytes(out_uri, config_uri, iso)
 		if err != nil {
 			return err
 		}
+	}
 
-		log.Println("Processing Attitude")
-		att_name := "Attitude.tiledb"
-		out_uri = filepath.Join(grp_uri, att_name)
-		att := src.AttitudeRecords(&file_info)
-		err = att.ToTileDB(out_uri, ctx)
+	if !opts.metadata_only {
+		switch opts.backend {
+		case "tiledb":
+			grp_uri := filepath.Join(outdir_uri, file+".tiledb")
+			err = write_tiledb(&src, &file_info, &proc_info, grp_uri, opts, assets)
+		case "zarr":
+			grp_path := filepath.Join(outdir_uri, file+".zarr")
+			err = write_zarr(&src, &file_info, &proc_info, grp_path, opts, assets)
+		default:
+			err = errors.New("Unknown backend: " + opts.backend)
+		}
 		if err != nil {
 			return err
 		}
-		err = grp.AddMember(att_name, "Attitude", true)
+
+		if src.Processing.Angular_response != nil {
+			log.Println("Writing angular response curves")
+			out_uri = filepath.Join(outdir_uri, file+"-angular-response.json")
+			assets["angular-response"] = gsf.StacAsset{Href: out_uri, Type: "application/json", Roles: []string{"metadata"}}
+			_, err = gsf.WriteJson(out_uri, config_uri, src.Processing.Angular_response.AngularResponse())
+			if err != nil {
+				return err
+			}
+		}
+
+		if src.Processing.S44 != nil {
+			compliance := src.Processing.S44.S44Compliance()
+			log.Println("S-44 compliance:", compliance)
+			out_uri = filepath.Join(outdir_uri, file+"-s44.json")
+			assets["s44"] = gsf.StacAsset{Href: out_uri, Type: "application/json", Roles: []string{"metadata"}}
+			_, err = gsf.WriteJson(out_uri, config_uri, compliance)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.stac {
+		log.Println("Writing STAC Item")
+		item := gsf.NewStacItem(&file_info, &coverage, assets)
+		out_uri = filepath.Join(outdir_uri, file+"-stac-item.json")
+		_, err = gsf.WriteJson(out_uri, config_uri, item)
 		if err != nil {
-			return errors.Join(err, errors.New("Error adding attitude to group"))
+			return err
 		}
+	}
+
+	log.Println("Finished GSF:", gsf_uri)
+
+	return nil
+}
+
+// projection constructs the map projection for the beam coordinates.
+// A definition of "utm" selects the UTM zone containing the survey centroid,
+// otherwise the definition is parsed as a PROJ style string.
+func projection(file_info *gsf.FileInfo, coverage *gsf.SwathCoverage, definition string) (gsf.Projection, error) {
+	crs := &file_info.Metadata.CRS
+
+	if definition != "utm" {
+		return gsf.ParseProjection(definition, crs)
+	}
+
+	lon, lat, ok := gsf.SurveyCentroid(file_info, coverage)
+	if !ok {
+		return gsf.Projection{}, errors.New("Unable to determine the survey centroid for UTM zone selection")
+	}
 
-		log.Println("Processing SVP")
-		svp_name := "SVP.tiledb"
-		out_uri = filepath.Join(grp_uri, svp_name)
-		svp := src.SoundVelocityProfileRecords(&file_info)
-		err = svp.ToTileDB(out_uri, ctx)
+	zone, south := gsf.UtmZone(lon, lat)
+
+	return gsf.NewUtmProjection(zone, south, crs), nil
+}
+
+// write_tiledb writes the GSF data processing information, attitude, SVP and
+// swath bathymetry ping data to a TileDB group.
+func write_tiledb(src *gsf.GsfFile, file_info *gsf.FileInfo, proc_info *gsf.ProcessingInfo, grp_uri string, opts convert_options, assets map[string]gsf.StacAsset) error {
+	var (
+		config *tiledb.Config
+		err    error
+	)
+
+	config_uri := opts.config_uri
+
+	// get a generic config if no path provided
+	if config_uri == "" {
+		config, err = tiledb.NewConfig()
 		if err != nil {
 			return err
 		}
-		err = grp.AddMember(svp_name, "SVP", true)
+	} else {
+		config, err = tiledb.LoadConfig(config_uri)
 		if err != nil {
-			return errors.Join(err, errors.New("Error adding svp to group"))
+			return err
 		}
+	}
 
-		log.Println("Reading and writing swath bathymetry ping data")
-		err = src.SbpToTileDB(&file_info, ctx, grp, grp_uri, dense)
+	defer config.Free()
+
+	ctx, err := tiledb.NewContext(config)
+	if err != nil {
+		return err
+	}
+	defer ctx.Free()
+
+	sink, err := gsf.NewTileDBSink(ctx, grp_uri, opts.dense, opts.projected_dims)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	if opts.grid_resolution > 0.0 {
+		log.Println("Gridding beam data at resolution:", opts.grid_resolution)
+		sink.Grid_resolution = opts.grid_resolution
+	}
+
+	if opts.mosaic_resolution > 0.0 {
+		log.Println("Mosaicking backscatter at resolution:", opts.mosaic_resolution)
+		sink.Mosaic_resolution = opts.mosaic_resolution
+		sink.Mosaic_source = gsf.BackscatterSource(opts.mosaic_source)
+		sink.Mosaic_normalise = opts.mosaic_normalise
+	}
+
+	if opts.split_heads {
+		log.Println("Writing the beam data of each sonar head to separate arrays")
+		sink.Split_heads = true
+	}
+
+	log.Println("Writing processing information, attitude, SVP and swath bathymetry ping data")
+	err = src.ToSink(file_info, proc_info, sink)
+	if err != nil {
+		return err
+	}
+
+	// close to flush the group members prior to reading them back
+	err = sink.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.stac {
+		grp_assets, err := gsf.TileDBGroupAssets(ctx, grp_uri)
 		if err != nil {
 			return err
 		}
+		for name, asset := range grp_assets {
+			assets[name] = asset
+		}
 	}
 
-	log.Println("Finished GSF:", gsf_uri)
+	return nil
+}
+
+// write_zarr writes the GSF data processing information, attitude, SVP and
+// swath bathymetry ping data to a Zarr v3 group on the local filesystem.
+// Splitting the heads, gridding and mosaicking are only supported by the
+// TileDB backend, and are reported as an error rather than being ignored.
+func write_zarr(src *gsf.GsfFile, file_info *gsf.FileInfo, proc_info *gsf.ProcessingInfo, grp_path string, opts convert_options, assets map[string]gsf.StacAsset) error {
+	if opts.split_heads {
+		return errors.New("--split-heads is not supported by the zarr backend")
+	}
+
+	if opts.grid_resolution > 0.0 {
+		return errors.New("--grid-resolution is not supported by the zarr backend")
+	}
+
+	if opts.mosaic_resolution > 0.0 {
+		return errors.New("--mosaic-resolution is not supported by the zarr backend")
+	}
+
+	sink, err := gsf.NewZarrSink(grp_path)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	log.Println("Writing processing information, attitude, SVP and swath bathymetry ping data")
+	err = src.ToSink(file_info, proc_info, sink)
+	if err != nil {
+		return err
+	}
+
+	err = sink.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.stac {
+		assets["zarr"] = gsf.StacAsset{
+			Href:  grp_path,
+			Title: filepath.Base(grp_path),
+			Type:  "application/vnd+zarr",
+			Roles: []string{"data"},
+		}
+	}
 
 	return nil
 }
@@ -143,9 +458,9 @@ func convert_gsf(gsf_uri, config_uri, outdir_uri string, in_memory, metadata_onl
 // convert_gsf_list is responsible for submitting a list of GSF files to a processing pool
 // that converts each GSF file. The processing pool uses 2 * n_CPUs workers to spread the
 // work across.
-func convert_gsf_list(uri, config_uri, outdir_uri string, in_memory, metadata_only, dense bool) error {
+func convert_gsf_list(uri string, opts convert_options) error {
 	log.Println("Searching uri:", uri)
-	items := gsf.FindGsf(uri, config_uri)
+	items := gsf.FindGsf(uri, opts.config_uri)
 	log.Println("Number of GSFs to process:", len(items))
 
 	// Create a context that will be cancelled when the user presses Ctrl+C (process receives termination signal).
@@ -160,7 +475,7 @@ func convert_gsf_list(uri, config_uri, outdir_uri string, in_memory, metadata_on
 	for _, name := range items {
 		item_uri := name
 		pool.Submit(func() {
-			_ = convert_gsf(item_uri, config_uri, outdir_uri, in_memory, metadata_only, dense)
+			_ = convert_gsf(item_uri, opts)
 			// if err != nil {
 			//     return err
 			// }
@@ -170,16 +485,665 @@ func convert_gsf_list(uri, config_uri, outdir_uri string, in_memory, metadata_on
 	return nil // TODO; fix this design
 }
 
+// options collects the conversion options that are common to each command.
+func options(cCtx *cli.Context) convert_options {
+	return convert_options{
+		config_uri:           cCtx.String("config-uri"),
+		outdir_uri:           cCtx.String("outdir-uri"),
+		in_memory:            cCtx.Bool("in-memory"),
+		metadata_only:        cCtx.Bool("metadata-only"),
+		dense:                cCtx.Bool("dense"),
+		no_coverage:          cCtx.Bool("no-coverage"),
+		kml:                  cCtx.Bool("kml"),
+		stac:                 cCtx.Bool("stac"),
+		iso19115:             cCtx.Bool("iso19115"),
+		simplify_tolerance:   cCtx.Float64("simplify-tolerance"),
+		backend:              cCtx.String("backend"),
+		geodesic:             cCtx.Bool("geodesic"),
+		projection:           cCtx.String("projection"),
+		projected_dims:       cCtx.Bool("projected-dims"),
+		vertical_reference:   cCtx.String("vertical-reference"),
+		interpolate_attitude: cCtx.Bool("interpolate-attitude"),
+		attitude_tolerance:   cCtx.Duration("attitude-tolerance"),
+		svp_selection:        cCtx.String("svp-selection"),
+		grid_resolution:      cCtx.Float64("grid-resolution"),
+		mosaic_resolution:    cCtx.Float64("mosaic-resolution"),
+		mosaic_source:        cCtx.String("mosaic-source"),
+		mosaic_normalise:     cCtx.Bool("mosaic-normalise"),
+		angular_response:     cCtx.Bool("angular-response"),
+		angular_source:       cCtx.String("angular-source"),
+		angular_bin_width:    cCtx.Float64("angular-bin-width"),
+		incident_beam_adj:    cCtx.Bool("incident-beam-adj"),
+		decode_flags:         cCtx.Bool("decode-flags"),
+		reject_policy:        cCtx.String("reject-policy"),
+		nav_time_gap:         cCtx.Duration("nav-time-gap"),
+		nav_speed_limit:      cCtx.Float64("nav-speed-limit"),
+		nav_heading_limit:    cCtx.Float64("nav-heading-limit"),
+		validate_summary:     cCtx.Bool("validate-summary"),
+		split_heads:          cCtx.Bool("split-heads"),
+		s44_order:            cCtx.String("s44-order"),
+		s44_scale:            cCtx.Float64("s44-scale"),
+	}
+}
+
+// export_tiledb exports the gridded surfaces and backscatter mosaics contained
+// within a TileDB group (as created by convert) to the requested format.
+// Currently only GeoTIFF is supported.
+func export_tiledb(grp_uri string, format string, outdir_uri string, compression string, config_uri string) error {
+	var (
+		config *tiledb.Config
+		err    error
+	)
+
+	if format != "geotiff" {
+		return errors.New("Unsupported export format: " + format)
+	}
+
+	tiff_compression, ok := gsf.TiffCompressions[compression]
+	if !ok {
+		return errors.New("Unsupported GeoTIFF compression: " + compression)
+	}
+
+	grp_uri = strings.TrimSuffix(grp_uri, "/")
+	dir, file := filepath.Split(grp_uri)
+	if outdir_uri == "" {
+		outdir_uri = dir
+	}
+	file = strings.TrimSuffix(file, ".tiledb")
+
+	// get a generic config if no path provided
+	if config_uri == "" {
+		config, err = tiledb.NewConfig()
+		if err != nil {
+			return err
+		}
+	} else {
+		config, err = tiledb.LoadConfig(config_uri)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer config.Free()
+
+	ctx, err := tiledb.NewContext(config)
+	if err != nil {
+		return err
+	}
+	defer ctx.Free()
+
+	members, err := gsf.TileDBGroupAssets(ctx, grp_uri)
+	if err != nil {
+		return err
+	}
+
+	_, has_grid := members["Grid"]
+	_, has_mosaic := members["Mosaic"]
+	if !has_grid && !has_mosaic {
+		return errors.New("No gridded surface or mosaic found within: " + grp_uri)
+	}
+
+	rasters := make(map[string]gsf.GeoTiff)
+
+	if has_grid {
+		log.Println("Reading grid:", members["Grid"].Href)
+		grid, err := gsf.ReadGridTileDB(ctx, members["Grid"].Href)
+		if err != nil {
+			return err
+		}
+		rasters["grid"] = grid.GeoTiff(tiff_compression)
+	}
+
+	if has_mosaic {
+		log.Println("Reading mosaic:", members["Mosaic"].Href)
+		mosaic, err := gsf.ReadMosaicTileDB(ctx, members["Mosaic"].Href)
+		if err != nil {
+			return err
+		}
+		rasters["mosaic"] = mosaic.GeoTiff(tiff_compression)
+	}
+
+	for name, gt := range rasters {
+		data, err := gt.Encode()
+		if err != nil {
+			return err
+		}
+
+		out_uri := filepath.Join(outdir_uri, file+"-"+name+".tif")
+		log.Println("Writing GeoTIFF:", out_uri)
+		_, err = gsf.WriteBytes(out_uri, config_uri, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// crossline_options contains the user options that control the comparison
+// of crosslines against the mainscheme (reference) lines.
+type crossline_options struct {
+	config_uri         string
+	outdir_uri         string
+	name               string
+	reference_uris     []string
+	crossline_uris     []string
+	in_memory          bool
+	geodesic           bool
+	projection         string
+	vertical_reference string
+	grid_resolution    float64
+	simplify_tolerance float64
+	angle_bin_width    float64
+	min_count          uint
+}
+
+// open_gsf opens a GSF file and collates its metadata, setting up the
+// georeferencing, projection and vertical reduction of the soundings.
+func open_gsf(gsf_uri string, config_uri string, in_memory bool, geodesic bool, proj *gsf.Projection, reference gsf.VerticalReference) (gsf.GsfFile, gsf.FileInfo, error) {
+	log.Println("Processing GSF:", gsf_uri)
+	src := gsf.OpenGSF(gsf_uri, config_uri, in_memory)
+	file_info := src.Info()
+	proc_info := src.ProcInfo(&file_info)
+
+	vertical, err := gsf.NewVerticalReduction(reference, &proc_info)
+	if err != nil {
+		src.Close()
+		return src, file_info, err
+	}
+	src.Vertical = &vertical
+	src.Projection = proj
+
+	if geodesic {
+		src.Georef = gsf.GEOREF_GEODESIC
+	}
+
+	return src, file_info, nil
+}
+
+// reference_grid constructs the reference surface of a crossline comparison,
+// either by gridding the soundings of the reference GSF files, or by reading
+// the gridded surface of a TileDB group created by convert.
+func reference_grid(ctx *tiledb.Context, opts crossline_options) (gsf.Grid, error) {
+	var (
+		grid    gsf.Grid
+		gridder *gsf.Gridder
+		proj    *gsf.Projection
+	)
+
+	is_gsf := func(uri string) bool { return strings.EqualFold(filepath.Ext(uri), ".gsf") }
+
+	if len(opts.reference_uris) == 1 && !is_gsf(opts.reference_uris[0]) {
+		grp_uri := strings.TrimSuffix(opts.reference_uris[0], "/")
+		members, err := gsf.TileDBGroupAssets(ctx, grp_uri)
+		if err != nil {
+			return grid, err
+		}
+
+		asset, ok := members["Grid"]
+		if !ok {
+			return grid, errors.New("No gridded surface found within: " + grp_uri)
+		}
+
+		log.Println("Reading reference grid:", asset.Href)
+		return gsf.ReadGridTileDB(ctx, asset.Href)
+	}
+
+	// a resolution in degrees larger than ~1km is most likely intended as metres
+	if opts.projection == "" && opts.grid_resolution > 0.01 {
+		return grid, errors.New("Grid resolution is in degrees without a projection, and is implausibly coarse; set --projection or reduce --grid-resolution")
+	}
+
+	for _, gsf_uri := range opts.reference_uris {
+		if !is_gsf(gsf_uri) {
+			return grid, errors.New("Reference lines must be GSF files, or a single TileDB group created by convert")
+		}
+
+		src, file_info, err := open_gsf(gsf_uri, opts.config_uri, opts.in_memory, opts.geodesic, proj, gsf.VerticalReference(opts.vertical_reference))
+		if err != nil {
+			return grid, err
+		}
+
+		// the first reference line defines the projection and grid
+		if gridder == nil {
+			if opts.projection != "" {
+				coverage := src.SwathCoverage(&file_info, opts.simplify_tolerance)
+				prj, err := projection(&file_info, &coverage, opts.projection)
+				if err != nil {
+					src.Close()
+					return grid, err
+				}
+				log.Println("Projecting beams using:", prj.Definition)
+				proj = &prj
+				src.Projection = proj
+			}
+
+			sref := gsf.SpatialReference{Projection: proj, Vertical: *src.Vertical}
+			gridder, err = gsf.NewGridder(opts.grid_resolution, &sref, file_info.Metadata.CRS)
+			if err != nil {
+				src.Close()
+				return grid, err
+			}
+		}
+
+		log.Println("Gridding reference line")
+		err = src.GridPings(&file_info, gridder)
+		src.Close()
+		if err != nil {
+			return grid, err
+		}
+	}
+
+	if gridder == nil {
+		return grid, errors.New("No reference lines provided")
+	}
+
+	grid, ok := gridder.Grid()
+	if !ok {
+		return grid, errors.New("No soundings found within the reference lines")
+	}
+
+	return grid, nil
+}
+
+// compare_crosslines compares the soundings of the crosslines against the
+// reference surface of the mainscheme lines, writing the comparison as JSON
+// and the gridded depth differences as a TileDB array.
+func compare_crosslines(opts crossline_options) error {
+	var (
+		config *tiledb.Config
+		err    error
+	)
+
+	if len(opts.crossline_uris) == 0 {
+		return errors.New("No crosslines provided")
+	}
+
+	outdir_uri := opts.outdir_uri
+	if outdir_uri == "" {
+		outdir_uri, _ = filepath.Split(opts.crossline_uris[0])
+	}
+
+	// get a generic config if no path provided
+	if opts.config_uri == "" {
+		config, err = tiledb.NewConfig()
+		if err != nil {
+			return err
+		}
+	} else {
+		config, err = tiledb.LoadConfig(opts.config_uri)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer config.Free()
+
+	ctx, err := tiledb.NewContext(config)
+	if err != nil {
+		return err
+	}
+	defer ctx.Free()
+
+	grid, err := reference_grid(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	comparer, err := gsf.NewCrosslineComparer(&grid, opts.angle_bin_width, uint32(opts.min_count))
+	if err != nil {
+		return err
+	}
+
+	// the crosslines take on the spatial reference of the reference grid
+	for _, gsf_uri := range opts.crossline_uris {
+		src, file_info, err := open_gsf(gsf_uri, opts.config_uri, opts.in_memory, opts.geodesic, grid.Projection, grid.Vertical.Reference)
+		if err != nil {
+			return err
+		}
+
+		log.Println("Comparing crossline against the reference grid")
+		err = src.CompareCrossline(&file_info, comparer)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	comparison := comparer.Comparison()
+	comparison.Reference = opts.reference_uris
+	comparison.Crosslines = opts.crossline_uris
+	log.Println("Crossline soundings compared:", comparison.Compared, "of", comparison.Soundings)
+
+	out_uri := filepath.Join(outdir_uri, opts.name+"-crossline.json")
+	log.Println("Writing crossline comparison:", out_uri)
+	_, err = gsf.WriteJson(out_uri, opts.config_uri, comparison)
+	if err != nil {
+		return err
+	}
+
+	differences := comparer.Differences()
+	out_uri = filepath.Join(outdir_uri, opts.name+"-crossline-differences.tiledb")
+	log.Println("Writing crossline differences:", out_uri)
+	err = differences.ToTileDB(out_uri, ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// survey_report collates the metadata of each GSF file found within a
+// directory, and writes a consolidated report highlighting the files that
+// are inconsistent with the rest of the survey.
+func survey_report(uri string, outdir_uri string, name string, config_uri string, in_memory bool) error {
+	if outdir_uri == "" {
+		outdir_uri = uri
+	}
+
+	log.Println("Searching uri:", uri)
+	items := gsf.FindGsf(uri, config_uri)
+	log.Println("Number of GSFs to report:", len(items))
+	if len(items) == 0 {
+		return errors.New("No GSF files found within: " + uri)
+	}
+
+	// Create a context that will be cancelled when the user presses Ctrl+C (process receives termination signal).
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// fixed pool; each task writes to its own element of files
+	n := runtime.NumCPU() * 2
+	pool := pond.New(n, 0, pond.MinWorkers(n), pond.Context(ctx))
+
+	files := make([]gsf.SurveyFile, len(items))
+	for i, item := range items {
+		idx, item_uri := i, item
+		pool.Submit(func() {
+			// a file that fails to be read is reported as a read failure
+			// rather than halting the survey report
+			defer func() {
+				if r := recover(); r != nil {
+					log.Println("Error reading:", item_uri, r)
+					files[idx] = gsf.SurveyFile{GSF_URI: item_uri, Read_error: fmt.Sprint(r)}
+				}
+			}()
+
+			log.Println("Collating metadata:", item_uri)
+			src := gsf.OpenGSF(item_uri, config_uri, in_memory)
+			defer src.Close()
+
+			file_info := src.Info()
+			file_info.NavigationQA(gsf.DEFAULT_NAVIGATION_THRESHOLDS)
+			files[idx] = file_info.SurveyFile()
+		})
+	}
+
+	pool.StopAndWait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	report := gsf.NewSurveyReport(files)
+	for _, file := range report.Files {
+		if len(file.Outliers) > 0 {
+			log.Println("Outlier:", file.GSF_URI, file.Outliers)
+		}
+	}
+	log.Println("Files with outliers:", report.Outlier_files, "of", len(report.Files))
+
+	out_uri := filepath.Join(outdir_uri, name+"-survey-report.json")
+	log.Println("Writing survey report:", out_uri)
+	_, err := gsf.WriteJson(out_uri, config_uri, report)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// convert_flags are the conversion options common to the convert and
+// convert-trawl commands, and are collected by options.
+var convert_flags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "config-uri",
+		Usage: "URI or pathname to a TileDB config file.",
+	},
+	&cli.StringFlag{
+		Name:  "outdir-uri",
+		Usage: "URI or pathname to an output directory.",
+	},
+	&cli.BoolFlag{
+		Name:  "in-memory",
+		Usage: "Read the entire contents of a GSF file into memory before processing.",
+	},
+	&cli.BoolFlag{
+		Name:  "metadata-only",
+		Usage: "Only decode and export metadata relating to the GSF file.",
+	},
+	&cli.BoolFlag{
+		Name:  "dense",
+		Usage: "Create a dense TileDB array schema for the beam data. Default is sparse.",
+	},
+	&cli.BoolFlag{
+		Name:  "no-coverage",
+		Usage: "Don't export the trackline and swath coverage as GeoJSON.",
+	},
+	&cli.BoolFlag{
+		Name:  "kml",
+		Usage: "Additionally export the trackline and swath coverage as KML.",
+	},
+	&cli.BoolFlag{
+		Name:  "stac",
+		Usage: "Additionally export a STAC Item describing the converted outputs.",
+	},
+	&cli.BoolFlag{
+		Name:  "iso19115",
+		Usage: "Additionally export ISO 19115-3 XML metadata.",
+	},
+	&cli.Float64Flag{
+		Name:  "simplify-tolerance",
+		Usage: "Tolerance (degrees) used to simplify the trackline and swath coverage.",
+		Value: 1e-5,
+	},
+	&cli.StringFlag{
+		Name:  "backend",
+		Usage: "Output backend for the array data; tiledb or zarr.",
+		Value: "tiledb",
+	},
+	&cli.BoolFlag{
+		Name:  "geodesic",
+		Usage: "Georeference the beams using geodesics on the ellipsoid of the horizontal datum.",
+	},
+	&cli.StringFlag{
+		Name:  "projection",
+		Usage: "Add projected beam coordinates; utm (zone from the survey centroid) or a PROJ string for tmerc/lcc/utm.",
+	},
+	&cli.BoolFlag{
+		Name:  "projected-dims",
+		Usage: "Use the projected coordinates as the dimensions of the sparse beam array.",
+	},
+	&cli.StringFlag{
+		Name:  "vertical-reference",
+		Usage: "Vertical reference for the soundings; recorded, waterline, chart_datum, ellipsoid or vessel_reference_point.",
+		Value: "recorded",
+	},
+	&cli.BoolFlag{
+		Name:  "interpolate-attitude",
+		Usage: "Add the attitude interpolated at each ping's timestamp to the ping headers.",
+	},
+	&cli.DurationFlag{
+		Name:  "attitude-tolerance",
+		Usage: "Maximum interval between attitude measurements before reporting a gap in the attitude QA and interpolated attitude.",
+		Value: gsf.DEFAULT_ATTITUDE_TOLERANCE,
+	},
+	&cli.StringFlag{
+		Name:  "svp-selection",
+		Usage: "Add the SVP index to the ping headers, selecting the SVP by; applied_time, observation_time or distance.",
+	},
+	&cli.Float64Flag{
+		Name:  "grid-resolution",
+		Usage: "Additionally grid the beam data at this resolution (projected units if --projection is set, otherwise degrees). TileDB backend only.",
+	},
+	&cli.Float64Flag{
+		Name:  "mosaic-resolution",
+		Usage: "Additionally mosaic the backscatter at this resolution (projected units if --projection is set, otherwise degrees). TileDB backend only.",
+	},
+	&cli.StringFlag{
+		Name:  "mosaic-source",
+		Usage: "Backscatter used for the mosaic; ts_mean, time_series, mean_cal_amplitude or mean_rel_amplitude.",
+		Value: "ts_mean",
+	},
+	&cli.BoolFlag{
+		Name:  "mosaic-normalise",
+		Usage: "Normalise the mosaic backscatter to a 45 degree incidence angle using the angular response.",
+	},
+	&cli.BoolFlag{
+		Name:  "angular-response",
+		Usage: "Additionally export the angular response curves of the backscatter for each sector and frequency as JSON.",
+	},
+	&cli.StringFlag{
+		Name:  "angular-source",
+		Usage: "Backscatter used for the angular response; ts_mean, time_series, mean_cal_amplitude or mean_rel_amplitude.",
+		Value: "ts_mean",
+	},
+	&cli.Float64Flag{
+		Name:  "angular-bin-width",
+		Usage: "Width (degrees) of the angular bins of the angular response.",
+		Value: 1.0,
+	},
+	&cli.BoolFlag{
+		Name:  "incident-beam-adj",
+		Usage: "Adjust the beam angles by the incident beam adjustment (roll and slope) for the angular response.",
+	},
+	&cli.BoolFlag{
+		Name:  "decode-flags",
+		Usage: "Add the decoded beam flags (rejected, selected, manual edit, filter edit, category and reason) to the beam data.",
+	},
+	&cli.StringFlag{
+		Name:  "reject-policy",
+		Usage: "Handling of the beams rejected by their beam flags; keep, drop (sparse beam data) or null (dense beam data).",
+		Value: "keep",
+	},
+	&cli.DurationFlag{
+		Name:  "nav-time-gap",
+		Usage: "Navigation QA; maximum interval between successive pings before reporting a time gap.",
+		Value: 30 * time.Second,
+	},
+	&cli.Float64Flag{
+		Name:  "nav-speed-limit",
+		Usage: "Navigation QA; maximum speed (m/s) implied by the positions of successive pings before reporting a speed spike.",
+		Value: 15.0,
+	},
+	&cli.Float64Flag{
+		Name:  "nav-heading-limit",
+		Usage: "Navigation QA; maximum change (degrees) in heading or course between successive pings before reporting a jump.",
+		Value: 30.0,
+	},
+	&cli.BoolFlag{
+		Name:  "validate-summary",
+		Usage: "Validate the swath bathymetry summary against the extents computed from the ping data. Requires an additional pass over the pings.",
+	},
+	&cli.BoolFlag{
+		Name:  "split-heads",
+		Usage: "Write the beam data of each sonar head (dual head configurations) to its own beam array. TileDB backend only.",
+	},
+	&cli.StringFlag{
+		Name:  "s44-order",
+		Usage: "Assess the beam uncertainties against an IHO S-44 order; exclusive, special, 1a, 1b or 2. Empty disables the assessment.",
+	},
+	&cli.Float64Flag{
+		Name:  "s44-scale",
+		Usage: "Scale applied to the beam uncertainties to give the 95% confidence level required by S-44 (e.g. 1.96 for 1 sigma uncertainties).",
+		Value: 1.0,
+	},
+}
+
 func main() {
 	app := &cli.App{
 		Commands: []*cli.Command{
 			&cli.Command{
 				Name: "convert",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:  "gsf-uri",
 						Usage: "URI or pathname to a GSF file.",
 					},
+				}, convert_flags...),
+				Action: func(cCtx *cli.Context) error {
+					err := convert_gsf(cCtx.String("gsf-uri"), options(cCtx))
+					return err
+				},
+			},
+			&cli.Command{
+				Name: "convert-trawl",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "uri",
+						Usage: "URI or pathname to a directory containing gsf files.",
+					},
+				}, convert_flags...),
+				Action: func(cCtx *cli.Context) error {
+					err := convert_gsf_list(cCtx.String("uri"), options(cCtx))
+					return err
+				},
+			},
+			&cli.Command{
+				Name: "export",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "uri",
+						Usage: "URI or pathname to a TileDB group created by convert.",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Export format; geotiff.",
+						Value: "geotiff",
+					},
+					&cli.StringFlag{
+						Name:  "compression",
+						Usage: "GeoTIFF compression; deflate, zstd or none.",
+						Value: "deflate",
+					},
+					&cli.StringFlag{
+						Name:  "config-uri",
+						Usage: "URI or pathname to a TileDB config file.",
+					},
+					&cli.StringFlag{
+						Name:  "outdir-uri",
+						Usage: "URI or pathname to an output directory.",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					err := export_tiledb(
+						cCtx.String("uri"),
+						cCtx.String("format"),
+						cCtx.String("outdir-uri"),
+						cCtx.String("compression"),
+						cCtx.String("config-uri"),
+					)
+					return err
+				},
+			},
+			&cli.Command{
+				Name: "crossline",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "reference-uri",
+						Usage:    "URI or pathname to a mainscheme GSF file (repeatable), or to a single TileDB group (created by convert) containing a gridded surface.",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:     "crossline-uri",
+						Usage:    "URI or pathname to a crossline GSF file (repeatable).",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name used as the prefix of the output files.",
+						Value: "survey",
+					},
 					&cli.StringFlag{
 						Name:  "config-uri",
 						Usage: "URI or pathname to a TileDB config file.",
@@ -193,49 +1157,92 @@ func main() {
 						Usage: "Read the entire contents of a GSF file into memory before processing.",
 					},
 					&cli.BoolFlag{
-						Name:  "metadata-only",
-						Usage: "Only decode and export metadata relating to the GSF file.",
+						Name:  "geodesic",
+						Usage: "Georeference the beams using geodesics on the ellipsoid of the horizontal datum.",
 					},
-					&cli.BoolFlag{
-						Name:  "dense",
-						Usage: "Create a dense TileDB array schema for the beam data. Default is sparse.",
+					&cli.StringFlag{
+						Name:  "projection",
+						Usage: "Grid the reference lines using projected coordinates; utm (zone from the survey centroid) or a PROJ string for tmerc/lcc/utm. Empty grids in longitude and latitude.",
+						Value: "utm",
+					},
+					&cli.StringFlag{
+						Name:  "vertical-reference",
+						Usage: "Vertical reference for the soundings; recorded, waterline, chart_datum, ellipsoid or vessel_reference_point.",
+						Value: "recorded",
+					},
+					&cli.Float64Flag{
+						Name:  "grid-resolution",
+						Usage: "Cell size of the reference grid, in the units of the beam coordinates (degrees, or metres if projected).",
+						Value: 5.0,
+					},
+					&cli.Float64Flag{
+						Name:  "simplify-tolerance",
+						Usage: "Tolerance (degrees) used to simplify the swath coverage of the first reference line when selecting the projection.",
+						Value: 1e-5,
+					},
+					&cli.Float64Flag{
+						Name:  "angle-bin-width",
+						Usage: "Width (degrees) of the beam angle bins of the depth difference statistics.",
+						Value: 5.0,
+					},
+					&cli.UintFlag{
+						Name:  "min-count",
+						Usage: "Minimum number of reference soundings within a grid cell for the cell to be compared.",
+						Value: 3,
 					},
 				},
 				Action: func(cCtx *cli.Context) error {
-					err := convert_gsf(cCtx.String("gsf-uri"), cCtx.String("config-uri"), cCtx.String("outdir-uri"), cCtx.Bool("in-memory"), cCtx.Bool("metadata-only"), cCtx.Bool("dense"))
+					err := compare_crosslines(crossline_options{
+						config_uri:         cCtx.String("config-uri"),
+						outdir_uri:         cCtx.String("outdir-uri"),
+						name:               cCtx.String("name"),
+						reference_uris:     cCtx.StringSlice("reference-uri"),
+						crossline_uris:     cCtx.StringSlice("crossline-uri"),
+						in_memory:          cCtx.Bool("in-memory"),
+						geodesic:           cCtx.Bool("geodesic"),
+						projection:         cCtx.String("projection"),
+						vertical_reference: cCtx.String("vertical-reference"),
+						grid_resolution:    cCtx.Float64("grid-resolution"),
+						simplify_tolerance: cCtx.Float64("simplify-tolerance"),
+						angle_bin_width:    cCtx.Float64("angle-bin-width"),
+						min_count:          cCtx.Uint("min-count"),
+					})
 					return err
 				},
 			},
 			&cli.Command{
-				Name: "convert-trawl",
+				Name: "survey-report",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "uri",
 						Usage: "URI or pathname to a directory containing gsf files.",
 					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name used as the prefix of the report.",
+						Value: "survey",
+					},
 					&cli.StringFlag{
 						Name:  "config-uri",
 						Usage: "URI or pathname to a TileDB config file.",
 					},
 					&cli.StringFlag{
 						Name:  "outdir-uri",
-						Usage: "URI or pathname to an output directory.",
+						Usage: "URI or pathname to an output directory. Defaults to the search directory.",
 					},
 					&cli.BoolFlag{
 						Name:  "in-memory",
 						Usage: "Read the entire contents of a GSF file into memory before processing.",
 					},
-					&cli.BoolFlag{
-						Name:  "metadata-only",
-						Usage: "Only decode and export metadata relating to the GSF files.",
-					},
-					&cli.BoolFlag{
-						Name:  "dense",
-						Usage: "Create a dense TileDB array schema for the beam data. Default is sparse.",
-					},
 				},
 				Action: func(cCtx *cli.Context) error {
-					err := convert_gsf_list(cCtx.String("uri"), cCtx.String("config-uri"), cCtx.String("outdir-uri"), cCtx.Bool("in-memory"), cCtx.Bool("metadata-only"), cCtx.Bool("dense"))
+					err := survey_report(
+						cCtx.String("uri"),
+						cCtx.String("outdir-uri"),
+						cCtx.String("name"),
+						cCtx.String("config-uri"),
+						cCtx.Bool("in-memory"),
+					)
 					return err
 				},
 			},
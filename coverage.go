@@ -0,0 +1,251 @@
+package gsf
+
+import (
+	"errors"
+	"log"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SwathCoverage contains the spatial and temporal coverage of the swath data
+// contained within the GSF file.
+// The Trackline is the (simplified) vessel track given by the position in each
+// PingHeader, and the Footprint is a closed polygon ring built from the
+// outermost beams of each ping. The ring is oriented counter-clockwise, as
+// required of an exterior ring by RFC 7946.
+// No attempt is made to resolve self-intersections of the footprint, which can
+// occur when the vessel turns tighter than the width of the swath.
+type SwathCoverage struct {
+	Line_name      string
+	Start_datetime time.Time
+	End_datetime   time.Time
+	Trackline      LonLat
+	Footprint      LonLat
+}
+
+// lineName derives the survey line name from the basename of the GSF file.
+func lineName(gsf_uri string) string {
+	base := filepath.Base(gsf_uri)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// outerBeams finds the index of the first and last beams within a ping that
+// contain a valid sounding. A beam is considered valid if it has a depth value
+// that is not the null value. Pings that don't contain depth will consider all
+// beams as valid.
+func outerBeams(ba *BeamArray, nbeams int) (first, last int, ok bool) {
+	if nbeams == 0 {
+		return 0, 0, false
+	}
+
+	if len(ba.Z) != nbeams {
+		return 0, nbeams - 1, true
+	}
+
+	first = -1
+	for i := 0; i < nbeams; i++ {
+		if ba.Z[i] != NULL_DEPTH_F64 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	if first < 0 {
+		return 0, 0, false
+	}
+
+	return first, last, true
+}
+
+// segmentDistance calculates the distance of the point (x, y) from the line
+// segment defined by (x1, y1) and (x2, y2).
+func segmentDistance(x, y, x1, y1, x2, y2 float64) float64 {
+	dx := x2 - x1
+	dy := y2 - y1
+	length := dx*dx + dy*dy
+
+	if length == 0.0 {
+		return math.Hypot(x-x1, y-y1)
+	}
+
+	// projection of the point onto the segment, clamped to the segment end points
+	t := ((x-x1)*dx + (y-y1)*dy) / length
+	t = math.Max(0.0, math.Min(1.0, t))
+
+	return math.Hypot(x-(x1+t*dx), y-(y1+t*dy))
+}
+
+// simplifyLine reduces the number of vertices of a line using the
+// Ramer-Douglas-Peucker algorithm. The tolerance is expressed in the same units
+// as the line coordinates, which for LonLat will be degrees.
+// A tolerance <= 0 returns the line unaltered.
+func simplifyLine(line LonLat, tolerance float64) LonLat {
+	n := len(line.Longitude)
+	if n < 3 || tolerance <= 0.0 {
+		return line
+	}
+
+	keep := make([]bool, n)
+	keep[0] = true
+	keep[n-1] = true
+
+	// iterative rather than recursive, as a ping trackline can contain
+	// tens of thousands of vertices
+	stack := [][2]int{{0, n - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		start, end := seg[0], seg[1]
+
+		max_dist := 0.0
+		max_idx := 0
+		for i := start + 1; i < end; i++ {
+			dist := segmentDistance(
+				line.Longitude[i], line.Latitude[i],
+				line.Longitude[start], line.Latitude[start],
+				line.Longitude[end], line.Latitude[end],
+			)
+			if dist > max_dist {
+				max_dist = dist
+				max_idx = i
+			}
+		}
+
+		if max_dist > tolerance {
+			keep[max_idx] = true
+			stack = append(stack, [2]int{start, max_idx}, [2]int{max_idx, end})
+		}
+	}
+
+	simplified := LonLat{make([]float64, 0, n), make([]float64, 0, n)}
+	for i := 0; i < n; i++ {
+		if keep[i] {
+			simplified.Longitude = append(simplified.Longitude, line.Longitude[i])
+			simplified.Latitude = append(simplified.Latitude, line.Latitude[i])
+		}
+	}
+
+	return simplified
+}
+
+// ringArea computes the signed area (shoelace formula) of a closed ring in
+// its own coordinate units. The area is positive for a counter-clockwise ring.
+func ringArea(ring LonLat) float64 {
+	area := 0.0
+	for i := 0; i < len(ring.Longitude)-1; i++ {
+		area += ring.Longitude[i]*ring.Latitude[i+1] - ring.Longitude[i+1]*ring.Latitude[i]
+	}
+
+	return area / 2.0
+}
+
+// footprintRing constructs a closed, counter-clockwise polygon ring from the
+// port and starboard edges of the swath. The port edge is traversed forwards
+// in time and the starboard edge backwards in time, which is clockwise for a
+// vessel travelling in a straight line, in which case the ring is reversed.
+func footprintRing(port, stbd LonLat) LonLat {
+	n_port := len(port.Longitude)
+	n_stbd := len(stbd.Longitude)
+
+	if n_port < 2 || n_stbd < 2 {
+		return LonLat{make([]float64, 0), make([]float64, 0)}
+	}
+
+	n := n_port + n_stbd + 1
+	ring := LonLat{make([]float64, 0, n), make([]float64, 0, n)}
+
+	ring.Longitude = append(ring.Longitude, port.Longitude...)
+	ring.Latitude = append(ring.Latitude, port.Latitude...)
+
+	for i := n_stbd - 1; i >= 0; i-- {
+		ring.Longitude = append(ring.Longitude, stbd.Longitude[i])
+		ring.Latitude = append(ring.Latitude, stbd.Latitude[i])
+	}
+
+	// close the ring
+	ring.Longitude = append(ring.Longitude, port.Longitude[0])
+	ring.Latitude = append(ring.Latitude, port.Latitude[0])
+
+	if ringArea(ring) < 0.0 {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			ring.Longitude[i], ring.Longitude[j] = ring.Longitude[j], ring.Longitude[i]
+			ring.Latitude[i], ring.Latitude[j] = ring.Latitude[j], ring.Latitude[i]
+		}
+	}
+
+	return ring
+}
+
+// SwathCoverage reads every SWATH_BATHYMETRY_PING record and constructs the
+// SwathCoverage type containing the vessel trackline and swath footprint.
+// The tolerance (in degrees) is used to simplify the trackline and the
+// port/starboard edges of the footprint. Pings with a null position are
+// excluded, and pings that fail to decode are logged and skipped.
+func (g *GsfFile) SwathCoverage(fi *FileInfo, tolerance float64) SwathCoverage {
+	var (
+		coverage SwathCoverage
+		track    LonLat
+		port     LonLat
+		stbd     LonLat
+	)
+
+	npings := fi.Record_Counts[RecordNames[SWATH_BATHYMETRY_PING]]
+
+	track = LonLat{make([]float64, 0, npings), make([]float64, 0, npings)}
+	port = LonLat{make([]float64, 0, npings), make([]float64, 0, npings)}
+	stbd = LonLat{make([]float64, 0, npings), make([]float64, 0, npings)}
+
+	coverage.Line_name = lineName(fi.Metadata.GSF_Details.GSF_URI)
+
+	// get the original starting point so we can jump back when done
+	original_pos, _ := Tell(g.Stream)
+
+	for idx := uint64(0); idx < npings; idx++ {
+		ping_data, err := g.readPing(fi, idx)
+		if err != nil {
+			errn := errors.New("Error reading ping: " + strconv.Itoa(int(idx)))
+			log.Println(errors.Join(err, errn))
+			log.Println("Skipping PingID: ", idx)
+			continue
+		}
+
+		hdr := &ping_data.Ping_headers
+		lon := hdr.Longitude[0]
+		lat := hdr.Latitude[0]
+
+		if lon == NULL_LONGITUDE_F64 || lat == NULL_LATITUDE_F64 {
+			continue
+		}
+
+		if coverage.Start_datetime.IsZero() || hdr.Timestamp[0].Before(coverage.Start_datetime) {
+			coverage.Start_datetime = hdr.Timestamp[0]
+		}
+		if hdr.Timestamp[0].After(coverage.End_datetime) {
+			coverage.End_datetime = hdr.Timestamp[0]
+		}
+
+		track.Longitude = append(track.Longitude, lon)
+		track.Latitude = append(track.Latitude, lat)
+
+		first, last, ok := outerBeams(&ping_data.Beam_array, len(ping_data.Lon_lat.Longitude))
+		if ok {
+			port.Longitude = append(port.Longitude, ping_data.Lon_lat.Longitude[first])
+			port.Latitude = append(port.Latitude, ping_data.Lon_lat.Latitude[first])
+			stbd.Longitude = append(stbd.Longitude, ping_data.Lon_lat.Longitude[last])
+			stbd.Latitude = append(stbd.Latitude, ping_data.Lon_lat.Latitude[last])
+		}
+	}
+
+	// reset file position
+	_, _ = g.Stream.Seek(original_pos, 0)
+
+	coverage.Trackline = simplifyLine(track, tolerance)
+	coverage.Footprint = footprintRing(simplifyLine(port, tolerance), simplifyLine(stbd, tolerance))
+
+	return coverage
+}
@@ -0,0 +1,404 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	tiledb "github.com/TileDB-Inc/TileDB-Go"
+	"github.com/samber/lo"
+)
+
+// differenceAccumulator accumulates depth differences, with the mean and
+// variance accumulated using Welford's algorithm.
+type differenceAccumulator struct {
+	count  uint64
+	mean   float64
+	m2     float64
+	sum_sq float64
+	min    float64
+	max    float64
+}
+
+// add accumulates a depth difference.
+func (da *differenceAccumulator) add(value float64) {
+	if da.count == 0 {
+		da.min = value
+		da.max = value
+	}
+
+	da.count++
+	delta := value - da.mean
+	da.mean += delta / float64(da.count)
+	da.m2 += delta * (value - da.mean)
+	da.sum_sq += value * value
+	da.min = math.Min(da.min, value)
+	da.max = math.Max(da.max, value)
+}
+
+// std computes the population standard deviation of the accumulated differences.
+func (da *differenceAccumulator) std() float64 {
+	if da.count == 0 {
+		return 0.0
+	}
+	return math.Sqrt(da.m2 / float64(da.count))
+}
+
+// rms computes the root mean square of the accumulated differences.
+func (da *differenceAccumulator) rms() float64 {
+	if da.count == 0 {
+		return 0.0
+	}
+	return math.Sqrt(da.sum_sq / float64(da.count))
+}
+
+// DifferenceStatistics summarises a set of depth differences. The statistics
+// are zero if there are no differences.
+type DifferenceStatistics struct {
+	Count uint64
+	Mean  float64
+	Std   float64
+	Rms   float64
+	Min   float64
+	Max   float64
+}
+
+// statistics constructs the DifferenceStatistics of the accumulated differences.
+func (da *differenceAccumulator) statistics() DifferenceStatistics {
+	return DifferenceStatistics{
+		Count: da.count,
+		Mean:  da.mean,
+		Std:   da.std(),
+		Rms:   da.rms(),
+		Min:   da.min,
+		Max:   da.max,
+	}
+}
+
+// CrosslineAngles contains the depth differences as a function of the beam
+// angle (degrees, signed as recorded), for each angular bin containing
+// differences, with Angle being the centre of each bin.
+type CrosslineAngles struct {
+	Angle []float64
+	Count []uint64
+	Mean  []float64
+	Std   []float64
+	Rms   []float64
+	Min   []float64
+	Max   []float64
+}
+
+// CrosslineComparison is the comparison of the crossline soundings against
+// the reference surface gridded from the mainscheme lines.
+// Soundings is the number of crossline soundings considered, of which
+// Compared fell within a reference cell containing at least Min_count
+// soundings. The differences are the crossline Z minus the reference Z
+// (positive where the crossline is shallower), and Relative is the
+// difference as a percentage of the reference depth.
+type CrosslineComparison struct {
+	Reference       []string
+	Crosslines      []string
+	Resolution      float64
+	Min_count       uint32
+	Angle_bin_width float64
+	Vertical        VerticalReduction
+	Projection      *Projection
+	Soundings       uint64
+	Compared        uint64
+	Difference      DifferenceStatistics
+	Relative        DifferenceStatistics
+	Angles          CrosslineAngles
+}
+
+// DifferenceLayers contains the statistics of the crossline depth differences
+// binned into each cell of the reference grid. Cells without differences are
+// NaN, with a Count of zero.
+type DifferenceLayers struct {
+	Mean  []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Std   []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Min   []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Max   []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Count []uint32  `tiledb:"dtype=uint32,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// CrosslineDifferences is the raster of the crossline depth differences,
+// sharing the geometry of the reference grid.
+type CrosslineDifferences struct {
+	RasterGeometry
+	Vertical VerticalReduction
+	Layers   DifferenceLayers
+}
+
+// CrosslineComparer compares the soundings of crosslines against a reference
+// Grid (the mainscheme lines), streaming over chunks of PingData.
+// The reference depth of each crossline sounding is the Mean of the reference
+// cell containing the sounding, with cells of fewer than Min_count soundings
+// being excluded. The crossline soundings must share the spatial reference
+// (projection and vertical reference) of the reference grid.
+// Only soundings that are not rejected (see BeamFlag.IsRejected, if the beam
+// flags exist) with a valid Z value and position are compared. The beam angle
+// is the BeamAngle, or if it doesn't exist, is derived from the AcrossTrack
+// distance and the depth.
+type CrosslineComparer struct {
+	Reference       *Grid
+	Angle_bin_width float64
+	Min_count       uint32
+	min_col         int64
+	max_row         int64
+	soundings       uint64
+	total           differenceAccumulator
+	relative        differenceAccumulator
+	angles          map[int64]*differenceAccumulator
+	cells           map[uint64]*differenceAccumulator
+}
+
+// NewCrosslineComparer constructs a CrosslineComparer for the reference grid,
+// aggregating the differences into angular bins of angle_bin_width degrees.
+func NewCrosslineComparer(reference *Grid, angle_bin_width float64, min_count uint32) (*CrosslineComparer, error) {
+	if reference.Columns == 0 || reference.Rows == 0 || !(reference.Resolution > 0.0) {
+		return nil, errors.Join(ErrCrossline, errors.New("Reference grid has no cells"))
+	}
+
+	if !(angle_bin_width > 0.0) {
+		return nil, errors.Join(ErrCrossline, errors.New("Angular bin width must be positive"))
+	}
+
+	// recover the cell keys of the grid's north-west corner (see rasterExtent)
+	cc := CrosslineComparer{
+		Reference:       reference,
+		Angle_bin_width: angle_bin_width,
+		Min_count:       min_count,
+		min_col:         int64(math.Round(reference.X_origin / reference.Resolution)),
+		max_row:         int64(math.Round(reference.Y_origin/reference.Resolution)) - 1,
+		angles:          make(map[int64]*differenceAccumulator),
+		cells:           make(map[uint64]*differenceAccumulator),
+	}
+
+	return &cc, nil
+}
+
+// referenceCell locates the cell of the reference grid containing (x, y).
+// The returned bool is false if (x, y) is outside the grid.
+func (cc *CrosslineComparer) referenceCell(x, y float64) (uint64, bool) {
+	grid := cc.Reference
+	key := cellKey(x, y, grid.Resolution)
+
+	if key[0] < cc.min_col || key[0] >= cc.min_col+int64(grid.Columns) {
+		return 0, false
+	}
+	if key[1] > cc.max_row || key[1] <= cc.max_row-int64(grid.Rows) {
+		return 0, false
+	}
+
+	return grid.cellIndex(key, cc.min_col, cc.max_row), true
+}
+
+// accumulate adds the difference to the accumulator given by key, creating
+// the accumulator if required.
+func accumulate[K comparable](accumulators map[K]*differenceAccumulator, key K, value float64) {
+	da, ok := accumulators[key]
+	if !ok {
+		da = &differenceAccumulator{}
+		accumulators[key] = da
+	}
+	da.add(value)
+}
+
+// Add compares the soundings of the PingData against the reference grid.
+func (cc *CrosslineComparer) Add(pd *PingData) {
+	ba := &pd.Beam_array
+	layers := &cc.Reference.Layers
+	x := pd.Lon_lat.Longitude
+	y := pd.Lon_lat.Latitude
+	if cc.Reference.Projection != nil {
+		x = pd.Easting_northing.Easting
+		y = pd.Easting_northing.Northing
+	}
+
+	nbeams := len(ba.Z)
+	if len(x) != nbeams || len(y) != nbeams {
+		return
+	}
+
+	has_flags := len(ba.BeamFlags) == nbeams
+	has_angle := len(ba.BeamAngle) == nbeams
+	has_across := len(ba.AcrossTrack) == nbeams
+
+	for i, z := range ba.Z {
+		if z == NULL_DEPTH_F64 || math.IsNaN(z) {
+			continue
+		}
+		if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+			continue
+		}
+		if pd.Lon_lat.Longitude[i] == NULL_LONGITUDE_F64 || pd.Lon_lat.Latitude[i] == NULL_LATITUDE_F64 {
+			continue
+		}
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			continue
+		}
+
+		cc.soundings++
+
+		idx, ok := cc.referenceCell(x[i], y[i])
+		if !ok || layers.Count[idx] < cc.Min_count {
+			continue
+		}
+
+		// cells without soundings are NaN
+		reference := float64(layers.Mean[idx])
+		if math.IsNaN(reference) {
+			continue
+		}
+
+		difference := z - reference
+		cc.total.add(difference)
+		accumulate(cc.cells, idx, difference)
+		if reference != 0.0 {
+			cc.relative.add(difference / math.Abs(reference) * 100.0)
+		}
+
+		angle := math.NaN()
+		if has_angle {
+			angle = float64(ba.BeamAngle[i])
+		} else if has_across {
+			angle = math.Atan2(ba.AcrossTrack[i], math.Abs(z)) * 180.0 / math.Pi
+		}
+		if !math.IsNaN(angle) {
+			accumulate(cc.angles, int64(math.Floor(angle/cc.Angle_bin_width)), difference)
+		}
+	}
+}
+
+// Comparison computes the statistics of the depth differences, in total and
+// for each angular bin (ordered by angle).
+func (cc *CrosslineComparer) Comparison() CrosslineComparison {
+	comparison := CrosslineComparison{
+		Resolution:      cc.Reference.Resolution,
+		Min_count:       cc.Min_count,
+		Angle_bin_width: cc.Angle_bin_width,
+		Vertical:        cc.Reference.Vertical,
+		Projection:      cc.Reference.Projection,
+		Soundings:       cc.soundings,
+		Compared:        cc.total.count,
+		Difference:      cc.total.statistics(),
+		Relative:        cc.relative.statistics(),
+	}
+
+	keys := lo.Keys(cc.angles)
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	angles := &comparison.Angles
+	for _, key := range keys {
+		stats := cc.angles[key].statistics()
+		angles.Angle = append(angles.Angle, (float64(key)+0.5)*cc.Angle_bin_width)
+		angles.Count = append(angles.Count, stats.Count)
+		angles.Mean = append(angles.Mean, stats.Mean)
+		angles.Std = append(angles.Std, stats.Std)
+		angles.Rms = append(angles.Rms, stats.Rms)
+		angles.Min = append(angles.Min, stats.Min)
+		angles.Max = append(angles.Max, stats.Max)
+	}
+
+	return comparison
+}
+
+// Differences constructs the raster of the depth differences binned into the
+// cells of the reference grid.
+func (cc *CrosslineComparer) Differences() CrosslineDifferences {
+	cd := CrosslineDifferences{
+		RasterGeometry: cc.Reference.RasterGeometry,
+		Vertical:       cc.Reference.Vertical,
+	}
+
+	ncells := int(cd.Columns * cd.Rows)
+	layers := DifferenceLayers{
+		Mean:  make([]float32, ncells),
+		Std:   make([]float32, ncells),
+		Min:   make([]float32, ncells),
+		Max:   make([]float32, ncells),
+		Count: make([]uint32, ncells),
+	}
+
+	nan := float32(math.NaN())
+	for i := 0; i < ncells; i++ {
+		layers.Mean[i] = nan
+		layers.Std[i] = nan
+		layers.Min[i] = nan
+		layers.Max[i] = nan
+	}
+
+	for idx, cell := range cc.cells {
+		layers.Count[idx] = uint32(cell.count)
+		layers.Mean[idx] = float32(cell.mean)
+		layers.Std[idx] = float32(cell.std())
+		layers.Min[idx] = float32(cell.min)
+		layers.Max[idx] = float32(cell.max)
+	}
+
+	cd.Layers = layers
+
+	return cd
+}
+
+// ToTileDB writes the CrosslineDifferences to a dense TileDB array using
+// [Row, Column] as the dimensional axes. The raster geometry and vertical
+// reference are written to the array metadata under the key "Crossline_Differences".
+func (cd *CrosslineDifferences) ToTileDB(array_uri string, ctx *tiledb.Context) error {
+	md := gridMetadata{
+		RasterGeometry:     cd.RasterGeometry,
+		Vertical_Reference: cd.Vertical,
+	}
+
+	err := cd.writeRasterTileDB(ctx, array_uri, &cd.Layers, "Crossline_Differences", md)
+	if err != nil {
+		return errors.Join(ErrCrossline, err)
+	}
+
+	return nil
+}
+
+// GeoTiff constructs a GeoTiff from the difference layers, using NaN as the
+// no data value. The Count layer is converted to Float32, with zero counts as
+// no data.
+func (cd *CrosslineDifferences) GeoTiff(compression TiffCompression) GeoTiff {
+	count := make([]float32, len(cd.Layers.Count))
+	for i, c := range cd.Layers.Count {
+		count[i] = float32(c)
+		if c == 0 {
+			count[i] = float32(math.NaN())
+		}
+	}
+
+	gt := cd.geoTiff(compression)
+	gt.Band_names = []string{"Mean", "Std", "Min", "Max", "Count"}
+	gt.Bands = [][]float32{
+		cd.Layers.Mean,
+		cd.Layers.Std,
+		cd.Layers.Min,
+		cd.Layers.Max,
+		count,
+	}
+
+	return gt
+}
+
+// GridPings bins the soundings of the swath bathymetry pings into the Gridder,
+// such as for constructing the reference surface of a crossline comparison.
+// The spatial reference of the Gridder should match that of the GsfFile.
+func (g *GsfFile) GridPings(fi *FileInfo, gridder *Gridder) error {
+	return g.pingChunks(fi, false, func(ping_data_chunk *PingData, _ *PingBeamNumbers) error {
+		gridder.Add(ping_data_chunk)
+		return nil
+	})
+}
+
+// CompareCrossline compares the soundings of the swath bathymetry pings
+// against the reference grid of the CrosslineComparer.
+// The spatial reference of the GsfFile should match that of the reference grid.
+func (g *GsfFile) CompareCrossline(fi *FileInfo, cc *CrosslineComparer) error {
+	return g.pingChunks(fi, false, func(ping_data_chunk *PingData, _ *PingBeamNumbers) error {
+		cc.Add(ping_data_chunk)
+		return nil
+	})
+}
@@ -0,0 +1,65 @@
+package gsf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// geographicEpsg maps normalised horizontal datum names to the EPSG code of
+// the geographic 2D CRS based on that datum.
+var geographicEpsg = map[string]int{
+	"wgs84":   4326,
+	"wgs72":   4322,
+	"nad83":   4269,
+	"nad27":   4267,
+	"gda94":   4283,
+	"gda2020": 7844,
+	"etrs89":  4258,
+	"ed50":    4230,
+}
+
+// datumEllipsoid maps normalised horizontal datum names to the reference
+// ellipsoid of that datum.
+var datumEllipsoid = map[string]Ellipsoid{
+	"wgs84":   WGS84,
+	"wgs72":   WGS72,
+	"nad83":   GRS80,
+	"nad27":   CLARKE_1866,
+	"gda94":   GRS80,
+	"gda2020": GRS80,
+	"etrs89":  GRS80,
+	"ed50":    INTERNATIONAL_1924,
+}
+
+// normaliseDatum lowercases the datum name and strips any characters that
+// aren't letters or digits, so that names such as "WGS-84", "wgs_84" and
+// "WGS 84" all resolve to "wgs84".
+func normaliseDatum(datum string) string {
+	var sb strings.Builder
+
+	for _, r := range strings.ToLower(datum) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// Epsg resolves the horizontal datum to an EPSG code for the corresponding
+// geographic CRS. The returned bool is false if the datum is not recognised.
+func (c *Crs) Epsg() (int, bool) {
+	code, ok := geographicEpsg[normaliseDatum(c.Horizontal_Datum)]
+	return code, ok
+}
+
+// Ellipsoid resolves the horizontal datum to its reference ellipsoid.
+// WGS84 is returned along with false if the datum is not recognised.
+func (c *Crs) Ellipsoid() (Ellipsoid, bool) {
+	ellipsoid, ok := datumEllipsoid[normaliseDatum(c.Horizontal_Datum)]
+	if !ok {
+		return WGS84, false
+	}
+
+	return ellipsoid, true
+}
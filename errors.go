@@ -31,3 +31,20 @@ var ErrNewFilt = errors.New("Error Creating TileDB Filter")
 var ErrSetFiltList = errors.New("Error Setting TileDB Filter List")
 var ErrAddAttr = errors.New("Error Adding TileDB Attribute")
 var ErrZstdFilt = errors.New("Error Creating TileDB ZStandard Filter")
+var ErrWriteZarr = errors.New("Error Writing Zarr Array")
+var ErrWriteAttitudeZarr = errors.New("Error Writing Attitude Zarr Group")
+var ErrWriteSvpZarr = errors.New("Error Writing SVP Zarr Group")
+var ErrWriteBdZarr = errors.New("Error Writing Beam Data Zarr Group")
+var ErrProjection = errors.New("Error Defining Map Projection")
+var ErrVerticalReference = errors.New("Error Reducing To Vertical Reference")
+var ErrRayTrace = errors.New("Error Ray Tracing Beams")
+var ErrSvpSelection = errors.New("Error Selecting Sound Velocity Profile")
+var ErrGrid = errors.New("Error Gridding Beam Data")
+var ErrGeoTiff = errors.New("Error Encoding GeoTIFF")
+var ErrMosaic = errors.New("Error Mosaicking Backscatter")
+var ErrAngularResponse = errors.New("Error Computing Angular Response")
+var ErrRejectPolicy = errors.New("Error Applying Reject Policy")
+var ErrSwathSummary = errors.New("Error Computing Swath Summary")
+var ErrSplitHeads = errors.New("Error Splitting Beam Data By Head")
+var ErrS44 = errors.New("Error Assessing S-44 Compliance")
+var ErrCrossline = errors.New("Error Comparing Crosslines")
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	tiledb "github.com/TileDB-Inc/TileDB-Go"
 )
@@ -37,15 +38,45 @@ type Crs struct {
 	Vertical_Datum   string
 }
 
+// PingProcessing contains the optional processing applied to each chunk of
+// pings as they are read, with each step disabled by its zero value.
+// If Attitude is set, the attitude is interpolated at the timestamp of each
+// ping, with gaps in the attitude time series larger than Attitude_tolerance
+// being reported as null.
+// If Svp is set, each ping is associated with a sound velocity profile, and
+// the profiles written contain any positions inferred by the SvpResolver.
+// If Angular_response is set, the backscatter of each ping is aggregated into
+// the angular response curves as the pings are read.
+// If Decode_flags is set, the decoded BeamFlags (BeamFlagAttrs) are written
+// alongside the raw BeamFlags. Reject_policy defines how the beams rejected
+// by their BeamFlags are written.
+// If S44 is set, the S-44 compliance of each beam (S44Attrs) and ping
+// (PingS44) is written, and the per-file compliance is accumulated.
+type PingProcessing struct {
+	Attitude           *Attitude
+	Attitude_tolerance time.Duration
+	Svp                *SvpResolver
+	Angular_response   *AngularResponseBuilder
+	Decode_flags       bool
+	Reject_policy      RejectPolicy
+	S44                *S44Assessor
+}
+
 // GsfFile constains the relevant information for an opened GSF file to enable
 // streamed reading.
+// Georef, Projection and Vertical define the spatial reference of the beams,
+// and Processing the optional processing applied to the pings as they are read.
 type GsfFile struct {
-	Uri      string
-	filesize uint64
-	config   *tiledb.Config
-	ctx      *tiledb.Context
-	vfs      *tiledb.VFS
-	handler  *tiledb.VFSfh
+	Uri        string
+	Georef     GeorefMethod
+	Projection *Projection
+	Vertical   *VerticalReduction
+	Processing PingProcessing
+	filesize   uint64
+	config     *tiledb.Config
+	ctx        *tiledb.Context
+	vfs        *tiledb.VFS
+	handler    *tiledb.VFSfh
 	Stream
 }
 
@@ -189,6 +220,7 @@ type Metadata struct {
 	SubRecord_Counts   map[string]uint64
 	Measurement_Counts map[string]uint64
 	Swath_Summary      SwathBathySummary
+	Attitude_Summary   AttitudeSummary
 }
 
 // Index contains the index information of the GSF file. i.e. the byte locations
@@ -3,12 +3,256 @@ package gsf
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"reflect"
 )
 
+// BeamFlag is the GSF beam flag of a single beam.
+// Bits 0 and 1 define the category of the beam; bit 0 indicates the beam is to
+// be ignored (rejected), and bit 1 indicates the beam is a selected sounding.
+// When neither is set, the beam is accepted and bits 2-7 are informational.
+// For ignored and selected beams, bits 2-7 define the reason for the category.
+type BeamFlag uint8
+
+// The category bits of the BeamFlag.
+const (
+	BEAM_FLAG_IGNORE   BeamFlag = 0x01
+	BEAM_FLAG_SELECTED BeamFlag = 0x02
+)
+
+// The reason bits of an ignored (rejected) BeamFlag.
+const (
+	BEAM_FLAG_IGNORE_MANUAL_EDIT BeamFlag = 0x04
+	BEAM_FLAG_IGNORE_FILTER_EDIT BeamFlag = 0x08
+	BEAM_FLAG_IGNORE_NOT_2X_IHO  BeamFlag = 0x10
+	BEAM_FLAG_IGNORE_NOT_1X_IHO  BeamFlag = 0x20
+	BEAM_FLAG_IGNORE_FOOTPRINT   BeamFlag = 0x40
+	BEAM_FLAG_IGNORE_SPARE       BeamFlag = 0x80
+)
+
+// The reason bits of a selected BeamFlag.
+const (
+	BEAM_FLAG_SELECTED_LEAST_DEPTH   BeamFlag = 0x04
+	BEAM_FLAG_SELECTED_MAXIMUM_DEPTH BeamFlag = 0x08
+	BEAM_FLAG_SELECTED_DESIGNATED    BeamFlag = 0x10
+	BEAM_FLAG_SELECTED_CONTACT       BeamFlag = 0x20
+	BEAM_FLAG_SELECTED_SPARE_1       BeamFlag = 0x40
+	BEAM_FLAG_SELECTED_SPARE_2       BeamFlag = 0x80
+)
+
+// masks for the category and reason bits, with the reason bits starting at bit 2
+const (
+	beam_flag_category_mask    BeamFlag = 0x03
+	beam_flag_reason_mask      BeamFlag = 0xFC
+	beam_flag_first_reason_bit BeamFlag = 0x04
+)
+
+// BeamFlagCategory is the enumeration of the category bits of a BeamFlag.
+type BeamFlagCategory uint8
+
+const (
+	FLAG_ACCEPTED BeamFlagCategory = iota
+	FLAG_IGNORED
+	FLAG_SELECTED
+	FLAG_IGNORED_SELECTED
+)
+
+// BeamFlagCategories maps each BeamFlagCategory to its name.
+var BeamFlagCategories = map[BeamFlagCategory]string{
+	FLAG_ACCEPTED:         "accepted",
+	FLAG_IGNORED:          "ignored",
+	FLAG_SELECTED:         "selected",
+	FLAG_IGNORED_SELECTED: "ignored_selected",
+}
+
+// BeamFlagReason is the enumeration of the reason for the category of a
+// BeamFlag.
+type BeamFlagReason uint8
+
+const (
+	REASON_NONE BeamFlagReason = iota
+	REASON_NULL_BEAM
+	REASON_MANUAL_EDIT
+	REASON_FILTER_EDIT
+	REASON_NOT_2X_IHO
+	REASON_NOT_1X_IHO
+	REASON_FOOTPRINT
+	REASON_IGNORE_SPARE
+	REASON_LEAST_DEPTH
+	REASON_MAXIMUM_DEPTH
+	REASON_DESIGNATED
+	REASON_CONTACT
+	REASON_SELECTED_SPARE_1
+	REASON_SELECTED_SPARE_2
+	REASON_INFO
+)
+
+// BeamFlagReasons maps each BeamFlagReason to its name.
+var BeamFlagReasons = map[BeamFlagReason]string{
+	REASON_NONE:             "none",
+	REASON_NULL_BEAM:        "null_beam",
+	REASON_MANUAL_EDIT:      "manual_edit",
+	REASON_FILTER_EDIT:      "filter_edit",
+	REASON_NOT_2X_IHO:       "not_2x_iho",
+	REASON_NOT_1X_IHO:       "not_1x_iho",
+	REASON_FOOTPRINT:        "footprint_too_big",
+	REASON_IGNORE_SPARE:     "ignore_spare",
+	REASON_LEAST_DEPTH:      "least_depth",
+	REASON_MAXIMUM_DEPTH:    "maximum_depth",
+	REASON_DESIGNATED:       "designated",
+	REASON_CONTACT:          "contact",
+	REASON_SELECTED_SPARE_1: "selected_spare_1",
+	REASON_SELECTED_SPARE_2: "selected_spare_2",
+	REASON_INFO:             "info",
+}
+
+// the reasons for each reason bit (2-7) of the ignore and selected categories
+var (
+	ignoreReasons = [6]BeamFlagReason{
+		REASON_MANUAL_EDIT,
+		REASON_FILTER_EDIT,
+		REASON_NOT_2X_IHO,
+		REASON_NOT_1X_IHO,
+		REASON_FOOTPRINT,
+		REASON_IGNORE_SPARE,
+	}
+	selectedReasons = [6]BeamFlagReason{
+		REASON_LEAST_DEPTH,
+		REASON_MAXIMUM_DEPTH,
+		REASON_DESIGNATED,
+		REASON_CONTACT,
+		REASON_SELECTED_SPARE_1,
+		REASON_SELECTED_SPARE_2,
+	}
+)
+
+// Category returns the category of the beam flag.
+func (bf BeamFlag) Category() BeamFlagCategory {
+	return BeamFlagCategory(bf & beam_flag_category_mask)
+}
+
+// IsRejected returns true if the beam is to be ignored.
+func (bf BeamFlag) IsRejected() bool {
+	return bf&BEAM_FLAG_IGNORE != 0
+}
+
+// IsSelected returns true if the beam is a selected sounding, and has not been
+// rejected.
+func (bf BeamFlag) IsSelected() bool {
+	return bf&beam_flag_category_mask == BEAM_FLAG_SELECTED
+}
+
+// IsManualEdit returns true if the beam was rejected by manual editing.
+func (bf BeamFlag) IsManualEdit() bool {
+	return bf.IsRejected() && bf&BEAM_FLAG_IGNORE_MANUAL_EDIT != 0
+}
+
+// IsFilterEdit returns true if the beam was rejected by a filter.
+func (bf BeamFlag) IsFilterEdit() bool {
+	return bf.IsRejected() && bf&BEAM_FLAG_IGNORE_FILTER_EDIT != 0
+}
+
+// Reasons returns each of the reasons given by the reason bits of the beam
+// flag, ordered from the least significant bit. An ignored beam without any
+// reason bits is a null beam, and an accepted beam with reason bits set is
+// informational only.
+func (bf BeamFlag) Reasons() []BeamFlagReason {
+	reasons := make([]BeamFlagReason, 0)
+
+	if bf&beam_flag_reason_mask == 0 {
+		if bf.IsRejected() {
+			reasons = append(reasons, REASON_NULL_BEAM)
+		}
+		return reasons
+	}
+
+	var lookup [6]BeamFlagReason
+	switch {
+	case bf.IsRejected():
+		lookup = ignoreReasons
+	case bf.IsSelected():
+		lookup = selectedReasons
+	default:
+		return append(reasons, REASON_INFO)
+	}
+
+	for i := range lookup {
+		if bf&(beam_flag_first_reason_bit<<i) != 0 {
+			reasons = append(reasons, lookup[i])
+		}
+	}
+
+	return reasons
+}
+
+// Reason returns the primary reason for the category of the beam flag, being
+// the reason given by the least significant reason bit. REASON_NONE is
+// returned for an accepted beam without any informational bits.
+func (bf BeamFlag) Reason() BeamFlagReason {
+	reasons := bf.Reasons()
+	if len(reasons) == 0 {
+		return REASON_NONE
+	}
+
+	return reasons[0]
+}
+
+// String returns the category and primary reason of the beam flag.
+func (bf BeamFlag) String() string {
+	return BeamFlagCategories[bf.Category()] + ":" + BeamFlagReasons[bf.Reason()]
+}
+
+// BeamFlagAttrs contains the decoded BeamFlags of each beam, written
+// alongside the raw BeamFlags. The boolean attributes are stored as uint8
+// (0 or 1), FlagCategory as a BeamFlagCategory and FlagReason as the primary
+// BeamFlagReason.
+type BeamFlagAttrs struct {
+	FlagRejected   []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	FlagSelected   []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	FlagManualEdit []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	FlagFilterEdit []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	FlagCategory   []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	FlagReason     []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// boolUint8 converts a bool to 0 or 1.
+func boolUint8(value bool) uint8 {
+	if value {
+		return uint8(1)
+	}
+	return uint8(0)
+}
+
+// DecodeBeamFlags decodes the raw beam flags into the BeamFlagAttrs.
+func DecodeBeamFlags(flags []uint8) BeamFlagAttrs {
+	n := len(flags)
+	attrs := BeamFlagAttrs{
+		FlagRejected:   make([]uint8, n),
+		FlagSelected:   make([]uint8, n),
+		FlagManualEdit: make([]uint8, n),
+		FlagFilterEdit: make([]uint8, n),
+		FlagCategory:   make([]uint8, n),
+		FlagReason:     make([]uint8, n),
+	}
+
+	for i, v := range flags {
+		bf := BeamFlag(v)
+		attrs.FlagRejected[i] = boolUint8(bf.IsRejected())
+		attrs.FlagSelected[i] = boolUint8(bf.IsSelected())
+		attrs.FlagManualEdit[i] = boolUint8(bf.IsManualEdit())
+		attrs.FlagFilterEdit[i] = boolUint8(bf.IsFilterEdit())
+		attrs.FlagCategory[i] = uint8(bf.Category())
+		attrs.FlagReason[i] = uint8(bf.Reason())
+	}
+
+	return attrs
+}
+
 // DecodeBeamFlagsArray decodes the beam flags array subrecord.
 // The length of the returned slice is determined by the input
 // number of beams.
-// Each element indicates whether or not the beam contains usable data.
+// Each element indicates whether or not the beam contains usable data,
+// and can be interpreted using the BeamFlag type.
 func DecodeBeamFlagsArray(reader *bytes.Reader, nbeams uint16) []uint8 {
 	var (
 		data []uint8
@@ -20,3 +264,195 @@ func DecodeBeamFlagsArray(reader *bytes.Reader, nbeams uint16) []uint8 {
 
 	return data
 }
+
+// RejectPolicy defines how the beams rejected by their BeamFlags (see
+// BeamFlag.IsRejected) are handled when writing the beam data.
+// REJECT_KEEP writes every beam, REJECT_DROP removes the rejected beams from
+// sparse beam data, and REJECT_NULL writes the rejected beams of dense beam
+// data as nulls using nullable attributes.
+type RejectPolicy string
+
+const (
+	REJECT_KEEP RejectPolicy = "keep"
+	REJECT_DROP RejectPolicy = "drop"
+	REJECT_NULL RejectPolicy = "null"
+)
+
+// RejectPolicies lists the supported RejectPolicy values.
+var RejectPolicies = []RejectPolicy{REJECT_KEEP, REJECT_DROP, REJECT_NULL}
+
+// excludes returns true if the policy excludes the rejected beams from the
+// beam data.
+func (rp RejectPolicy) excludes() bool {
+	return rp == REJECT_DROP || rp == REJECT_NULL
+}
+
+// check validates the policy against the structure of the beam data.
+// Dropping beams is only supported for sparse beam data, and nulling beams
+// only for dense beam data. An empty policy is treated as REJECT_KEEP.
+func (rp RejectPolicy) check(dense_bd bool) error {
+	switch rp {
+	case "", REJECT_KEEP:
+		return nil
+	case REJECT_DROP:
+		if dense_bd {
+			return errors.Join(ErrRejectPolicy, errors.New("Dropping rejected beams requires sparse beam data"))
+		}
+		return nil
+	case REJECT_NULL:
+		if !dense_bd {
+			return errors.Join(ErrRejectPolicy, errors.New("Nulling rejected beams requires dense beam data"))
+		}
+		return nil
+	}
+
+	return errors.Join(ErrRejectPolicy, errors.New("Unsupported reject policy: "+string(rp)))
+}
+
+// PingRejected contains the number of beams of each ping that were rejected
+// by their BeamFlags, and excluded from the beam data by the RejectPolicy.
+type PingRejected struct {
+	Rejected_beams []uint16 `tiledb:"dtype=uint16,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// pingRejected counts the beams of each ping rejected by their BeamFlags.
+// The counts are zero if the BeamFlags don't exist.
+func (pd *PingData) pingRejected() PingRejected {
+	pr := PingRejected{Rejected_beams: make([]uint16, len(pd.Ping_headers.Number_beams))}
+
+	flags := pd.Beam_array.BeamFlags
+	if len(flags) != len(pd.Lon_lat.Longitude) {
+		return pr
+	}
+
+	// only the beams of each ping, excluding any padding
+	for ping, rng := range pd.pingBeamRanges() {
+		for i := rng[0]; i < rng[1]; i++ {
+			if BeamFlag(flags[i]).IsRejected() {
+				pr.Rejected_beams[ping]++
+			}
+		}
+	}
+
+	return pr
+}
+
+// beamValidity constructs the validity of each beam for writing nullable
+// attributes, with beams rejected by their BeamFlags being invalid (zero).
+func (pd *PingData) beamValidity() []uint8 {
+	validity := make([]uint8, len(pd.Lon_lat.Longitude))
+	has_flags := len(pd.Beam_array.BeamFlags) == len(validity)
+
+	for i := range validity {
+		validity[i] = uint8(1)
+		if has_flags && BeamFlag(pd.Beam_array.BeamFlags[i]).IsRejected() {
+			validity[i] = uint8(0)
+		}
+	}
+
+	return validity
+}
+
+// filterBeams retains the elements of a per beam slice where keep is true.
+func filterBeams[T any](s []T, keep []bool) []T {
+	filtered := make([]T, 0, len(s))
+	for i, v := range s {
+		if keep[i] {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// filterBeamFields retains the elements of each per beam slice field of the
+// struct t (a pointer), where keep is true. Fields whose length doesn't match
+// the number of beams (i.e. unpopulated) are left as is.
+func filterBeamFields(t any, keep []bool) {
+	values := reflect.ValueOf(t).Elem()
+	for i := 0; i < values.NumField(); i++ {
+		fld := values.Field(i)
+		if !fld.CanSet() || fld.Kind() != reflect.Slice || fld.Len() != len(keep) {
+			continue
+		}
+
+		filtered := reflect.MakeSlice(fld.Type(), 0, fld.Len())
+		for j := 0; j < fld.Len(); j++ {
+			if keep[j] {
+				filtered = reflect.Append(filtered, fld.Index(j))
+			}
+		}
+		fld.Set(filtered)
+	}
+}
+
+// selectBeams retains the beams of the beam data, where keep is true;
+// BeamArray, LonLat, EastingNorthing, BrbIntensity, BeamFlagAttrs and S44Attrs.
+// New slices are constructed, so the beam data of a shallow copy of a
+// PingData can be selected without modifying the original.
+func (pd *PingData) selectBeams(keep []bool) {
+	nbeams := len(keep)
+
+	// the time series is variable length, so is handled separately using the
+	// offsets of each beam's samples
+	brb := &pd.Brb_intensity
+	offsets := beamSamples(brb, nbeams)
+	if offsets != nil {
+		series := make([]float64, 0, len(brb.TimeSeries))
+		for i := range keep {
+			if keep[i] {
+				series = append(series, brb.TimeSeries[offsets[i]:offsets[i+1]]...)
+			}
+		}
+		brb.TimeSeries = series
+		brb.BottomDetectIndex = filterBeams(brb.BottomDetectIndex, keep)
+		brb.StartRange = filterBeams(brb.StartRange, keep)
+		brb.TsMean = filterBeams(brb.TsMean, keep)
+		brb.sample_count = filterBeams(brb.sample_count, keep)
+	}
+
+	filterBeamFields(&pd.Beam_array, keep)
+	filterBeamFields(&pd.Lon_lat, keep)
+	filterBeamFields(&pd.Easting_northing, keep)
+	filterBeamFields(&pd.Beam_flags, keep)
+	filterBeamFields(&pd.Beam_s44, keep)
+}
+
+// dropRejected removes the beams rejected by their BeamFlags from the beam
+// data; BeamArray, LonLat, EastingNorthing, BrbIntensity, BeamFlagAttrs and
+// S44Attrs.
+// The ping and beam numbers of the retained beams are returned.
+// The PingData is left as is if the BeamFlags don't exist.
+func (pd *PingData) dropRejected(ping_beam_ids *PingBeamNumbers) *PingBeamNumbers {
+	nbeams := len(pd.Lon_lat.Longitude)
+	if len(pd.Beam_array.BeamFlags) != nbeams || len(ping_beam_ids.PingNumber) != nbeams {
+		return ping_beam_ids
+	}
+
+	keep := make([]bool, nbeams)
+	nkeep := 0
+	for i, flag := range pd.Beam_array.BeamFlags {
+		keep[i] = !BeamFlag(flag).IsRejected()
+		if keep[i] {
+			nkeep++
+		}
+	}
+
+	if nkeep == nbeams {
+		return ping_beam_ids
+	}
+
+	return pd.retainBeams(keep, ping_beam_ids)
+}
+
+// retainBeams retains the beams of the beam data where keep is true, and
+// returns the ping and beam numbers of the retained beams.
+func (pd *PingData) retainBeams(keep []bool, ping_beam_ids *PingBeamNumbers) *PingBeamNumbers {
+	pd.selectBeams(keep)
+
+	retained := PingBeamNumbers{
+		PingNumber: filterBeams(ping_beam_ids.PingNumber, keep),
+		BeamNumber: filterBeams(ping_beam_ids.BeamNumber, keep),
+	}
+
+	return &retained
+}
@@ -0,0 +1,86 @@
+package gsf
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestBeamFlag checks the category and reasons decoded from the beam flags,
+// and that DecodeBeamFlags agrees with the BeamFlag methods.
+func TestBeamFlag(t *testing.T) {
+	tests := []struct {
+		name        string
+		flag        uint8
+		category    BeamFlagCategory
+		reasons     []BeamFlagReason
+		rejected    bool
+		selected    bool
+		manual_edit bool
+		filter_edit bool
+		str         string
+	}{
+		{"accepted", 0x00, FLAG_ACCEPTED, []BeamFlagReason{}, false, false, false, false, "accepted:none"},
+		{"null beam", 0x01, FLAG_IGNORED, []BeamFlagReason{REASON_NULL_BEAM}, true, false, false, false, "ignored:null_beam"},
+		{"manual edit", 0x05, FLAG_IGNORED, []BeamFlagReason{REASON_MANUAL_EDIT}, true, false, true, false, "ignored:manual_edit"},
+		{"filter edit", 0x09, FLAG_IGNORED, []BeamFlagReason{REASON_FILTER_EDIT}, true, false, false, true, "ignored:filter_edit"},
+		{"manual and filter edit", 0x0D, FLAG_IGNORED, []BeamFlagReason{REASON_MANUAL_EDIT, REASON_FILTER_EDIT}, true, false, true, true, "ignored:manual_edit"},
+		{"not 1x iho", 0x21, FLAG_IGNORED, []BeamFlagReason{REASON_NOT_1X_IHO}, true, false, false, false, "ignored:not_1x_iho"},
+		{"least depth", 0x02 | 0x04, FLAG_SELECTED, []BeamFlagReason{REASON_LEAST_DEPTH}, false, true, false, false, "selected:least_depth"},
+		{"least depth and designated", 0x16, FLAG_SELECTED, []BeamFlagReason{REASON_LEAST_DEPTH, REASON_DESIGNATED}, false, true, false, false, "selected:least_depth"},
+		{"ignored and selected", 0x03, FLAG_IGNORED_SELECTED, []BeamFlagReason{REASON_NULL_BEAM}, true, false, false, false, "ignored_selected:null_beam"},
+		{"ignored and selected manual edit", 0x07, FLAG_IGNORED_SELECTED, []BeamFlagReason{REASON_MANUAL_EDIT}, true, false, true, false, "ignored_selected:manual_edit"},
+		{"accepted with info", 0x10, FLAG_ACCEPTED, []BeamFlagReason{REASON_INFO}, false, false, false, false, "accepted:info"},
+	}
+
+	flags := make([]uint8, len(tests))
+	for i, test := range tests {
+		flags[i] = test.flag
+	}
+	attrs := DecodeBeamFlags(flags)
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bf := BeamFlag(test.flag)
+
+			if bf.Category() != test.category {
+				t.Errorf("category: got %v, want %v", bf.Category(), test.category)
+			}
+			if reasons := bf.Reasons(); !reflect.DeepEqual(reasons, test.reasons) {
+				t.Errorf("reasons: got %v, want %v", reasons, test.reasons)
+			}
+			if bf.IsRejected() != test.rejected || bf.IsSelected() != test.selected {
+				t.Errorf("rejected, selected: got (%v, %v), want (%v, %v)", bf.IsRejected(), bf.IsSelected(), test.rejected, test.selected)
+			}
+			if bf.IsManualEdit() != test.manual_edit || bf.IsFilterEdit() != test.filter_edit {
+				t.Errorf("manual, filter edit: got (%v, %v), want (%v, %v)", bf.IsManualEdit(), bf.IsFilterEdit(), test.manual_edit, test.filter_edit)
+			}
+			if bf.String() != test.str {
+				t.Errorf("string: got %q, want %q", bf.String(), test.str)
+			}
+
+			reason := REASON_NONE
+			if len(test.reasons) > 0 {
+				reason = test.reasons[0]
+			}
+			want := [6]uint8{
+				boolUint8(test.rejected),
+				boolUint8(test.selected),
+				boolUint8(test.manual_edit),
+				boolUint8(test.filter_edit),
+				uint8(test.category),
+				uint8(reason),
+			}
+			got := [6]uint8{
+				attrs.FlagRejected[i],
+				attrs.FlagSelected[i],
+				attrs.FlagManualEdit[i],
+				attrs.FlagFilterEdit[i],
+				attrs.FlagCategory[i],
+				attrs.FlagReason[i],
+			}
+			if got != want {
+				t.Errorf("decoded attributes: got %v, want %v", got, want)
+			}
+		})
+	}
+}
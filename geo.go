@@ -49,6 +49,14 @@ type XY struct {
 	Y []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
 }
 
+// LonLatAttrs is purely for shortcutting the attribute creation of longitude and
+// latitude attributes when the sparse beam array uses projected coordinates as
+// the dimensional axes.
+type LonLatAttrs struct {
+	Longitude []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+	Latitude  []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+}
+
 // BeamsLonLat calculates arrays of longitude and latitude of len(along_track).
 // Most likely the func will change; potentially a method for ping data, header or GeoCoefficients.
 // For formulae details: https://gis.stackexchange.com/questions/75528/understanding-terms-in-length-of-degree-formula
@@ -95,3 +103,150 @@ func (ba *BeamArray) BeamsLonLat(lon, lat float64, heading float32, coef *GeoCoe
 
 	return lonlat
 }
+
+// GeorefMethod identifies the method used to georeference the beams, i.e.
+// converting the across track and along track distances to longitude and
+// latitude coordinates.
+type GeorefMethod uint8
+
+const (
+	// GEOREF_SERIES uses the series expansion of the metres per degree of
+	// longitude and latitude given by GeoCoefficients (WGS84 only).
+	GEOREF_SERIES GeorefMethod = iota
+
+	// GEOREF_GEODESIC solves the direct geodesic problem on the ellipsoid
+	// of the horizontal datum.
+	GEOREF_GEODESIC
+)
+
+// Ellipsoid defines a reference ellipsoid by its semi-major axis (metres) and
+// flattening.
+type Ellipsoid struct {
+	Name       string
+	A          float64
+	Flattening float64
+}
+
+var (
+	WGS84              = Ellipsoid{"WGS 84", 6378137.0, 1.0 / 298.257223563}
+	GRS80              = Ellipsoid{"GRS 1980", 6378137.0, 1.0 / 298.257222101}
+	WGS72              = Ellipsoid{"WGS 72", 6378135.0, 1.0 / 298.26}
+	INTERNATIONAL_1924 = Ellipsoid{"International 1924", 6378388.0, 1.0 / 297.0}
+	CLARKE_1866        = Ellipsoid{"Clarke 1866", 6378206.4, 1.0 / 294.978698214}
+)
+
+// Direct solves the direct geodesic problem using Vincenty's formulae.
+// Given a starting longitude and latitude (degrees), an azimuth (degrees
+// clockwise from north) and a distance (metres), the longitude and latitude
+// of the end point are returned.
+// See https://en.wikipedia.org/wiki/Vincenty%27s_formulae for more information.
+func (e *Ellipsoid) Direct(lon, lat, azimuth, distance float64) (float64, float64) {
+	var (
+		sin_sigma   float64
+		cos_sigma   float64
+		cos_2sigmam float64
+	)
+
+	deg2rad := math.Pi / 180.0
+	f := e.Flattening
+	b := e.A * (1.0 - f)
+
+	alpha1 := deg2rad * azimuth
+	sin_alpha1 := math.Sin(alpha1)
+	cos_alpha1 := math.Cos(alpha1)
+
+	// reduced latitude
+	tan_u1 := (1.0 - f) * math.Tan(deg2rad*lat)
+	cos_u1 := 1.0 / math.Sqrt(1.0+tan_u1*tan_u1)
+	sin_u1 := tan_u1 * cos_u1
+
+	sigma1 := math.Atan2(tan_u1, cos_alpha1)
+	sin_alpha := cos_u1 * sin_alpha1
+	cos2_alpha := 1.0 - sin_alpha*sin_alpha
+	u2 := cos2_alpha * (e.A*e.A - b*b) / (b * b)
+
+	coef_a := 1.0 + u2/16384.0*(4096.0+u2*(-768.0+u2*(320.0-175.0*u2)))
+	coef_b := u2 / 1024.0 * (256.0 + u2*(-128.0+u2*(74.0-47.0*u2)))
+
+	// iterate until the change in sigma is negligible (~0.006mm)
+	sigma := distance / (b * coef_a)
+	for i := 0; i < 100; i++ {
+		cos_2sigmam = math.Cos(2.0*sigma1 + sigma)
+		sin_sigma = math.Sin(sigma)
+		cos_sigma = math.Cos(sigma)
+
+		delta_sigma := coef_b * sin_sigma * (cos_2sigmam + coef_b/4.0*(cos_sigma*(-1.0+2.0*cos_2sigmam*cos_2sigmam)-
+			coef_b/6.0*cos_2sigmam*(-3.0+4.0*sin_sigma*sin_sigma)*(-3.0+4.0*cos_2sigmam*cos_2sigmam)))
+
+		prev := sigma
+		sigma = distance/(b*coef_a) + delta_sigma
+		if math.Abs(sigma-prev) < 1e-12 {
+			break
+		}
+	}
+
+	cos_2sigmam = math.Cos(2.0*sigma1 + sigma)
+	sin_sigma = math.Sin(sigma)
+	cos_sigma = math.Cos(sigma)
+
+	x := sin_u1*sin_sigma - cos_u1*cos_sigma*cos_alpha1
+	lat2 := math.Atan2(
+		sin_u1*cos_sigma+cos_u1*sin_sigma*cos_alpha1,
+		(1.0-f)*math.Sqrt(sin_alpha*sin_alpha+x*x),
+	)
+
+	lambda := math.Atan2(sin_sigma*sin_alpha1, cos_u1*cos_sigma-sin_u1*sin_sigma*cos_alpha1)
+	c := f / 16.0 * cos2_alpha * (4.0 + f*(4.0-3.0*cos2_alpha))
+	l := lambda - (1.0-c)*f*sin_alpha*(sigma+c*sin_sigma*(cos_2sigmam+c*cos_sigma*(-1.0+2.0*cos_2sigmam*cos_2sigmam)))
+
+	// normalise to [-180, 180)
+	lon2 := math.Mod(lon+l/deg2rad+540.0, 360.0) - 180.0
+
+	return lon2, lat2 / deg2rad
+}
+
+// BeamsLonLatGeodesic calculates arrays of longitude and latitude of len(along_track)
+// by solving the direct geodesic problem on the supplied ellipsoid for each beam.
+// The across track distance is positive to starboard, and the along track distance
+// is positive forward, relative to the vessel heading.
+// Unlike BeamsLonLat, this method remains accurate for wide swaths at high latitudes
+// and for datums other than WGS84.
+func (ba *BeamArray) BeamsLonLatGeodesic(lon, lat float64, heading float32, ellipsoid *Ellipsoid) LonLat {
+	var lonlat LonLat
+
+	rad2deg := 180.0 / math.Pi
+
+	n := len(ba.AlongTrack)
+	lon2 := make([]float64, n)
+	lat2 := make([]float64, n)
+
+	for i := 0; i < n; i++ {
+		acr_trck := ba.AcrossTrack[i]
+		aln_trck := ba.AlongTrack[i]
+		distance := math.Hypot(acr_trck, aln_trck)
+		azimuth := float64(heading) + rad2deg*math.Atan2(acr_trck, aln_trck)
+		lon2[i], lat2[i] = ellipsoid.Direct(lon, lat, azimuth, distance)
+	}
+
+	lonlat.Longitude = lon2
+	lonlat.Latitude = lat2
+
+	return lonlat
+}
+
+// EARTH_MEAN_RADIUS is the mean radius (metres) of the WGS84 ellipsoid.
+const EARTH_MEAN_RADIUS = 6371008.8
+
+// GreatCircleDistance calculates the distance (metres) between two points on
+// a sphere of EARTH_MEAN_RADIUS using the haversine formula.
+// Intended for where an approximate distance is sufficient, such as finding
+// the nearest of a set of locations.
+func GreatCircleDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	deg2rad := math.Pi / 180.0
+	dlon := (lon2 - lon1) * deg2rad
+	dlat := (lat2 - lat1) * deg2rad
+
+	a := math.Pow(math.Sin(dlat/2.0), 2) + math.Cos(lat1*deg2rad)*math.Cos(lat2*deg2rad)*math.Pow(math.Sin(dlon/2.0), 2)
+
+	return 2.0 * EARTH_MEAN_RADIUS * math.Asin(math.Min(1.0, math.Sqrt(a)))
+}
@@ -0,0 +1,153 @@
+package gsf
+
+import (
+	"math"
+	"testing"
+)
+
+// dms converts degrees, minutes and seconds to decimal degrees, with the
+// sign given by the degrees.
+func dms(degrees, minutes, seconds float64) float64 {
+	if math.Signbit(degrees) {
+		return degrees - minutes/60.0 - seconds/3600.0
+	}
+	return degrees + minutes/60.0 + seconds/3600.0
+}
+
+// TestDirect checks the direct geodesic solution against published reference
+// values; the Geoscience Australia Flinders Peak to Buninyong example (GRS80),
+// and test lines (b) and (c) from Vincenty (1975) on the International 1924
+// (Hayford) ellipsoid. The tolerance of 1e-4 arc seconds is ~3mm.
+func TestDirect(t *testing.T) {
+	tests := []struct {
+		name      string
+		ellipsoid Ellipsoid
+		lon, lat  float64
+		azimuth   float64
+		distance  float64
+		lon2      float64
+		lat2      float64
+	}{
+		{
+			name:      "flinders peak to buninyong",
+			ellipsoid: GRS80,
+			lon:       dms(144, 25, 29.52440),
+			lat:       dms(-37, 57, 3.72030),
+			azimuth:   dms(306, 52, 5.37),
+			distance:  54972.271,
+			lon2:      dms(143, 55, 35.38390),
+			lat2:      dms(-37, 39, 10.15610),
+		},
+		{
+			name:      "vincenty line b",
+			ellipsoid: INTERNATIONAL_1924,
+			lon:       0.0,
+			lat:       dms(37, 19, 54.95367),
+			azimuth:   dms(95, 27, 59.63089),
+			distance:  4085966.703,
+			lon2:      dms(41, 28, 35.50729),
+			lat2:      dms(26, 7, 42.83946),
+		},
+		{
+			name:      "vincenty line c",
+			ellipsoid: INTERNATIONAL_1924,
+			lon:       0.0,
+			lat:       dms(35, 16, 11.24862),
+			azimuth:   dms(15, 44, 23.74850),
+			distance:  8084823.839,
+			lon2:      dms(137, 47, 28.31435),
+			lat2:      dms(67, 22, 14.77638),
+		},
+	}
+
+	tolerance := 1e-4 / 3600.0
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lon2, lat2 := tt.ellipsoid.Direct(tt.lon, tt.lat, tt.azimuth, tt.distance)
+			if math.Abs(lon2-tt.lon2) > tolerance || math.Abs(lat2-tt.lat2) > tolerance {
+				t.Errorf("Direct() = (%.9f, %.9f), want (%.9f, %.9f)", lon2, lat2, tt.lon2, tt.lat2)
+			}
+		})
+	}
+}
+
+// TestDirectEllipsoid checks that the ellipsoid is honoured, by solving a
+// Vincenty (1975) International 1924 test line on WGS84 instead, which
+// should displace the end point by several arc seconds.
+func TestDirectEllipsoid(t *testing.T) {
+	lat := dms(37, 19, 54.95367)
+	azimuth := dms(95, 27, 59.63089)
+	distance := 4085966.703
+
+	lon_int, lat_int := INTERNATIONAL_1924.Direct(0.0, lat, azimuth, distance)
+	lon_wgs, lat_wgs := WGS84.Direct(0.0, lat, azimuth, distance)
+
+	shift := GreatCircleDistance(lon_int, lat_int, lon_wgs, lat_wgs)
+	if shift < 10.0 {
+		t.Errorf("expected the end points to differ between ellipsoids, got %.3fm", shift)
+	}
+}
+
+// TestBeamsLonLatGeodesic compares the geodesic georeferencing against the
+// series expansion used by BeamsLonLat. The two agree closely for narrow
+// swaths, and diverge as the swath widens and the latitude increases.
+func TestBeamsLonLatGeodesic(t *testing.T) {
+	coef := NewCoefWgs84()
+	lon := 145.0
+	heading := float32(30.0)
+
+	latitudes := []float64{0.0, 30.0, 60.0, 75.0}
+	widths := []float64{100.0, 1000.0, 5000.0}
+
+	prev_lat := make([]float64, len(widths))
+
+	for _, lat := range latitudes {
+		prev_width := 0.0
+
+		for j, width := range widths {
+			ba := BeamArray{
+				AcrossTrack: []float64{-width, 0.0, width, width},
+				AlongTrack:  []float64{0.0, 0.0, 0.0, width / 10.0},
+			}
+
+			series := ba.BeamsLonLat(lon, lat, heading, coef)
+			geodesic := ba.BeamsLonLatGeodesic(lon, lat, heading, &WGS84)
+
+			diff := 0.0
+			for i := range series.Longitude {
+				d := GreatCircleDistance(series.Longitude[i], series.Latitude[i], geodesic.Longitude[i], geodesic.Latitude[i])
+				diff = math.Max(diff, d)
+			}
+
+			if width <= 100.0 && diff > 0.01 {
+				t.Errorf("lat %v, width %v: difference of %.4fm exceeds 1cm", lat, width, diff)
+			}
+
+			if diff/width > 2e-3 {
+				t.Errorf("lat %v, width %v: relative difference of %.2e exceeds 2e-3", lat, width, diff/width)
+			}
+
+			if diff < prev_width {
+				t.Errorf("lat %v, width %v: difference of %.4fm is smaller than for a narrower swath", lat, width, diff)
+			}
+			prev_width = diff
+
+			if lat > 0.0 && diff < prev_lat[j] {
+				t.Errorf("lat %v, width %v: difference of %.4fm is smaller than at a lower latitude", lat, width, diff)
+			}
+			prev_lat[j] = diff
+		}
+	}
+}
+
+// TestBeamsLonLatGeodesicNadir checks that a beam with no across or along
+// track offset is located at the ping position.
+func TestBeamsLonLatGeodesicNadir(t *testing.T) {
+	ba := BeamArray{AcrossTrack: []float64{0.0}, AlongTrack: []float64{0.0}}
+
+	lonlat := ba.BeamsLonLatGeodesic(-70.5, -45.25, 123.0, &CLARKE_1866)
+	if math.Abs(lonlat.Longitude[0]+70.5) > 1e-12 || math.Abs(lonlat.Latitude[0]+45.25) > 1e-12 {
+		t.Errorf("nadir beam = (%v, %v), want (-70.5, -45.25)", lonlat.Longitude[0], lonlat.Latitude[0])
+	}
+}
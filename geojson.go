@@ -0,0 +1,75 @@
+package gsf
+
+// GeoJsonGeometry is a minimal representation of a GeoJSON geometry object.
+// Coordinates are ordered as [longitude, latitude] as per RFC 7946.
+type GeoJsonGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// GeoJsonFeature is a minimal representation of a GeoJSON feature object.
+// A nil Geometry is serialised as null, which is valid for features that have
+// no spatial extent (such as a file with no valid pings).
+type GeoJsonFeature struct {
+	Type       string           `json:"type"`
+	Geometry   *GeoJsonGeometry `json:"geometry"`
+	Properties map[string]any   `json:"properties"`
+}
+
+// GeoJsonFeatureCollection is a minimal representation of a GeoJSON
+// feature collection.
+type GeoJsonFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJsonFeature `json:"features"`
+}
+
+// coordinates restructures the LonLat type into a slice of [lon, lat] pairs.
+func (ll *LonLat) coordinates() [][]float64 {
+	coords := make([][]float64, len(ll.Longitude))
+	for i := range ll.Longitude {
+		coords[i] = []float64{ll.Longitude[i], ll.Latitude[i]}
+	}
+
+	return coords
+}
+
+// properties constructs the attributes that are common to each feature.
+func (sc *SwathCoverage) properties(feature string) map[string]any {
+	return map[string]any{
+		"feature":        feature,
+		"line_name":      sc.Line_name,
+		"start_datetime": sc.Start_datetime,
+		"end_datetime":   sc.End_datetime,
+	}
+}
+
+// TracklineGeometry returns the trackline as a GeoJSON LineString. Nil is
+// returned if the trackline contains less than two vertices.
+func (sc *SwathCoverage) TracklineGeometry() *GeoJsonGeometry {
+	if len(sc.Trackline.Longitude) < 2 {
+		return nil
+	}
+
+	return &GeoJsonGeometry{Type: "LineString", Coordinates: sc.Trackline.coordinates()}
+}
+
+// FootprintGeometry returns the swath footprint as a GeoJSON Polygon. Nil is
+// returned if no footprint could be constructed.
+func (sc *SwathCoverage) FootprintGeometry() *GeoJsonGeometry {
+	if len(sc.Footprint.Longitude) < 4 {
+		return nil
+	}
+
+	return &GeoJsonGeometry{Type: "Polygon", Coordinates: [][][]float64{sc.Footprint.coordinates()}}
+}
+
+// GeoJson constructs a GeoJSON FeatureCollection containing two features;
+// the vessel trackline and the swath footprint.
+func (sc *SwathCoverage) GeoJson() GeoJsonFeatureCollection {
+	features := []GeoJsonFeature{
+		{Type: "Feature", Geometry: sc.TracklineGeometry(), Properties: sc.properties("trackline")},
+		{Type: "Feature", Geometry: sc.FootprintGeometry(), Properties: sc.properties("footprint")},
+	}
+
+	return GeoJsonFeatureCollection{Type: "FeatureCollection", Features: features}
+}
@@ -0,0 +1,406 @@
+package gsf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TiffCompression identifies the compression scheme of the GeoTIFF strips.
+type TiffCompression uint16
+
+const (
+	TIFF_COMPRESSION_NONE    TiffCompression = 1
+	TIFF_COMPRESSION_DEFLATE TiffCompression = 8
+	TIFF_COMPRESSION_ZSTD    TiffCompression = 50000
+)
+
+// TiffCompressions maps the compression names to the TiffCompression.
+var TiffCompressions = map[string]TiffCompression{
+	"none":    TIFF_COMPRESSION_NONE,
+	"deflate": TIFF_COMPRESSION_DEFLATE,
+	"zstd":    TIFF_COMPRESSION_ZSTD,
+}
+
+// TIFF field types
+const (
+	tiffAscii  uint16 = 2
+	tiffShort  uint16 = 3
+	tiffLong   uint16 = 4
+	tiffDouble uint16 = 12
+)
+
+// GeoKey values used in describing the CRS.
+const (
+	geoKeyUserDefined     uint16 = 32767
+	geoModelProjected     uint16 = 1
+	geoModelGeographic    uint16 = 2
+	geoRasterPixelIsArea  uint16 = 1
+	geoAngularDegree      uint16 = 9102
+	geoLinearMetre        uint16 = 9001
+	geoCtTransverse       uint16 = 1
+	geoCtLambertConfConic uint16 = 8
+)
+
+// GeoTIFF tag locations for GeoKeys whose values are not stored in place.
+const (
+	tagGeoKeyDirectory uint16 = 34735
+	tagGeoDoubleParams uint16 = 34736
+	tagGeoAsciiParams  uint16 = 34737
+)
+
+// strip size target (bytes, prior to compression)
+const tiffStripSize = 65536
+
+// GeoTiff is a single or multi-band Float32 raster, georeferenced by the
+// outer corner of the north-west pixel (X_origin, Y_origin) and the pixel
+// size (Resolution), in the units of the CRS.
+// If Projection is nil, the CRS is the geographic CRS of the horizontal datum
+// given by Crs, otherwise the CRS is the Projection.
+// Each band is stored in row-major order, with the first row being the
+// northern most row, and pixels equal to Nodata (or NaN) represent no data.
+type GeoTiff struct {
+	Columns     uint64
+	Rows        uint64
+	X_origin    float64
+	Y_origin    float64
+	Resolution  float64
+	Crs         Crs
+	Projection  *Projection
+	Nodata      float64
+	Compression TiffCompression
+	Band_names  []string
+	Bands       [][]float32
+}
+
+// tiffEntry is a single IFD entry, with the value(s) already encoded.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func shortEntry(tag uint16, values ...uint16) tiffEntry {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(data[2*i:], v)
+	}
+	return tiffEntry{tag, tiffShort, uint32(len(values)), data}
+}
+
+func longEntry(tag uint16, values ...uint32) tiffEntry {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], v)
+	}
+	return tiffEntry{tag, tiffLong, uint32(len(values)), data}
+}
+
+func doubleEntry(tag uint16, values ...float64) tiffEntry {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+	}
+	return tiffEntry{tag, tiffDouble, uint32(len(values)), data}
+}
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	data := append([]byte(value), 0)
+	return tiffEntry{tag, tiffAscii, uint32(len(data)), data}
+}
+
+// geoKeys accumulates the GeoKey directory along with the double and ascii
+// parameters referenced by the directory.
+type geoKeys struct {
+	keys    map[uint16][3]uint16
+	doubles []float64
+	ascii   strings.Builder
+}
+
+func (gk *geoKeys) short(key, value uint16) {
+	gk.keys[key] = [3]uint16{0, 1, value}
+}
+
+func (gk *geoKeys) double(key uint16, value float64) {
+	gk.keys[key] = [3]uint16{tagGeoDoubleParams, 1, uint16(len(gk.doubles))}
+	gk.doubles = append(gk.doubles, value)
+}
+
+func (gk *geoKeys) text(key uint16, value string) {
+	// ascii params are delimited by a pipe
+	value = value + "|"
+	gk.keys[key] = [3]uint16{tagGeoAsciiParams, uint16(len(value)), uint16(gk.ascii.Len())}
+	gk.ascii.WriteString(value)
+}
+
+// directory encodes the GeoKey directory, with the keys sorted by id.
+func (gk *geoKeys) directory() []uint16 {
+	ids := make([]int, 0, len(gk.keys))
+	for id := range gk.keys {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	dir := []uint16{1, 1, 0, uint16(len(ids))}
+	for _, id := range ids {
+		entry := gk.keys[uint16(id)]
+		dir = append(dir, uint16(id), entry[0], entry[1], entry[2])
+	}
+
+	return dir
+}
+
+// ellipsoidKeys describes a user defined geographic CRS from its ellipsoid.
+func (gk *geoKeys) ellipsoidKeys(ellipsoid *Ellipsoid) {
+	gk.short(2048, geoKeyUserDefined)         // GeographicTypeGeoKey
+	gk.text(2049, ellipsoid.Name)             // GeogCitationGeoKey
+	gk.short(2050, geoKeyUserDefined)         // GeogGeodeticDatumGeoKey
+	gk.short(2054, geoAngularDegree)          // GeogAngularUnitsGeoKey
+	gk.short(2056, geoKeyUserDefined)         // GeogEllipsoidGeoKey
+	gk.double(2057, ellipsoid.A)              // GeogSemiMajorAxisGeoKey
+	gk.double(2059, 1.0/ellipsoid.Flattening) // GeogInvFlatteningGeoKey
+}
+
+// geoKeys constructs the GeoKeys describing the CRS of the GeoTiff.
+// EPSG codes are used where known, otherwise the CRS is user defined.
+func (gt *GeoTiff) geoKeys() *geoKeys {
+	gk := geoKeys{keys: make(map[uint16][3]uint16)}
+	gk.short(1025, geoRasterPixelIsArea) // GTRasterTypeGeoKey
+
+	if gt.Projection == nil {
+		gk.short(1024, geoModelGeographic) // GTModelTypeGeoKey
+		epsg, ok := gt.Crs.Epsg()
+		if ok {
+			gk.short(2048, uint16(epsg)) // GeographicTypeGeoKey
+		} else {
+			ellipsoid, _ := gt.Crs.Ellipsoid()
+			gk.ellipsoidKeys(&ellipsoid)
+		}
+		return &gk
+	}
+
+	proj := gt.Projection
+	gk.short(1024, geoModelProjected) // GTModelTypeGeoKey
+	if proj.Epsg > 0 {
+		gk.short(3072, uint16(proj.Epsg)) // ProjectedCSTypeGeoKey
+		return &gk
+	}
+
+	gk.ellipsoidKeys(&proj.Ellipsoid)
+	gk.short(3072, geoKeyUserDefined) // ProjectedCSTypeGeoKey
+	gk.text(3073, proj.Definition)    // PCSCitationGeoKey
+	gk.short(3074, geoKeyUserDefined) // ProjectionGeoKey
+	gk.short(3076, geoLinearMetre)    // ProjLinearUnitsGeoKey
+
+	switch proj.Name {
+	case "lcc":
+		gk.short(3075, geoCtLambertConfConic) // ProjCoordTransGeoKey
+		gk.double(3078, proj.Lat_1)           // ProjStdParallel1GeoKey
+		gk.double(3079, proj.Lat_2)           // ProjStdParallel2GeoKey
+		gk.double(3084, proj.Lon_0)           // ProjFalseOriginLongGeoKey
+		gk.double(3085, proj.Lat_0)           // ProjFalseOriginLatGeoKey
+		gk.double(3086, proj.X_0)             // ProjFalseOriginEastingGeoKey
+		gk.double(3087, proj.Y_0)             // ProjFalseOriginNorthingGeoKey
+	default:
+		// utm and tmerc
+		gk.short(3075, geoCtTransverse) // ProjCoordTransGeoKey
+		gk.double(3080, proj.Lon_0)     // ProjNatOriginLongGeoKey
+		gk.double(3081, proj.Lat_0)     // ProjNatOriginLatGeoKey
+		gk.double(3082, proj.X_0)       // ProjFalseEastingGeoKey
+		gk.double(3083, proj.Y_0)       // ProjFalseNorthingGeoKey
+		gk.double(3092, proj.K_0)       // ProjScaleAtNatOriginGeoKey
+	}
+
+	return &gk
+}
+
+// gdalMetadata constructs the GDAL_METADATA XML containing the band names.
+func (gt *GeoTiff) gdalMetadata() string {
+	var sb strings.Builder
+
+	sb.WriteString("<GDALMetadata>\n")
+	for i, name := range gt.Band_names {
+		sb.WriteString(`  <Item name="DESCRIPTION" sample="` + strconv.Itoa(i) + `" role="description">`)
+		_ = xml.EscapeText(&sb, []byte(name))
+		sb.WriteString("</Item>\n")
+	}
+	sb.WriteString("</GDALMetadata>")
+
+	return sb.String()
+}
+
+// compress compresses a strip using the compression scheme of the GeoTiff.
+func (gt *GeoTiff) compress(strip []byte) ([]byte, error) {
+	switch gt.Compression {
+	case TIFF_COMPRESSION_NONE:
+		return strip, nil
+	case TIFF_COMPRESSION_DEFLATE:
+		var buf bytes.Buffer
+		zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		_, err = zw.Write(strip)
+		if err != nil {
+			return nil, err
+		}
+		err = zw.Close()
+		return buf.Bytes(), err
+	case TIFF_COMPRESSION_ZSTD:
+		encoder, err := newZstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(strip, nil), nil
+	}
+
+	return nil, errors.New("Unsupported TIFF compression: " + strconv.Itoa(int(gt.Compression)))
+}
+
+// Encode serialises the GeoTiff as a little-endian classic TIFF, using
+// separate planes for each band, and strips of rows.
+func (gt *GeoTiff) Encode() ([]byte, error) {
+	nbands := len(gt.Bands)
+	npixels := gt.Columns * gt.Rows
+	if nbands == 0 || npixels == 0 {
+		return nil, errors.Join(ErrGeoTiff, errors.New("GeoTiff requires at least one band and pixel"))
+	}
+	for _, band := range gt.Bands {
+		if uint64(len(band)) != npixels {
+			return nil, errors.Join(ErrGeoTiff, errors.New("Band length does not match the raster dimensions"))
+		}
+	}
+
+	row_bytes := gt.Columns * 4
+	rows_per_strip := uint64(math.Max(1.0, math.Floor(float64(tiffStripSize)/float64(row_bytes))))
+	if rows_per_strip > gt.Rows {
+		rows_per_strip = gt.Rows
+	}
+	strips_per_band := (gt.Rows + rows_per_strip - 1) / rows_per_strip
+
+	// header, followed by the strips
+	buf := bytes.NewBuffer([]byte{'I', 'I', 42, 0, 0, 0, 0, 0})
+	offsets := make([]uint32, 0, strips_per_band*uint64(nbands))
+	counts := make([]uint32, 0, strips_per_band*uint64(nbands))
+
+	for _, band := range gt.Bands {
+		for s := uint64(0); s < strips_per_band; s++ {
+			start := s * rows_per_strip * gt.Columns
+			end := start + rows_per_strip*gt.Columns
+			if end > npixels {
+				end = npixels
+			}
+
+			strip := make([]byte, 4*(end-start))
+			for i, v := range band[start:end] {
+				binary.LittleEndian.PutUint32(strip[4*i:], math.Float32bits(v))
+			}
+
+			data, err := gt.compress(strip)
+			if err != nil {
+				return nil, errors.Join(ErrGeoTiff, err)
+			}
+
+			offsets = append(offsets, uint32(buf.Len()))
+			counts = append(counts, uint32(len(data)))
+			buf.Write(data)
+
+			if buf.Len() > math.MaxUint32/2 {
+				return nil, errors.Join(ErrGeoTiff, errors.New("GeoTiff exceeds the size of a classic TIFF"))
+			}
+		}
+	}
+
+	bits := make([]uint16, nbands)
+	formats := make([]uint16, nbands)
+	for i := range bits {
+		bits[i] = 32
+		formats[i] = 3 // IEEE floating point
+	}
+
+	gk := gt.geoKeys()
+
+	nodata := "nan"
+	if !math.IsNaN(gt.Nodata) {
+		nodata = strconv.FormatFloat(gt.Nodata, 'g', -1, 64)
+	}
+
+	entries := []tiffEntry{
+		longEntry(256, uint32(gt.Columns)),                               // ImageWidth
+		longEntry(257, uint32(gt.Rows)),                                  // ImageLength
+		shortEntry(258, bits...),                                         // BitsPerSample
+		shortEntry(259, uint16(gt.Compression)),                          // Compression
+		shortEntry(262, 1),                                               // PhotometricInterpretation; BlackIsZero
+		longEntry(273, offsets...),                                       // StripOffsets
+		shortEntry(277, uint16(nbands)),                                  // SamplesPerPixel
+		longEntry(278, uint32(rows_per_strip)),                           // RowsPerStrip
+		longEntry(279, counts...),                                        // StripByteCounts
+		shortEntry(284, 2),                                               // PlanarConfiguration; separate planes
+		shortEntry(339, formats...),                                      // SampleFormat
+		doubleEntry(33550, gt.Resolution, gt.Resolution, 0.0),            // ModelPixelScaleTag
+		doubleEntry(33922, 0.0, 0.0, 0.0, gt.X_origin, gt.Y_origin, 0.0), // ModelTiepointTag
+		shortEntry(tagGeoKeyDirectory, gk.directory()...),
+		asciiEntry(42113, nodata), // GDAL_NODATA
+	}
+
+	if nbands > 1 {
+		// the additional bands are unspecified extra samples
+		extra := make([]uint16, nbands-1)
+		entries = append(entries, shortEntry(338, extra...)) // ExtraSamples
+	}
+	if len(gk.doubles) > 0 {
+		entries = append(entries, doubleEntry(tagGeoDoubleParams, gk.doubles...))
+	}
+	if gk.ascii.Len() > 0 {
+		entries = append(entries, asciiEntry(tagGeoAsciiParams, gk.ascii.String()))
+	}
+	if len(gt.Band_names) > 0 {
+		entries = append(entries, asciiEntry(42112, gt.gdalMetadata())) // GDAL_METADATA
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	// IFD follows the strips on a word boundary, and values larger than
+	// 4 bytes follow the IFD
+	if buf.Len()%2 == 1 {
+		buf.WriteByte(0)
+	}
+	ifd_offset := uint32(buf.Len())
+	binary.LittleEndian.PutUint32(buf.Bytes()[4:], ifd_offset)
+
+	ifd_size := 2 + 12*len(entries) + 4
+	external_offset := ifd_offset + uint32(ifd_size)
+	var external bytes.Buffer
+
+	entry := make([]byte, 12)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+	for _, e := range entries {
+		binary.LittleEndian.PutUint16(entry[0:], e.tag)
+		binary.LittleEndian.PutUint16(entry[2:], e.typ)
+		binary.LittleEndian.PutUint32(entry[4:], e.count)
+		copy(entry[8:], []byte{0, 0, 0, 0})
+
+		if len(e.data) <= 4 {
+			copy(entry[8:], e.data)
+		} else {
+			binary.LittleEndian.PutUint32(entry[8:], external_offset+uint32(external.Len()))
+			external.Write(e.data)
+			if external.Len()%2 == 1 {
+				external.WriteByte(0)
+			}
+		}
+		buf.Write(entry)
+	}
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0)) // no further IFDs
+	buf.Write(external.Bytes())
+
+	return buf.Bytes(), nil
+}
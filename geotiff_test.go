@@ -0,0 +1,398 @@
+package gsf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// tiffField is a decoded IFD entry, with the value(s) read from either the
+// entry or the external offset.
+type tiffField struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func (tf *tiffField) shorts() []uint16 {
+	values := make([]uint16, tf.count)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint16(tf.data[2*i:])
+	}
+	return values
+}
+
+func (tf *tiffField) longs() []uint32 {
+	values := make([]uint32, tf.count)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(tf.data[4*i:])
+	}
+	return values
+}
+
+func (tf *tiffField) doubles() []float64 {
+	values := make([]float64, tf.count)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(tf.data[8*i:]))
+	}
+	return values
+}
+
+// decodeTiff decodes the header and the single IFD of a little-endian classic
+// TIFF, checking that the IFD and the external values are word aligned and
+// follow the strips, and that the entries are sorted by tag.
+func decodeTiff(t *testing.T, data []byte) map[uint16]tiffField {
+	t.Helper()
+
+	if !bytes.Equal(data[:4], []byte{'I', 'I', 42, 0}) {
+		t.Fatalf("invalid header: %v", data[:4])
+	}
+
+	ifd_offset := binary.LittleEndian.Uint32(data[4:])
+	if ifd_offset%2 != 0 {
+		t.Errorf("IFD offset %d is not word aligned", ifd_offset)
+	}
+
+	sizes := map[uint16]uint32{tiffAscii: 1, tiffShort: 2, tiffLong: 4, tiffDouble: 8}
+	nentries := uint32(binary.LittleEndian.Uint16(data[ifd_offset:]))
+	ifd_end := ifd_offset + 2 + 12*nentries + 4
+
+	if next := binary.LittleEndian.Uint32(data[ifd_end-4:]); next != 0 {
+		t.Errorf("next IFD offset: got %d, want 0", next)
+	}
+
+	fields := make(map[uint16]tiffField)
+	previous := uint16(0)
+	for i := uint32(0); i < nentries; i++ {
+		entry := data[ifd_offset+2+12*i:]
+		tag := binary.LittleEndian.Uint16(entry[0:])
+		typ := binary.LittleEndian.Uint16(entry[2:])
+		count := binary.LittleEndian.Uint32(entry[4:])
+
+		if tag <= previous {
+			t.Errorf("tag %d follows tag %d", tag, previous)
+		}
+		previous = tag
+
+		size, ok := sizes[typ]
+		if !ok {
+			t.Fatalf("tag %d: unexpected type %d", tag, typ)
+		}
+		nbytes := size * count
+
+		value := entry[8:12]
+		if nbytes > 4 {
+			offset := binary.LittleEndian.Uint32(entry[8:])
+			if offset%2 != 0 {
+				t.Errorf("tag %d: offset %d is not word aligned", tag, offset)
+			}
+			if offset < ifd_end || offset+nbytes > uint32(len(data)) {
+				t.Fatalf("tag %d: value [%d, %d) outside of [%d, %d)", tag, offset, offset+nbytes, ifd_end, len(data))
+			}
+			value = data[offset : offset+nbytes]
+		}
+
+		fields[tag] = tiffField{typ, count, value[:nbytes]}
+	}
+
+	return fields
+}
+
+// decompressStrip reverses the compression of a single strip.
+func decompressStrip(t *testing.T, compression TiffCompression, strip []byte) []byte {
+	t.Helper()
+
+	switch compression {
+	case TIFF_COMPRESSION_DEFLATE:
+		zr, err := zlib.NewReader(bytes.NewReader(strip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	case TIFF_COMPRESSION_ZSTD:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		data, err := decoder.DecodeAll(strip, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	return strip
+}
+
+// geoKeyDirectory decodes the GeoKey directory into a map of key id to the
+// [location, count, value] of each key, checking that the keys are sorted.
+func geoKeyDirectory(t *testing.T, fields map[uint16]tiffField) map[uint16][3]uint16 {
+	t.Helper()
+
+	field, ok := fields[tagGeoKeyDirectory]
+	if !ok {
+		t.Fatal("missing GeoKeyDirectory")
+	}
+
+	dir := field.shorts()
+	if dir[0] != 1 || dir[1] != 1 || dir[2] != 0 || len(dir) != 4*(int(dir[3])+1) {
+		t.Fatalf("invalid GeoKeyDirectory header: %v", dir[:4])
+	}
+
+	keys := make(map[uint16][3]uint16)
+	for i := 1; i <= int(dir[3]); i++ {
+		if i > 1 && dir[4*i] <= dir[4*(i-1)] {
+			t.Errorf("key %d follows key %d", dir[4*i], dir[4*(i-1)])
+		}
+		keys[dir[4*i]] = [3]uint16{dir[4*i+1], dir[4*i+2], dir[4*i+3]}
+	}
+
+	return keys
+}
+
+// TestGeoTiffEncode checks the encoded header, IFD and strips of a two band
+// GeoTiff spanning several strips, for each compression scheme.
+func TestGeoTiffEncode(t *testing.T) {
+	columns := uint64(5000)
+	rows := uint64(7)
+	npixels := columns * rows
+
+	bands := [][]float32{make([]float32, npixels), make([]float32, npixels)}
+	for i := range bands[0] {
+		bands[0][i] = float32(i) * 0.25
+		bands[1][i] = -float32(i % 97)
+	}
+	bands[1][3] = float32(math.NaN())
+
+	// 65536 / (5000 * 4) = 3 rows per strip; 3 strips per band
+	rows_per_strip := uint64(3)
+	strips_per_band := uint64(3)
+
+	for name, compression := range TiffCompressions {
+		t.Run(name, func(t *testing.T) {
+			gt := GeoTiff{
+				Columns:     columns,
+				Rows:        rows,
+				X_origin:    -10.0,
+				Y_origin:    20.0,
+				Resolution:  0.5,
+				Crs:         Crs{Horizontal_Datum: "WGS84"},
+				Nodata:      math.NaN(),
+				Compression: compression,
+				Band_names:  []string{"Mean", "Count <&>"},
+				Bands:       bands,
+			}
+
+			data, err := gt.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := decodeTiff(t, data)
+
+			for tag, want := range map[uint16]uint32{256: uint32(columns), 257: uint32(rows), 278: uint32(rows_per_strip)} {
+				field := fields[tag]
+				if got := field.longs(); len(got) != 1 || got[0] != want {
+					t.Errorf("tag %d: got %v, want %d", tag, got, want)
+				}
+			}
+			for tag, want := range map[uint16]uint16{259: uint16(compression), 277: 2, 284: 2} {
+				field := fields[tag]
+				if got := field.shorts(); len(got) != 1 || got[0] != want {
+					t.Errorf("tag %d: got %v, want %d", tag, got, want)
+				}
+			}
+
+			offsets_field := fields[273]
+			counts_field := fields[279]
+			offsets := offsets_field.longs()
+			counts := counts_field.longs()
+			if uint64(len(offsets)) != 2*strips_per_band || len(counts) != len(offsets) {
+				t.Fatalf("got %d offsets and %d counts, want %d", len(offsets), len(counts), 2*strips_per_band)
+			}
+
+			ifd_offset := binary.LittleEndian.Uint32(data[4:])
+			expected_offset := uint32(8)
+			for i := range offsets {
+				if offsets[i] != expected_offset {
+					t.Errorf("strip %d: got offset %d, want %d", i, offsets[i], expected_offset)
+				}
+				expected_offset = offsets[i] + counts[i]
+				if expected_offset > ifd_offset {
+					t.Fatalf("strip %d overlaps the IFD", i)
+				}
+
+				strip := decompressStrip(t, compression, data[offsets[i]:offsets[i]+counts[i]])
+				band := bands[uint64(i)/strips_per_band]
+				start := (uint64(i) % strips_per_band) * rows_per_strip * columns
+				end := start + rows_per_strip*columns
+				if end > npixels {
+					end = npixels
+				}
+
+				if uint64(len(strip)) != 4*(end-start) {
+					t.Fatalf("strip %d: got %d bytes, want %d", i, len(strip), 4*(end-start))
+				}
+				for j, want := range band[start:end] {
+					got := math.Float32frombits(binary.LittleEndian.Uint32(strip[4*j:]))
+					if got != want && !(math.IsNaN(float64(got)) && math.IsNaN(float64(want))) {
+						t.Fatalf("strip %d, pixel %d: got %v, want %v", i, j, got, want)
+					}
+				}
+			}
+
+			scale := fields[33550]
+			tiepoint := fields[33922]
+			if got := scale.doubles(); got[0] != 0.5 || got[1] != 0.5 {
+				t.Errorf("pixel scale: got %v", got)
+			}
+			if got := tiepoint.doubles(); got[3] != -10.0 || got[4] != 20.0 {
+				t.Errorf("tiepoint: got %v", got)
+			}
+
+			nodata := fields[42113]
+			if string(nodata.data) != "nan\x00" {
+				t.Errorf("nodata: got %q", nodata.data)
+			}
+			metadata := fields[42112]
+			if !strings.Contains(string(metadata.data), `sample="1" role="description">Count &lt;&amp;&gt;</Item>`) {
+				t.Errorf("band names missing from GDAL_METADATA: %s", metadata.data)
+			}
+			extra := fields[338]
+			if extra.count != 1 {
+				t.Errorf("extra samples: got %d, want 1", extra.count)
+			}
+		})
+	}
+}
+
+// TestGeoTiffGeoKeys checks the GeoKey directory for CRSs described by EPSG
+// codes, and for user defined geographic and projected CRSs whose parameters
+// are referenced from the GeoDoubleParams and GeoAsciiParams.
+func TestGeoTiffGeoKeys(t *testing.T) {
+	encode := func(crs Crs, proj *Projection) (map[uint16]tiffField, map[uint16][3]uint16) {
+		gt := GeoTiff{
+			Columns:     2,
+			Rows:        2,
+			Resolution:  1.0,
+			Crs:         crs,
+			Projection:  proj,
+			Nodata:      math.NaN(),
+			Compression: TIFF_COMPRESSION_NONE,
+			Bands:       [][]float32{{1, 2, 3, 4}},
+		}
+
+		data, err := gt.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := decodeTiff(t, data)
+
+		return fields, geoKeyDirectory(t, fields)
+	}
+
+	checkShort := func(name string, keys map[uint16][3]uint16, key, want uint16) {
+		t.Helper()
+		got, ok := keys[key]
+		if !ok || got[0] != 0 || got[1] != 1 || got[2] != want {
+			t.Errorf("%s: key %d: got %v, want %d", name, key, got, want)
+		}
+	}
+
+	checkDouble := func(name string, fields map[uint16]tiffField, keys map[uint16][3]uint16, key uint16, want float64) {
+		t.Helper()
+		got, ok := keys[key]
+		field := fields[tagGeoDoubleParams]
+		if !ok || got[0] != tagGeoDoubleParams || got[1] != 1 || uint32(got[2]) >= field.count {
+			t.Errorf("%s: key %d: got %v", name, key, got)
+			return
+		}
+		if value := field.doubles()[got[2]]; value != want {
+			t.Errorf("%s: key %d: got %v, want %v", name, key, value, want)
+		}
+	}
+
+	checkText := func(name string, fields map[uint16]tiffField, keys map[uint16][3]uint16, key uint16, want string) {
+		t.Helper()
+		got, ok := keys[key]
+		field := fields[tagGeoAsciiParams]
+		if !ok || got[0] != tagGeoAsciiParams || uint32(got[2])+uint32(got[1]) > field.count {
+			t.Errorf("%s: key %d: got %v", name, key, got)
+			return
+		}
+		if value := string(field.data[got[2] : got[2]+got[1]]); value != want+"|" {
+			t.Errorf("%s: key %d: got %q, want %q", name, key, value, want+"|")
+		}
+	}
+
+	// EPSG geographic
+	fields, keys := encode(Crs{Horizontal_Datum: "WGS84"}, nil)
+	checkShort("geographic epsg", keys, 1024, geoModelGeographic)
+	checkShort("geographic epsg", keys, 1025, geoRasterPixelIsArea)
+	checkShort("geographic epsg", keys, 2048, 4326)
+	if _, ok := fields[tagGeoDoubleParams]; ok {
+		t.Errorf("geographic epsg: unexpected GeoDoubleParams")
+	}
+
+	// user defined geographic
+	fields, keys = encode(Crs{Horizontal_Datum: "Unknown"}, nil)
+	checkShort("geographic user defined", keys, 2048, geoKeyUserDefined)
+	checkShort("geographic user defined", keys, 2054, geoAngularDegree)
+	checkDouble("geographic user defined", fields, keys, 2057, WGS84.A)
+	checkDouble("geographic user defined", fields, keys, 2059, 1.0/WGS84.Flattening)
+	checkText("geographic user defined", fields, keys, 2049, WGS84.Name)
+
+	// EPSG projected
+	crs := Crs{Horizontal_Datum: "WGS84"}
+	utm := NewUtmProjection(55, true, &crs)
+	_, keys = encode(crs, &utm)
+	checkShort("projected epsg", keys, 1024, geoModelProjected)
+	checkShort("projected epsg", keys, 3072, 32755)
+	if _, ok := keys[2048]; ok {
+		t.Errorf("projected epsg: unexpected GeographicTypeGeoKey")
+	}
+
+	// user defined transverse mercator
+	tmerc, err := ParseProjection("+proj=tmerc +lat_0=-10 +lon_0=147 +k_0=0.9996 +x_0=500000 +y_0=10000000 +ellps=intl", &crs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, keys = encode(crs, &tmerc)
+	checkShort("tmerc", keys, 3072, geoKeyUserDefined)
+	checkShort("tmerc", keys, 3075, geoCtTransverse)
+	checkShort("tmerc", keys, 3076, geoLinearMetre)
+	checkText("tmerc", fields, keys, 2049, INTERNATIONAL_1924.Name)
+	checkText("tmerc", fields, keys, 3073, tmerc.Definition)
+	checkDouble("tmerc", fields, keys, 2057, INTERNATIONAL_1924.A)
+	checkDouble("tmerc", fields, keys, 3080, 147.0)
+	checkDouble("tmerc", fields, keys, 3081, -10.0)
+	checkDouble("tmerc", fields, keys, 3082, 500000.0)
+	checkDouble("tmerc", fields, keys, 3083, 10000000.0)
+	checkDouble("tmerc", fields, keys, 3092, 0.9996)
+
+	// user defined lambert conformal conic
+	lcc, err := ParseProjection("+proj=lcc +lat_1=-36 +lat_2=-38 +lat_0=-37 +lon_0=145 +x_0=2500000 +y_0=2600000", &crs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, keys = encode(crs, &lcc)
+	checkShort("lcc", keys, 3075, geoCtLambertConfConic)
+	checkText("lcc", fields, keys, 3073, lcc.Definition)
+	checkDouble("lcc", fields, keys, 3078, -36.0)
+	checkDouble("lcc", fields, keys, 3079, -38.0)
+	checkDouble("lcc", fields, keys, 3084, 145.0)
+	checkDouble("lcc", fields, keys, 3085, -37.0)
+	checkDouble("lcc", fields, keys, 3086, 2500000.0)
+	checkDouble("lcc", fields, keys, 3087, 2600000.0)
+}
@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/TileDB-Inc/TileDB-Go v0.30.3
 	github.com/alitto/pond v1.8.3
+	github.com/klauspost/compress v1.17.9
 	github.com/samber/lo v1.46.0
 	github.com/soniakeys/meeus/v3 v3.0.1
 	github.com/urfave/cli/v2 v2.27.2
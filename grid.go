@@ -0,0 +1,303 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	tiledb "github.com/TileDB-Inc/TileDB-Go"
+	"github.com/samber/lo"
+)
+
+// GridLayers contains the statistics of the soundings (Z) binned into each
+// cell of a Grid. The cells are stored in row-major order, with the first row
+// being the northern most row. Cells without soundings are NaN, with a Count
+// of zero. Weighted_mean is the mean weighted by the inverse variance given by
+// the VerticalError of each sounding, and is NaN for cells whose soundings
+// have no vertical error. The Median is estimated from a histogram of the
+// soundings, and is accurate to within gridHistogramResolution.
+type GridLayers struct {
+	Mean          []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Median        []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Min           []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Max           []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Std           []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Weighted_mean []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Count         []uint32  `tiledb:"dtype=uint32,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// Grid is a regular grid of the binned soundings, with the grid geometry and
+// coordinates defined by the RasterGeometry.
+type Grid struct {
+	RasterGeometry
+	Vertical VerticalReduction
+	Layers   GridLayers
+}
+
+// gridMetadata is the grid geometry and spatial reference, as stored in the
+// array metadata.
+type gridMetadata struct {
+	RasterGeometry
+	Vertical_Reference VerticalReduction
+}
+
+// resolution (metres) of the histograms used to estimate the median, such
+// that the memory used by each cell is bounded by the range of its soundings
+// rather than their number
+const gridHistogramResolution = 0.01
+
+// gridCell accumulates the statistics for a single grid cell.
+// The mean and variance are accumulated using Welford's algorithm, along
+// with a histogram of the soundings for estimating the median.
+type gridCell struct {
+	count  uint32
+	mean   float64
+	m2     float64
+	min    float64
+	max    float64
+	sum_w  float64
+	sum_wz float64
+	hist   map[int32]uint32
+}
+
+// add accumulates a sounding, along with its vertical error (<= 0 if unknown).
+func (gc *gridCell) add(z, vertical_error float64) {
+	if gc.count == 0 {
+		gc.min = z
+		gc.max = z
+		gc.hist = make(map[int32]uint32)
+	}
+
+	gc.count++
+	delta := z - gc.mean
+	gc.mean += delta / float64(gc.count)
+	gc.m2 += delta * (z - gc.mean)
+	gc.min = math.Min(gc.min, z)
+	gc.max = math.Max(gc.max, z)
+	gc.hist[int32(math.Round(z/gridHistogramResolution))]++
+
+	if vertical_error > 0.0 {
+		w := 1.0 / (vertical_error * vertical_error)
+		gc.sum_w += w
+		gc.sum_wz += w * z
+	}
+}
+
+// median estimates the median (nearest rank) of the accumulated soundings,
+// to within the histogram resolution, and bounded by the min and max.
+func (gc *gridCell) median() float64 {
+	keys := lo.Keys(gc.hist)
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	rank := (gc.count + 1) / 2
+	cumulative := uint32(0)
+	median := gc.max
+	for _, key := range keys {
+		cumulative += gc.hist[key]
+		if cumulative >= rank {
+			median = float64(key) * gridHistogramResolution
+			break
+		}
+	}
+
+	return math.Max(gc.min, math.Min(gc.max, median))
+}
+
+// Gridder bins soundings into a regular grid, streaming over chunks of
+// PingData. The extent of the grid grows to contain the soundings that
+// have been added. Crs is the CRS of the GSF file, and is carried through
+// to the Grid.
+type Gridder struct {
+	Resolution float64
+	Reference  SpatialReference
+	Crs        Crs
+	cells      map[[2]int64]*gridCell
+}
+
+// NewGridder constructs a Gridder with the cell size given by resolution.
+// The spatial reference determines the grid coordinates; if it contains a
+// Projection, the soundings are binned using the projected coordinates,
+// otherwise longitude and latitude are used. The crs is the CRS of the GSF
+// file.
+func NewGridder(resolution float64, sref *SpatialReference, crs Crs) (*Gridder, error) {
+	if !(resolution > 0.0) {
+		return nil, errors.Join(ErrGrid, errors.New("Grid resolution must be positive"))
+	}
+
+	gr := Gridder{
+		Resolution: resolution,
+		Reference:  *sref,
+		Crs:        crs,
+		cells:      make(map[[2]int64]*gridCell),
+	}
+
+	return &gr, nil
+}
+
+// Add bins the georeferenced soundings of the PingData into the grid.
+// Only soundings that are not rejected (see BeamFlag.IsRejected, if the beam
+// flags exist) with a valid Z value and position are included.
+func (gr *Gridder) Add(pd *PingData) {
+	ba := &pd.Beam_array
+	x := pd.Lon_lat.Longitude
+	y := pd.Lon_lat.Latitude
+	if gr.Reference.Projection != nil {
+		x = pd.Easting_northing.Easting
+		y = pd.Easting_northing.Northing
+	}
+
+	has_flags := len(ba.BeamFlags) == len(ba.Z)
+	has_error := len(ba.VerticalError) == len(ba.Z)
+
+	for i, z := range ba.Z {
+		if z == NULL_DEPTH_F64 || math.IsNaN(z) {
+			continue
+		}
+		if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+			continue
+		}
+		if pd.Lon_lat.Longitude[i] == NULL_LONGITUDE_F64 || pd.Lon_lat.Latitude[i] == NULL_LATITUDE_F64 {
+			continue
+		}
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			continue
+		}
+
+		key := cellKey(x[i], y[i], gr.Resolution)
+
+		cell, ok := gr.cells[key]
+		if !ok {
+			cell = &gridCell{}
+			gr.cells[key] = cell
+		}
+
+		vertical_error := 0.0
+		if has_error {
+			vertical_error = float64(ba.VerticalError[i])
+		}
+
+		cell.add(z, vertical_error)
+	}
+}
+
+// Grid computes the statistics for each cell and constructs the Grid.
+// The returned bool is false if no soundings have been added.
+func (gr *Gridder) Grid() (Grid, bool) {
+	var grid Grid
+
+	grid.Resolution = gr.Resolution
+	grid.Crs = gr.Crs
+	grid.Projection = gr.Reference.Projection
+	grid.Vertical = gr.Reference.Vertical
+
+	if len(gr.cells) == 0 {
+		return grid, false
+	}
+
+	geom, min_col, max_row := rasterExtent(lo.Keys(gr.cells), gr.Resolution)
+	grid.X_origin = geom.X_origin
+	grid.Y_origin = geom.Y_origin
+	grid.Columns = geom.Columns
+	grid.Rows = geom.Rows
+
+	ncells := int(grid.Columns * grid.Rows)
+	layers := GridLayers{
+		Mean:          make([]float32, ncells),
+		Median:        make([]float32, ncells),
+		Min:           make([]float32, ncells),
+		Max:           make([]float32, ncells),
+		Std:           make([]float32, ncells),
+		Weighted_mean: make([]float32, ncells),
+		Count:         make([]uint32, ncells),
+	}
+
+	nan := float32(math.NaN())
+	for i := 0; i < ncells; i++ {
+		layers.Mean[i] = nan
+		layers.Median[i] = nan
+		layers.Min[i] = nan
+		layers.Max[i] = nan
+		layers.Std[i] = nan
+		layers.Weighted_mean[i] = nan
+	}
+
+	for key, cell := range gr.cells {
+		idx := grid.cellIndex(key, min_col, max_row)
+
+		layers.Count[idx] = cell.count
+		layers.Mean[idx] = float32(cell.mean)
+		layers.Median[idx] = float32(cell.median())
+		layers.Min[idx] = float32(cell.min)
+		layers.Max[idx] = float32(cell.max)
+		layers.Std[idx] = float32(math.Sqrt(cell.m2 / float64(cell.count)))
+		if cell.sum_w > 0.0 {
+			layers.Weighted_mean[idx] = float32(cell.sum_wz / cell.sum_w)
+		}
+	}
+
+	grid.Layers = layers
+
+	return grid, true
+}
+
+// ToTileDB writes the Grid to a dense TileDB array using [Row, Column] as the
+// dimensional axes. The grid geometry (origin, resolution, CRS, projection
+// and vertical reference) is written to the array metadata under the key "Grid".
+func (g *Grid) ToTileDB(array_uri string, ctx *tiledb.Context) error {
+	md := gridMetadata{
+		RasterGeometry:     g.RasterGeometry,
+		Vertical_Reference: g.Vertical,
+	}
+
+	err := g.writeRasterTileDB(ctx, array_uri, &g.Layers, "Grid", md)
+	if err != nil {
+		return errors.Join(ErrGrid, err)
+	}
+
+	return nil
+}
+
+// ReadGridTileDB reads a Grid, previously written by Grid.ToTileDB, from a
+// dense TileDB array.
+func ReadGridTileDB(ctx *tiledb.Context, array_uri string) (Grid, error) {
+	var (
+		grid Grid
+		md   gridMetadata
+	)
+
+	geom, err := readRasterTileDB(ctx, array_uri, "Grid", &md, &grid.Layers)
+	if err != nil {
+		return grid, errors.Join(ErrGrid, err)
+	}
+
+	grid.RasterGeometry = geom
+	grid.Vertical = md.Vertical_Reference
+
+	return grid, nil
+}
+
+// GeoTiff constructs a GeoTiff from the grid layers, using NaN as the no data
+// value. The Count layer is converted to Float32, with zero counts as no data.
+func (g *Grid) GeoTiff(compression TiffCompression) GeoTiff {
+	count := make([]float32, len(g.Layers.Count))
+	for i, c := range g.Layers.Count {
+		count[i] = float32(c)
+		if c == 0 {
+			count[i] = float32(math.NaN())
+		}
+	}
+
+	gt := g.geoTiff(compression)
+	gt.Band_names = []string{"Mean", "Median", "Min", "Max", "Std", "Weighted_mean", "Count"}
+	gt.Bands = [][]float32{
+		g.Layers.Mean,
+		g.Layers.Median,
+		g.Layers.Min,
+		g.Layers.Max,
+		g.Layers.Std,
+		g.Layers.Weighted_mean,
+		count,
+	}
+
+	return gt
+}
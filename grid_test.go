@@ -0,0 +1,176 @@
+package gsf
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGridCellMedian checks that the median estimated from the histogram is
+// the nearest rank (lower) median, to within gridHistogramResolution, and
+// bounded by the min and max.
+func TestGridCellMedian(t *testing.T) {
+	tests := []struct {
+		name      string
+		soundings []float64
+		median    float64
+	}{
+		{"single", []float64{-12.3456}, -12.3456},
+		{"odd", []float64{-9.87, -10.5, -10.123}, -10.123},
+		{"even", []float64{-1.0, -4.0, -2.0, -3.0}, -3.0},
+		{"repeated", []float64{-5.0, -5.0, -5.0, -6.0, -7.0}, -5.0},
+		{"straddling zero", []float64{-0.004, 0.003, 0.012}, 0.003},
+		{"within a single bin", []float64{20.0011, 20.0012, 20.0013}, 20.0012},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cell gridCell
+			for _, z := range test.soundings {
+				cell.add(z, 0.0)
+			}
+
+			median := cell.median()
+			if math.Abs(median-test.median) > gridHistogramResolution {
+				t.Errorf("got %v, want %v", median, test.median)
+			}
+			if median < cell.min || median > cell.max {
+				t.Errorf("median %v outside of [%v, %v]", median, cell.min, cell.max)
+			}
+		})
+	}
+}
+
+// gridPing constructs a single ping of beams at the given longitudes and
+// latitudes, with the given Z, vertical errors and beam flags.
+func gridPing(lon, lat, z []float64, vertical_error []float32, flags []uint8) PingData {
+	var pd PingData
+
+	pd.Lon_lat = LonLat{Longitude: lon, Latitude: lat}
+	pd.Beam_array.Z = z
+	pd.Beam_array.VerticalError = vertical_error
+	pd.Beam_array.BeamFlags = flags
+	pd.Ping_headers.Number_beams = []uint16{uint16(len(z))}
+
+	return pd
+}
+
+// TestGridderGrid checks the grid geometry, north-up row order and the cell
+// statistics of soundings binned either side of the origin, such that the
+// cell keys of negative coordinates are floored rather than truncated.
+func TestGridderGrid(t *testing.T) {
+	gr, err := NewGridder(1.0, &SpatialReference{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := gr.Grid(); ok {
+		t.Errorf("expected no grid before soundings are added")
+	}
+
+	// cells (column, row); (-1, 0) to the north-west, (1, 0) to the
+	// north-east, and (0, -2) to the south
+	pd := gridPing(
+		[]float64{-0.5, -0.25, 1.5, 1.75, 0.5, 0.5, 0.5, NULL_LONGITUDE_F64},
+		[]float64{0.5, 0.75, 0.5, 0.25, -1.5, -1.5, -1.5, 0.5},
+		[]float64{-10.0, -12.0, -20.0, -21.0, -30.0, NULL_DEPTH_F64, -99.0, -40.0},
+		[]float32{0.5, 1.0, 0.0, 0.0, 0.2, 0.2, 0.2, 0.2},
+		[]uint8{0, 0, 0, 0, 0, 0, uint8(BEAM_FLAG_IGNORE | BEAM_FLAG_IGNORE_MANUAL_EDIT), 0},
+	)
+	gr.Add(&pd)
+
+	grid, ok := gr.Grid()
+	if !ok {
+		t.Fatal("expected a grid")
+	}
+
+	if grid.Columns != 3 || grid.Rows != 3 {
+		t.Errorf("shape: got (%d, %d), want (3, 3)", grid.Rows, grid.Columns)
+	}
+	if grid.X_origin != -1.0 || grid.Y_origin != 1.0 {
+		t.Errorf("origin: got (%v, %v), want (-1, 1)", grid.X_origin, grid.Y_origin)
+	}
+
+	// the inverse variance weighted mean of -10 (0.5) and -12 (1.0)
+	weighted := float32((-10.0/0.25 - 12.0/1.0) / (1.0/0.25 + 1.0/1.0))
+
+	layers := &grid.Layers
+	expected := map[int]struct {
+		count    uint32
+		mean     float32
+		min      float32
+		max      float32
+		weighted float32
+	}{
+		0: {2, -11.0, -12.0, -10.0, weighted},
+		2: {2, -20.5, -21.0, -20.0, float32(math.NaN())},
+		7: {1, -30.0, -30.0, -30.0, -30.0},
+	}
+
+	for idx := 0; idx < 9; idx++ {
+		want, ok := expected[idx]
+		if !ok {
+			if layers.Count[idx] != 0 || !math.IsNaN(float64(layers.Mean[idx])) || !math.IsNaN(float64(layers.Median[idx])) {
+				t.Errorf("cell %d: expected an empty cell, got count %d, mean %v", idx, layers.Count[idx], layers.Mean[idx])
+			}
+			continue
+		}
+
+		if layers.Count[idx] != want.count {
+			t.Errorf("cell %d count: got %d, want %d", idx, layers.Count[idx], want.count)
+		}
+		if layers.Mean[idx] != want.mean || layers.Min[idx] != want.min || layers.Max[idx] != want.max {
+			t.Errorf("cell %d: got (%v, %v, %v), want (%v, %v, %v)", idx, layers.Mean[idx], layers.Min[idx], layers.Max[idx], want.mean, want.min, want.max)
+		}
+		if layers.Median[idx] < want.min || layers.Median[idx] > want.max {
+			t.Errorf("cell %d median: got %v, outside of [%v, %v]", idx, layers.Median[idx], want.min, want.max)
+		}
+
+		got_nan := math.IsNaN(float64(layers.Weighted_mean[idx]))
+		want_nan := math.IsNaN(float64(want.weighted))
+		if got_nan != want_nan || (!want_nan && math.Abs(float64(layers.Weighted_mean[idx]-want.weighted)) > 1e-5) {
+			t.Errorf("cell %d weighted mean: got %v, want %v", idx, layers.Weighted_mean[idx], want.weighted)
+		}
+	}
+
+	if layers.Std[0] != 1.0 || layers.Std[7] != 0.0 {
+		t.Errorf("std: got (%v, %v), want (1, 0)", layers.Std[0], layers.Std[7])
+	}
+}
+
+// TestRasterExtent checks the raster geometry and the north-up row-major
+// indices for cell keys with negative columns and rows.
+func TestRasterExtent(t *testing.T) {
+	resolution := 2.0
+	keys := [][2]int64{
+		cellKey(-3.0, -0.5, resolution),
+		cellKey(4.5, 5.9, resolution),
+		cellKey(-0.1, 2.0, resolution),
+	}
+
+	want_keys := [][2]int64{{-2, -1}, {2, 2}, {-1, 1}}
+	for i := range keys {
+		if keys[i] != want_keys[i] {
+			t.Errorf("key %d: got %v, want %v", i, keys[i], want_keys[i])
+		}
+	}
+
+	geom, min_col, max_row := rasterExtent(keys, resolution)
+	if min_col != -2 || max_row != 2 {
+		t.Errorf("got min column %d and max row %d, want -2 and 2", min_col, max_row)
+	}
+	if geom.Columns != 5 || geom.Rows != 4 {
+		t.Errorf("shape: got (%d, %d), want (4, 5)", geom.Rows, geom.Columns)
+	}
+	if geom.X_origin != -4.0 || geom.Y_origin != 6.0 || geom.Resolution != resolution {
+		t.Errorf("origin: got (%v, %v), want (-4, 6)", geom.X_origin, geom.Y_origin)
+	}
+
+	// the northern most row is first
+	want_idx := []uint64{3*5 + 0, 0*5 + 4, 1*5 + 1}
+	for i, key := range keys {
+		idx := geom.cellIndex(key, min_col, max_row)
+		if idx != want_idx[i] {
+			t.Errorf("key %v: got index %d, want %d", key, idx, want_idx[i])
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package gsf
+
+import (
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// PingHead identifies the sonar head and swath of each ping, enabling the
+// pings of dual head and dual swath configurations to be separated.
+// Head_id is the sonar head (numbered in order of first appearance when
+// derived from the sensor's serial number), and Swath_id is the swath of a
+// multi-swath ping (zero for the first swath). Head_ping_number is the
+// ping's position amongst the pings of the same head, and is the PingNumber
+// used when each head's beams are written to their own beam array.
+type PingHead struct {
+	Head_id          []uint8  `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	Swath_id         []uint8  `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+	Head_ping_number []uint64 `tiledb:"dtype=uint64,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// headPing is the previous ping of a head, used for identifying the swaths
+// of a multi-swath ping.
+type headPing struct {
+	counter   uint64
+	timestamp time.Time
+	swath     uint8
+}
+
+// headTracker identifies the head and swath of each ping, streaming over
+// chunks of PingData. State is carried across chunks, as the swaths of a ping
+// can be split across a chunk boundary.
+type headTracker struct {
+	serials map[uint16]uint8
+	last    map[uint8]headPing
+	counts  map[uint8]uint64
+}
+
+// newHeadTracker constructs a headTracker.
+func newHeadTracker() *headTracker {
+	ht := headTracker{
+		serials: make(map[uint16]uint8),
+		last:    make(map[uint8]headPing),
+		counts:  make(map[uint8]uint64),
+	}
+
+	return &ht
+}
+
+// serialHead retrieves the head id for a sensor serial number, assigning the
+// next head id if the serial number hasn't been seen.
+func (ht *headTracker) serialHead(serial uint16) uint8 {
+	head, ok := ht.serials[serial]
+	if !ok {
+		head = uint8(len(ht.serials))
+		ht.serials[serial] = head
+	}
+
+	return head
+}
+
+// pingHead retrieves the head, ping counter, and (if recorded) swath for the
+// ping (row) of the SensorMetadata.
+// The generation 3 and 4 EM sensors (including the raw variants) record a
+// serial number for each head, along with a ping counter that is repeated
+// for each swath of a multi-swath ping. KMALL records the receive transducer
+// and the along track position of the swath directly. Otherwise, a single
+// head is assumed and the counter is unavailable.
+func (ht *headTracker) pingHead(sm *SensorMetadata, sensor_id SubRecordID, ping int) (head uint8, counter uint64, has_counter bool, swath uint8, has_swath bool) {
+	serial := func(serials, counters []uint16) {
+		if ping < len(serials) && ping < len(counters) {
+			head = ht.serialHead(serials[ping])
+			counter = uint64(counters[ping])
+			has_counter = true
+		}
+	}
+
+	switch sensor_id {
+	case EM120, EM300, EM1002, EM2000, EM3000, EM3002, EM3000D, EM3002D, EM121A_SIS:
+		serial(sm.Em3.SerialNumber, sm.Em3.PingNumber)
+	case EM300_RAW, EM1002_RAW, EM2000_RAW, EM3000_RAW, EM120_RAW, EM3002_RAW, EM3000D_RAW, EM3002D_RAW, EM121A_SIS_RAW:
+		serial(sm.Em3Raw.SerialNumber, sm.Em3Raw.PingCounter)
+	case EM710, EM302, EM122, EM2040, ME70BO:
+		serial(sm.Em4.SerialNumber, sm.Em4.PingCounter)
+	case KMALL:
+		kmall := &sm.Kmall
+		if ping < len(kmall.RxTransducerIndex) && ping < len(kmall.SwathAlongPosition) {
+			head = kmall.RxTransducerIndex[ping]
+			swath = kmall.SwathAlongPosition[ping]
+			has_swath = true
+		}
+		if ping < len(kmall.PingCounter) {
+			counter = uint64(kmall.PingCounter[ping])
+			has_counter = true
+		}
+	}
+
+	return head, counter, has_counter, swath, has_swath
+}
+
+// identify computes the PingHead for each ping contained within the PingData.
+// Where the sensor doesn't record the swath, successive pings of the same head
+// sharing a ping counter (or a timestamp if no counter is recorded) are
+// numbered as the swaths of a multi-swath ping.
+func (ht *headTracker) identify(pd *PingData, sensor_id SubRecordID) PingHead {
+	hdr := &pd.Ping_headers
+	npings := len(hdr.Timestamp)
+	ph := PingHead{
+		Head_id:          make([]uint8, npings),
+		Swath_id:         make([]uint8, npings),
+		Head_ping_number: make([]uint64, npings),
+	}
+
+	for i, timestamp := range hdr.Timestamp {
+		head, counter, has_counter, swath, has_swath := ht.pingHead(&pd.Sensor_metadata, sensor_id, i)
+
+		if !has_swath {
+			prev, ok := ht.last[head]
+			same := ok && timestamp.Equal(prev.timestamp)
+			if has_counter {
+				same = ok && counter == prev.counter
+			}
+			if same {
+				swath = prev.swath + 1
+			}
+		}
+
+		ht.last[head] = headPing{counter: counter, timestamp: timestamp, swath: swath}
+
+		ph.Head_id[i] = head
+		ph.Swath_id[i] = swath
+		ph.Head_ping_number[i] = ht.counts[head]
+		ht.counts[head]++
+	}
+
+	return ph
+}
+
+// Heads returns the head ids (in ascending order) contained in the PingHead.
+func (ph *PingHead) Heads() []uint8 {
+	heads := lo.Uniq(ph.Head_id)
+	sort.Slice(heads, func(i, j int) bool { return heads[i] < heads[j] })
+
+	return heads
+}
+
+// headBeams constructs the beam data of a single head from the PingData,
+// along with the ping and beam numbers, where the ping numbers are the
+// Head_ping_number of each ping. The beams of each ping (including any
+// padding for dense beam data) lie between the start of the ping's beams and
+// the start of the next ping's beams.
+// The returned bool is false if the layout of the beams cannot be determined.
+func (pd *PingData) headBeams(head uint8, ping_beam_ids *PingBeamNumbers) (PingData, *PingBeamNumbers, bool) {
+	ranges := pd.pingBeamRanges()
+	nbeams := len(pd.Lon_lat.Longitude)
+	ph := &pd.Ping_head
+	if ranges == nil || len(ph.Head_id) != len(ranges) || len(ping_beam_ids.PingNumber) != nbeams {
+		return PingData{}, nil, false
+	}
+
+	keep := make([]bool, nbeams)
+	ids := PingBeamNumbers{
+		PingNumber: make([]uint64, 0, nbeams),
+		BeamNumber: make([]uint64, 0, nbeams),
+	}
+
+	for ping, rng := range ranges {
+		if ph.Head_id[ping] != head {
+			continue
+		}
+
+		end := nbeams
+		if ping+1 < len(ranges) {
+			end = ranges[ping+1][0]
+		}
+
+		for i := rng[0]; i < end; i++ {
+			keep[i] = true
+			ids.PingNumber = append(ids.PingNumber, ph.Head_ping_number[ping])
+			ids.BeamNumber = append(ids.BeamNumber, ping_beam_ids.BeamNumber[i])
+		}
+	}
+
+	// the beam data is copied on selection, leaving pd as is
+	sub := *pd
+	sub.selectBeams(keep)
+
+	return sub, &ids, true
+}
@@ -0,0 +1,161 @@
+package gsf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// em4Pings constructs the PingData of EM4 sensor pings with the given serial
+// numbers and ping counters.
+func em4Pings(serials, counters []uint16, start time.Time) PingData {
+	var pd PingData
+
+	for i := range serials {
+		pd.Ping_headers.Timestamp = append(pd.Ping_headers.Timestamp, start.Add(time.Duration(i)*time.Second))
+	}
+	pd.Sensor_metadata.Em4.SerialNumber = serials
+	pd.Sensor_metadata.Em4.PingCounter = counters
+
+	return pd
+}
+
+// checkPingHead reports any differences between the PingHead and the expected
+// head ids, swath ids and head ping numbers.
+func checkPingHead(t *testing.T, ph *PingHead, heads, swaths []uint8, numbers []uint64) {
+	t.Helper()
+
+	if !reflect.DeepEqual(ph.Head_id, heads) {
+		t.Errorf("Head_id: got %v, want %v", ph.Head_id, heads)
+	}
+	if !reflect.DeepEqual(ph.Swath_id, swaths) {
+		t.Errorf("Swath_id: got %v, want %v", ph.Swath_id, swaths)
+	}
+	if !reflect.DeepEqual(ph.Head_ping_number, numbers) {
+		t.Errorf("Head_ping_number: got %v, want %v", ph.Head_ping_number, numbers)
+	}
+}
+
+// TestIdentifyDualHead checks that the heads of a dual head EM4 sensor are
+// identified from the serial numbers, and that the same ping counter on each
+// head isn't mistaken for the swaths of a multi-swath ping.
+func TestIdentifyDualHead(t *testing.T) {
+	ht := newHeadTracker()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	pd := em4Pings([]uint16{202, 101, 202, 101, 202, 101}, []uint16{7, 7, 8, 8, 9, 9}, start)
+	ph := ht.identify(&pd, EM2040)
+	checkPingHead(t, &ph, []uint8{0, 1, 0, 1, 0, 1}, []uint8{0, 0, 0, 0, 0, 0}, []uint64{0, 0, 1, 1, 2, 2})
+
+	if heads := ph.Heads(); !reflect.DeepEqual(heads, []uint8{0, 1}) {
+		t.Errorf("Heads: got %v, want [0 1]", heads)
+	}
+}
+
+// TestIdentifyDualSwathAcrossChunks checks that the swaths of a dual swath
+// ping, sharing a ping counter, are identified when the ping is split across
+// two chunks, and that the head ping numbers continue across the chunks.
+func TestIdentifyDualSwathAcrossChunks(t *testing.T) {
+	ht := newHeadTracker()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	pd := em4Pings([]uint16{101, 101, 101}, []uint16{5, 5, 6}, start)
+	ph := ht.identify(&pd, EM710)
+	checkPingHead(t, &ph, []uint8{0, 0, 0}, []uint8{0, 1, 0}, []uint64{0, 1, 2})
+
+	pd = em4Pings([]uint16{101, 101, 101}, []uint16{6, 7, 7}, start.Add(3*time.Second))
+	ph = ht.identify(&pd, EM710)
+	checkPingHead(t, &ph, []uint8{0, 0, 0}, []uint8{1, 0, 1}, []uint64{3, 4, 5})
+}
+
+// TestIdentifyWithoutCounter checks that, for sensors without a ping counter,
+// successive pings sharing a timestamp are numbered as swaths.
+func TestIdentifyWithoutCounter(t *testing.T) {
+	ht := newHeadTracker()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var pd PingData
+	pd.Ping_headers.Timestamp = []time.Time{start, start, start.Add(time.Second), start.Add(2 * time.Second)}
+
+	ph := ht.identify(&pd, RESON_7125)
+	checkPingHead(t, &ph, []uint8{0, 0, 0, 0}, []uint8{0, 1, 0, 0}, []uint64{0, 1, 2, 3})
+}
+
+// TestIdentifyKmall checks that the head and swath recorded by KMALL are used
+// directly.
+func TestIdentifyKmall(t *testing.T) {
+	ht := newHeadTracker()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var pd PingData
+	pd.Ping_headers.Timestamp = []time.Time{start, start, start, start}
+	pd.Sensor_metadata.Kmall.RxTransducerIndex = []uint8{0, 0, 1, 1}
+	pd.Sensor_metadata.Kmall.SwathAlongPosition = []uint8{0, 1, 0, 1}
+	pd.Sensor_metadata.Kmall.PingCounter = []uint16{3, 3, 3, 3}
+
+	ph := ht.identify(&pd, KMALL)
+	checkPingHead(t, &ph, []uint8{0, 0, 1, 1}, []uint8{0, 1, 0, 1}, []uint64{0, 1, 0, 1})
+}
+
+// TestHeadBeams checks that the beams of a single head are selected from
+// dense (padded) beam data, including the padding of each ping, and numbered
+// by the Head_ping_number.
+func TestHeadBeams(t *testing.T) {
+	var pd PingData
+
+	// 3 pings padded to 3 beams; heads 0, 1, 0
+	pd.Ping_headers.Number_beams = []uint16{2, 3, 1}
+	pd.Lon_lat.Longitude = []float64{0, 1, NULL_LONGITUDE_F64, 3, 4, 5, 6, NULL_LONGITUDE_F64, NULL_LONGITUDE_F64}
+	pd.Lon_lat.Latitude = []float64{10, 11, NULL_LATITUDE_F64, 13, 14, 15, 16, NULL_LATITUDE_F64, NULL_LATITUDE_F64}
+	pd.Beam_array.Z = []float64{-20, -21, NULL_DEPTH_F64, -23, -24, -25, -26, NULL_DEPTH_F64, NULL_DEPTH_F64}
+	pd.Ping_head = PingHead{
+		Head_id:          []uint8{0, 1, 0},
+		Swath_id:         []uint8{0, 0, 0},
+		Head_ping_number: []uint64{0, 0, 1},
+	}
+
+	ids := PingBeamNumbers{
+		PingNumber: []uint64{0, 0, 0, 1, 1, 1, 2, 2, 2},
+		BeamNumber: []uint64{0, 1, 2, 0, 1, 2, 0, 1, 2},
+	}
+
+	sub, sub_ids, ok := pd.headBeams(0, &ids)
+	if !ok {
+		t.Fatal("failed to select the beams of head 0")
+	}
+
+	if want := []float64{0, 1, NULL_LONGITUDE_F64, 6, NULL_LONGITUDE_F64, NULL_LONGITUDE_F64}; !reflect.DeepEqual(sub.Lon_lat.Longitude, want) {
+		t.Errorf("Longitude: got %v, want %v", sub.Lon_lat.Longitude, want)
+	}
+	if want := []float64{-20, -21, NULL_DEPTH_F64, -26, NULL_DEPTH_F64, NULL_DEPTH_F64}; !reflect.DeepEqual(sub.Beam_array.Z, want) {
+		t.Errorf("Z: got %v, want %v", sub.Beam_array.Z, want)
+	}
+	if want := []uint64{0, 0, 0, 1, 1, 1}; !reflect.DeepEqual(sub_ids.PingNumber, want) {
+		t.Errorf("PingNumber: got %v, want %v", sub_ids.PingNumber, want)
+	}
+	if want := []uint64{0, 1, 2, 0, 1, 2}; !reflect.DeepEqual(sub_ids.BeamNumber, want) {
+		t.Errorf("BeamNumber: got %v, want %v", sub_ids.BeamNumber, want)
+	}
+
+	sub, sub_ids, ok = pd.headBeams(1, &ids)
+	if !ok {
+		t.Fatal("failed to select the beams of head 1")
+	}
+	if want := []float64{3, 4, 5}; !reflect.DeepEqual(sub.Lon_lat.Longitude, want) {
+		t.Errorf("Longitude: got %v, want %v", sub.Lon_lat.Longitude, want)
+	}
+	if want := []uint64{0, 0, 0}; !reflect.DeepEqual(sub_ids.PingNumber, want) {
+		t.Errorf("PingNumber: got %v, want %v", sub_ids.PingNumber, want)
+	}
+
+	// the source PingData is left as is
+	if len(pd.Lon_lat.Longitude) != 9 || pd.Beam_array.Z[3] != -23 {
+		t.Errorf("source PingData was modified")
+	}
+
+	// the head ids don't match the pings
+	pd.Ping_head.Head_id = []uint8{0, 1}
+	if _, _, ok = pd.headBeams(0, &ids); ok {
+		t.Errorf("expected the layout to be undetermined")
+	}
+}
@@ -0,0 +1,393 @@
+package gsf
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ISO_CODELIST_URI = "https://standards.iso.org/iso/19115/resources/Codelists/cat/codelists.xml"
+
+// isoNamespaces are the namespace prefixes used within the ISO 19115-3 document.
+var isoNamespaces = [][2]string{
+	{"mdb", "http://standards.iso.org/iso/19115/-3/mdb/2.0"},
+	{"cit", "http://standards.iso.org/iso/19115/-3/cit/2.0"},
+	{"gco", "http://standards.iso.org/iso/19115/-3/gco/1.0"},
+	{"gex", "http://standards.iso.org/iso/19115/-3/gex/1.0"},
+	{"lan", "http://standards.iso.org/iso/19115/-3/lan/1.0"},
+	{"mac", "http://standards.iso.org/iso/19115/-3/mac/2.0"},
+	{"mcc", "http://standards.iso.org/iso/19115/-3/mcc/1.0"},
+	{"mdq", "http://standards.iso.org/iso/19157/-2/mdq/1.0"},
+	{"mrd", "http://standards.iso.org/iso/19115/-3/mrd/1.0"},
+	{"mri", "http://standards.iso.org/iso/19115/-3/mri/1.0"},
+	{"mrl", "http://standards.iso.org/iso/19115/-3/mrl/2.0"},
+	{"mrs", "http://standards.iso.org/iso/19115/-3/mrs/1.0"},
+	{"gml", "http://www.opengis.net/gml/3.2"},
+}
+
+// isoElement is a generic XML element. The ISO 19115-3 schema is both deep and
+// wide, so rather than define a type for every class, the document is
+// constructed as a tree of elements using the namespace prefixed names.
+type isoElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Value    string       `xml:",chardata"`
+	Children []isoElement `xml:",any"`
+}
+
+// isoEl constructs an element containing child elements.
+func isoEl(name string, children ...isoElement) isoElement {
+	return isoElement{XMLName: xml.Name{Local: name}, Children: children}
+}
+
+// isoValue constructs an element containing a value.
+func isoValue(name, value string) isoElement {
+	return isoElement{XMLName: xml.Name{Local: name}, Value: value}
+}
+
+// isoAttr adds an attribute to the element.
+func (e isoElement) isoAttr(name, value string) isoElement {
+	e.Attrs = append(e.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	return e
+}
+
+// isoString constructs a property element containing a gco:CharacterString.
+func isoString(name, value string) isoElement {
+	return isoEl(name, isoValue("gco:CharacterString", value))
+}
+
+// isoCode constructs a property element containing a code list value.
+func isoCode(name, codelist, value string) isoElement {
+	code := isoValue(codelist, value).
+		isoAttr("codeList", ISO_CODELIST_URI+"#"+strings.Split(codelist, ":")[1]).
+		isoAttr("codeListValue", value)
+	return isoEl(name, code)
+}
+
+// isoMissing constructs an empty property element flagged as missing.
+func isoMissing(name string) isoElement {
+	return isoEl(name).isoAttr("gco:nilReason", "missing")
+}
+
+// isoIdentifier constructs a property element containing an mcc:MD_Identifier.
+func isoIdentifier(name, code, codespace string) isoElement {
+	ident := isoEl("mcc:MD_Identifier", isoString("mcc:code", code))
+	if codespace != "" {
+		ident.Children = append(ident.Children, isoString("mcc:codeSpace", codespace))
+	}
+	return isoEl(name, ident)
+}
+
+// isoDateTime formats a timestamp for use within gco:DateTime and gml elements.
+func isoDateTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// isoConformance constructs a DQ_ConformanceResult based report.
+func isoConformance(report, title, explanation string, pass bool) isoElement {
+	result := isoEl("mdq:DQ_ConformanceResult",
+		isoEl("mdq:specification", isoEl("cit:CI_Citation", isoString("cit:title", title))),
+		isoString("mdq:explanation", explanation),
+		isoEl("mdq:pass", isoValue("gco:Boolean", strconv.FormatBool(pass))),
+	)
+	return isoEl("mdq:report", isoEl(report, isoEl("mdq:result", result)))
+}
+
+// isoCount constructs a DQ_QuantitativeResult based report for a record count.
+func isoCount(measure string, count uint64) isoElement {
+	result := isoEl("mdq:DQ_QuantitativeResult",
+		isoEl("mdq:value", isoValue("gco:Record", strconv.FormatUint(count, 10))),
+	)
+	report := isoEl("mdq:DQ_CompletenessOmission",
+		isoEl("mdq:measure", isoEl("mdq:DQ_MeasureReference", isoString("mdq:nameOfMeasure", measure))),
+		isoEl("mdq:result", result),
+	)
+	return isoEl("mdq:report", report)
+}
+
+// isoReferenceSystems constructs the horizontal and vertical reference system
+// elements. Where the horizontal datum resolves to an EPSG code, the EPSG
+// code is used as the identifier, otherwise the datum name is used as is.
+func isoReferenceSystems(crs *Crs) []isoElement {
+	var code, codespace string
+
+	epsg, ok := crs.Epsg()
+	if ok {
+		code = strconv.Itoa(epsg)
+		codespace = "EPSG"
+	} else {
+		code = crs.Horizontal_Datum
+	}
+
+	horizontal := isoEl("mdb:referenceSystemInfo", isoEl("mrs:MD_ReferenceSystem",
+		isoIdentifier("mrs:referenceSystemIdentifier", code, codespace),
+		isoCode("mrs:referenceSystemType", "mrs:MD_ReferenceSystemTypeCode", "geodeticGeographic2D"),
+	))
+
+	vertical := isoEl("mdb:referenceSystemInfo", isoEl("mrs:MD_ReferenceSystem",
+		isoIdentifier("mrs:referenceSystemIdentifier", crs.Vertical_Datum, ""),
+		isoCode("mrs:referenceSystemType", "mrs:MD_ReferenceSystemTypeCode", "vertical"),
+	))
+
+	return []isoElement{horizontal, vertical}
+}
+
+// isoExtent constructs the geographic, temporal and vertical extent from the
+// SWATH_BATHY_SUMMARY record. Depths are positive down, so the vertical extent
+// is expressed as heights (negated depths) to be consistent with the Z values
+// of the beam data. The vertical extent is omitted if vertical is false.
+func isoExtent(summary *SwathBathySummary, vertical bool) isoElement {
+	decimal := func(name string, value float64) isoElement {
+		return isoEl(name, isoValue("gco:Decimal", strconv.FormatFloat(value, 'f', -1, 64)))
+	}
+	real := func(name string, value float64) isoElement {
+		return isoEl(name, isoValue("gco:Real", strconv.FormatFloat(value, 'f', -1, 64)))
+	}
+
+	bbox := isoEl("gex:EX_GeographicBoundingBox",
+		decimal("gex:westBoundLongitude", summary.Min_longitude),
+		decimal("gex:eastBoundLongitude", summary.Max_longitude),
+		decimal("gex:southBoundLatitude", summary.Min_latitude),
+		decimal("gex:northBoundLatitude", summary.Max_latitude),
+	)
+
+	period := isoEl("gml:TimePeriod",
+		isoValue("gml:beginPosition", isoDateTime(summary.Start_datetime)),
+		isoValue("gml:endPosition", isoDateTime(summary.End_datetime)),
+	).isoAttr("gml:id", "swath-time-period")
+
+	extent := isoEl("gex:EX_Extent",
+		isoEl("gex:geographicElement", bbox),
+		isoEl("gex:temporalElement", isoEl("gex:EX_TemporalExtent", isoEl("gex:extent", period))),
+	)
+
+	if vertical {
+		extent.Children = append(extent.Children, isoEl("gex:verticalElement", isoEl("gex:EX_VerticalExtent",
+			real("gex:minimumValue", -summary.Max_depth),
+			real("gex:maximumValue", -summary.Min_depth),
+		)))
+	}
+
+	return isoEl("mri:extent", extent)
+}
+
+// isoLineage constructs the resource lineage, with each HISTORY record
+// represented as a process step.
+func isoLineage(gsf_uri string, histories []History) isoElement {
+	lineage := isoEl("mrl:LI_Lineage",
+		isoString("mrl:statement", "Swath bathymetry sourced from the GSF file "+gsf_uri),
+	)
+
+	for i, hist := range histories {
+		description := hist.Command
+		if hist.Value != "" {
+			description = description + "; " + hist.Value
+		}
+		if hist.Machine_name != "" {
+			description = description + " (machine: " + hist.Machine_name + ")"
+		}
+
+		instant := isoEl("gml:TimeInstant",
+			isoValue("gml:timePosition", isoDateTime(hist.Processing_timestamp)),
+		).isoAttr("gml:id", "history-"+strconv.Itoa(i))
+
+		processor := isoEl("cit:CI_Responsibility",
+			isoCode("cit:role", "cit:CI_RoleCode", "processor"),
+			isoEl("cit:party", isoEl("cit:CI_Individual", isoString("cit:name", hist.Operator_name))),
+		)
+
+		step := isoEl("mrl:LI_ProcessStep",
+			isoString("mrl:description", description),
+			isoEl("mrl:stepDateTime", instant),
+			isoEl("mrl:processor", processor),
+		)
+
+		lineage.Children = append(lineage.Children, isoEl("mrl:processStep", step))
+	}
+
+	return isoEl("mdb:resourceLineage", lineage)
+}
+
+// isoDataQuality constructs the data quality reports from the QualityInfo and
+// the record counts.
+func isoDataQuality(md *Metadata) isoElement {
+	qi := &md.Quality_Info
+	spec := "go-gsf general QA"
+
+	beams := "Beams per ping are not consistent"
+	if len(qi.Min_Max_Beams) == 2 {
+		beams = beams + "; min: " + strconv.Itoa(int(qi.Min_Max_Beams[0])) + ", max: " + strconv.Itoa(int(qi.Min_Max_Beams[1]))
+	}
+	if qi.Consistent_Beams {
+		beams = "Beams per ping are consistent"
+	}
+
+	duplicates := "No duplicate pings"
+	if qi.Duplicate_Pings {
+		duplicates = "Duplicate pings found: " + strconv.Itoa(len(qi.Duplicates))
+	}
+
+	dq := isoEl("mdq:DQ_DataQuality",
+		isoEl("mdq:scope", isoEl("mcc:MD_Scope", isoCode("mcc:level", "mcc:MD_ScopeCode", "dataset"))),
+		isoConformance("mdq:DQ_DomainConsistency", spec, beams, qi.Consistent_Beams),
+		isoConformance("mdq:DQ_DomainConsistency", spec, "Consistent sub-record schema across pings", qi.Consistent_Schema),
+		isoConformance("mdq:DQ_TemporalConsistency", spec, "No coincident pings", !qi.Coincident_Pings),
+		isoConformance("mdq:DQ_TemporalConsistency", spec, duplicates, !qi.Duplicate_Pings),
+	)
+
+	nav := &qi.Navigation
+	nav_reports := []struct {
+		report      string
+		explanation string
+		events      int
+	}{
+		{"mdq:DQ_TemporalConsistency", "Time gaps between pings", len(nav.Time_Gaps)},
+		{"mdq:DQ_TemporalConsistency", "Time reversals between pings", len(nav.Time_Reversals)},
+		{"mdq:DQ_AbsoluteExternalPositionalAccuracy", "Implied speed spikes between pings", len(nav.Speed_Spikes)},
+		{"mdq:DQ_DomainConsistency", "Heading jumps between pings", len(nav.Heading_Jumps)},
+		{"mdq:DQ_DomainConsistency", "Course jumps between pings", len(nav.Course_Jumps)},
+		{"mdq:DQ_CompletenessOmission", "Null ping positions", len(nav.Null_Positions)},
+	}
+	for _, nr := range nav_reports {
+		explanation := nr.explanation + ": " + strconv.Itoa(nr.events)
+		dq.Children = append(dq.Children, isoConformance(nr.report, "go-gsf navigation QA", explanation, nr.events == 0))
+	}
+
+	sv := &qi.Summary_Validation
+	if sv.Summary_Present {
+		explanation := "Swath bathymetry summary consistent with the ping data; discrepancies: " + strconv.Itoa(len(sv.Discrepancies))
+		dq.Children = append(dq.Children, isoConformance("mdq:DQ_DomainConsistency", spec, explanation, sv.Consistent))
+	}
+
+	att := &md.Attitude_Summary
+	att_gaps := "Attitude gaps larger than " + strconv.FormatFloat(att.Gap_tolerance, 'f', -1, 64) + "s: " + strconv.Itoa(len(att.Gaps))
+	dq.Children = append(dq.Children,
+		isoConformance("mdq:DQ_CompletenessOmission", "go-gsf attitude QA", "Attitude covers the ping time span", att.Covers_pings),
+		isoConformance("mdq:DQ_TemporalConsistency", "go-gsf attitude QA", att_gaps, len(att.Gaps) == 0),
+	)
+
+	names := make([]string, 0, len(md.Record_Counts))
+	for name := range md.Record_Counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dq.Children = append(dq.Children, isoCount(name+" record count", md.Record_Counts[name]))
+	}
+
+	return isoEl("mdb:dataQualityInfo", dq)
+}
+
+// IsoMetadata serialises the GSF Metadata and ProcessingInfo to an
+// ISO 19115-3 XML document.
+// Information that a GSF file doesn't contain such as contacts, is flagged
+// as missing, and is expected to be populated by downstream tooling.
+// The extent is sourced from the SWATH_BATHY_SUMMARY record, and falls back
+// to the SwathCoverage (without a vertical extent) when the GSF file contains
+// no summary record. The extent is omitted if neither is known.
+func IsoMetadata(md *Metadata, proc_info *ProcessingInfo, coverage *SwathCoverage) ([]byte, error) {
+	gsf_uri := md.GSF_Details.GSF_URI
+	file := filepath.Base(gsf_uri)
+
+	abstract := "Swath bathymetry acquired with a " + md.Sensor_Info.Sensor_Name +
+		" sensor, stored in the Generic Sensor Format (" + md.GSF_Details.GSF_Version + ")."
+
+	// comments are captured as supplemental information
+	comments := make([]string, 0, len(proc_info.Comments))
+	for _, cmt := range proc_info.Comments {
+		comments = append(comments, isoDateTime(cmt.Timestamp)+": "+cmt.Value)
+	}
+
+	identification := isoEl("mri:MD_DataIdentification",
+		isoEl("mri:citation", isoEl("cit:CI_Citation", isoString("cit:title", lineName(gsf_uri)))),
+		isoString("mri:abstract", abstract),
+		isoCode("mri:spatialRepresentationType", "mcc:MD_SpatialRepresentationTypeCode", "textTable"),
+		isoEl("mri:topicCategory", isoValue("mri:MD_TopicCategoryCode", "elevation")),
+	)
+
+	if md.Record_Counts[RecordNames[SWATH_BATHY_SUMMARY]] > 0 {
+		identification.Children = append(identification.Children, isoExtent(&md.Swath_Summary, true))
+	} else if bbox := coverage.bbox(); bbox != nil {
+		summary := SwathBathySummary{
+			Start_datetime: coverage.Start_datetime,
+			End_datetime:   coverage.End_datetime,
+			Min_longitude:  bbox[0],
+			Min_latitude:   bbox[1],
+			Max_longitude:  bbox[2],
+			Max_latitude:   bbox[3],
+		}
+		identification.Children = append(identification.Children, isoExtent(&summary, false))
+	}
+	if len(comments) > 0 {
+		identification.Children = append(
+			identification.Children,
+			isoString("mri:supplementalInformation", strings.Join(comments, "\n")),
+		)
+	}
+
+	size_mb := float64(md.GSF_Details.Size) / 1e6
+	distribution := isoEl("mrd:MD_Distribution",
+		isoEl("mrd:distributionFormat", isoEl("mrd:MD_Format",
+			isoEl("mrd:formatSpecificationCitation", isoEl("cit:CI_Citation",
+				isoString("cit:title", "Generic Sensor Format"),
+				isoString("cit:edition", md.GSF_Details.GSF_Version),
+			)),
+		)),
+		isoEl("mrd:transferOptions", isoEl("mrd:MD_DigitalTransferOptions",
+			isoEl("mrd:transferSize", isoValue("gco:Real", strconv.FormatFloat(size_mb, 'f', -1, 64))),
+			isoEl("mrd:onLine", isoEl("cit:CI_OnlineResource",
+				isoString("cit:linkage", gsf_uri),
+				isoString("cit:name", file),
+			)),
+		)),
+	)
+
+	instrument := isoEl("mac:MI_Instrument",
+		isoIdentifier("mac:identifier", strconv.Itoa(int(md.Sensor_Info.Sensor_ID)), "GSF sensor id"),
+		isoString("mac:type", md.Sensor_Info.Sensor_Name),
+	)
+
+	root := isoEl("mdb:MD_Metadata",
+		isoIdentifier("mdb:metadataIdentifier", file, ""),
+		isoEl("mdb:defaultLocale", isoEl("lan:PT_Locale",
+			isoCode("lan:language", "lan:LanguageCode", "eng"),
+			isoCode("lan:characterEncoding", "lan:MD_CharacterSetCode", "utf8"),
+		)),
+		isoEl("mdb:metadataScope", isoEl("mdb:MD_MetadataScope",
+			isoCode("mdb:resourceScope", "mcc:MD_ScopeCode", "dataset"),
+		)),
+		isoMissing("mdb:contact"),
+		isoEl("mdb:dateInfo", isoEl("cit:CI_Date",
+			isoEl("cit:date", isoValue("gco:DateTime", isoDateTime(time.Now()))),
+			isoCode("cit:dateType", "cit:CI_DateTypeCode", "creation"),
+		)),
+		isoEl("mdb:metadataStandard", isoEl("cit:CI_Citation",
+			isoString("cit:title", "ISO 19115-3"),
+		)),
+	)
+	root.Children = append(root.Children, isoReferenceSystems(&md.CRS)...)
+	root.Children = append(root.Children,
+		isoEl("mdb:identificationInfo", identification),
+		isoEl("mdb:distributionInfo", distribution),
+		isoDataQuality(md),
+		isoLineage(gsf_uri, proc_info.Histories),
+		isoEl("mdb:acquisitionInformation", isoEl("mac:MI_AcquisitionInformation",
+			isoEl("mac:instrument", instrument),
+		)),
+	)
+
+	for _, ns := range isoNamespaces {
+		root = root.isoAttr("xmlns:"+ns[0], ns[1])
+	}
+
+	data, err := xml.MarshalIndent(root, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,108 @@
+package gsf
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"outerBoundaryIs>LinearRing>coordinates"`
+}
+
+type kmlPlacemark struct {
+	Name         string         `xml:"name"`
+	TimeSpan     kmlTimeSpan    `xml:"TimeSpan"`
+	ExtendedData []kmlData      `xml:"ExtendedData>Data"`
+	LineString   *kmlLineString `xml:"LineString,omitempty"`
+	Polygon      *kmlPolygon    `xml:"Polygon,omitempty"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlRoot struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+// kmlCoordinates formats the LonLat type as a KML coordinate string of
+// space separated lon,lat tuples.
+func kmlCoordinates(ll *LonLat) string {
+	coords := make([]string, len(ll.Longitude))
+	for i := range ll.Longitude {
+		lon := strconv.FormatFloat(ll.Longitude[i], 'f', -1, 64)
+		lat := strconv.FormatFloat(ll.Latitude[i], 'f', -1, 64)
+		coords[i] = lon + "," + lat
+	}
+
+	return strings.Join(coords, " ")
+}
+
+// kmlPlacemarkBase constructs a placemark containing the attributes that are
+// common to each feature.
+func (sc *SwathCoverage) kmlPlacemarkBase(feature string) kmlPlacemark {
+	start := sc.Start_datetime.Format(time.RFC3339Nano)
+	end := sc.End_datetime.Format(time.RFC3339Nano)
+
+	return kmlPlacemark{
+		Name:     sc.Line_name + " " + feature,
+		TimeSpan: kmlTimeSpan{Begin: start, End: end},
+		ExtendedData: []kmlData{
+			{Name: "feature", Value: feature},
+			{Name: "line_name", Value: sc.Line_name},
+			{Name: "start_datetime", Value: start},
+			{Name: "end_datetime", Value: end},
+		},
+	}
+}
+
+// Kml serialises the trackline and swath footprint to a KML document.
+// Features without a valid geometry are excluded.
+func (sc *SwathCoverage) Kml() ([]byte, error) {
+	placemarks := make([]kmlPlacemark, 0, 2)
+
+	if sc.TracklineGeometry() != nil {
+		pm := sc.kmlPlacemarkBase("trackline")
+		pm.LineString = &kmlLineString{Tessellate: 1, Coordinates: kmlCoordinates(&sc.Trackline)}
+		placemarks = append(placemarks, pm)
+	}
+
+	if sc.FootprintGeometry() != nil {
+		pm := sc.kmlPlacemarkBase("footprint")
+		pm.Polygon = &kmlPolygon{Tessellate: 1, Coordinates: kmlCoordinates(&sc.Footprint)}
+		placemarks = append(placemarks, pm)
+	}
+
+	doc := kmlRoot{
+		Xmlns:    "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{Name: sc.Line_name, Placemarks: placemarks},
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,524 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+
+	tiledb "github.com/TileDB-Inc/TileDB-Go"
+	"github.com/samber/lo"
+)
+
+// BackscatterSource identifies the beam data used as the backscatter.
+type BackscatterSource string
+
+const (
+	// BS_TS_MEAN uses the mean of each beam's intensity time series (BrbIntensity.TsMean).
+	BS_TS_MEAN BackscatterSource = "ts_mean"
+
+	// BS_TIME_SERIES uses each sample of the intensity time series (BrbIntensity.TimeSeries).
+	BS_TIME_SERIES BackscatterSource = "time_series"
+
+	// BS_MEAN_CAL_AMPLITUDE uses the mean calibrated amplitude of each beam.
+	BS_MEAN_CAL_AMPLITUDE BackscatterSource = "mean_cal_amplitude"
+
+	// BS_MEAN_REL_AMPLITUDE uses the mean relative amplitude of each beam.
+	BS_MEAN_REL_AMPLITUDE BackscatterSource = "mean_rel_amplitude"
+)
+
+// BackscatterSources lists the supported backscatter sources.
+var BackscatterSources = []BackscatterSource{
+	BS_TS_MEAN,
+	BS_TIME_SERIES,
+	BS_MEAN_CAL_AMPLITUDE,
+	BS_MEAN_REL_AMPLITUDE,
+}
+
+// MOSAIC_REFERENCE_ANGLE is the incidence angle (degrees) that the
+// backscatter is normalised to when applying angle-varying gain.
+const MOSAIC_REFERENCE_ANGLE float64 = 45.0
+
+// number of 1 degree incidence angle bins used for the angular response
+const mosaicAngleBins = 90
+
+// MosaicLayers contains the backscatter (dB) placed into each cell of a
+// Mosaic. The cells are stored in row-major order, with the first row being
+// the northern most row. Cells without backscatter are NaN, with a Count of
+// zero.
+type MosaicLayers struct {
+	Backscatter []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Count       []uint32  `tiledb:"dtype=uint32,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// Mosaic is a regular grid of the backscatter, with the mosaic geometry and
+// coordinates defined by the RasterGeometry.
+// If Normalised is true, angle-varying gain has been applied, normalising the
+// backscatter to the Reference_angle.
+type Mosaic struct {
+	RasterGeometry
+	Source          BackscatterSource
+	Normalised      bool
+	Reference_angle float64
+	Layers          MosaicLayers
+}
+
+// mosaicMetadata is the mosaic geometry, spatial reference and backscatter
+// processing, as stored in the array metadata.
+type mosaicMetadata struct {
+	RasterGeometry
+	Source          BackscatterSource
+	Normalised      bool
+	Reference_angle float64
+}
+
+// mosaicCell accumulates the backscatter for a single mosaic cell, along with
+// the number of observations within each incidence angle bin.
+type mosaicCell struct {
+	count  uint32
+	sum    float64
+	angles map[int]uint32
+}
+
+// Mosaicker places backscatter into a regular grid, streaming over chunks of
+// PingData. The extent of the mosaic grows to contain the backscatter that
+// has been added.
+// Each beam's backscatter is spread along the beam's footprint, which is
+// taken as extending across track halfway to each of the neighbouring beams
+// within the ping. For BS_TIME_SERIES, the samples of each beam are spaced
+// evenly along the footprint, otherwise the beam's value is placed into each
+// cell that the footprint intersects.
+// If Normalise is true, the angular response (mean backscatter for each
+// 1 degree incidence angle bin) of all the added backscatter is removed, and
+// the backscatter normalised to MOSAIC_REFERENCE_ANGLE.
+type Mosaicker struct {
+	Resolution float64
+	Reference  SpatialReference
+	Crs        Crs
+	Source     BackscatterSource
+	Normalise  bool
+	cells      map[[2]int64]*mosaicCell
+	ar_sum     [mosaicAngleBins]float64
+	ar_count   [mosaicAngleBins]uint64
+}
+
+// NewMosaicker constructs a Mosaicker with the cell size given by resolution.
+// The spatial reference determines the mosaic coordinates; if it contains a
+// Projection, the projected coordinates are used, otherwise longitude and
+// latitude are used. The crs is the CRS of the GSF file.
+func NewMosaicker(resolution float64, sref *SpatialReference, crs Crs, source BackscatterSource, normalise bool) (*Mosaicker, error) {
+	if !(resolution > 0.0) {
+		return nil, errors.Join(ErrMosaic, errors.New("Mosaic resolution must be positive"))
+	}
+
+	if !lo.Contains(BackscatterSources, source) {
+		return nil, errors.Join(ErrMosaic, errors.New("Unsupported backscatter source: "+string(source)))
+	}
+
+	ms := Mosaicker{
+		Resolution: resolution,
+		Reference:  *sref,
+		Crs:        crs,
+		Source:     source,
+		Normalise:  normalise,
+		cells:      make(map[[2]int64]*mosaicCell),
+	}
+
+	return &ms, nil
+}
+
+// pingBeamRanges computes the [start, end) index range of the beams for each
+// ping contained within the PingData. The beams are either contiguous, with
+// Number_beams per ping, or padded (dense) to a constant number of beams
+// per ping. Nil is returned if the layout cannot be determined.
+func (pd *PingData) pingBeamRanges() [][2]int {
+	hdr := &pd.Ping_headers
+	nbeams := len(pd.Lon_lat.Longitude)
+	npings := len(hdr.Number_beams)
+	if npings == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, n := range hdr.Number_beams {
+		total += int(n)
+	}
+
+	stride := 0
+	if total != nbeams {
+		if nbeams%npings != 0 {
+			return nil
+		}
+		stride = nbeams / npings
+	}
+
+	ranges := make([][2]int, npings)
+	start := 0
+	for i, n := range hdr.Number_beams {
+		if stride > 0 {
+			start = i * stride
+		}
+		end := start + int(n)
+		if end > nbeams {
+			return nil
+		}
+		ranges[i] = [2]int{start, end}
+		start = end
+	}
+
+	return ranges
+}
+
+// incidenceAngle approximates the incidence angle (degrees) of a beam,
+// assuming a flat seafloor. The absolute BeamAngle is used if it exists,
+// otherwise the angle is derived from the beam's horizontal offset and depth.
+func incidenceAngle(ba *BeamArray, i int) float64 {
+	if len(ba.BeamAngle) > i {
+		return math.Abs(float64(ba.BeamAngle[i]))
+	}
+
+	if len(ba.AcrossTrack) > i && len(ba.Z) > i {
+		along := 0.0
+		if len(ba.AlongTrack) > i {
+			along = ba.AlongTrack[i]
+		}
+		return math.Atan2(math.Hypot(ba.AcrossTrack[i], along), math.Abs(ba.Z[i])) * 180.0 / math.Pi
+	}
+
+	return math.NaN()
+}
+
+// beamBackscatter extracts the per-beam backscatter for the source.
+// Nil is returned if the beam data doesn't contain the source, or for
+// BS_TIME_SERIES, where the samples are extracted by beamSamples.
+func beamBackscatter(pd *PingData, source BackscatterSource, nbeams int) []float64 {
+	var values []float64
+
+	switch source {
+	case BS_TS_MEAN:
+		if len(pd.Brb_intensity.TsMean) == nbeams {
+			values = pd.Brb_intensity.TsMean
+		}
+	case BS_MEAN_CAL_AMPLITUDE:
+		if len(pd.Beam_array.MeanCalAmplitude) == nbeams {
+			values = lo.Map(pd.Beam_array.MeanCalAmplitude, func(v float32, _ int) float64 { return float64(v) })
+		}
+	case BS_MEAN_REL_AMPLITUDE:
+		if len(pd.Beam_array.MeanRelAmplitude) == nbeams {
+			values = lo.Map(pd.Beam_array.MeanRelAmplitude, func(v float32, _ int) float64 { return float64(v) })
+		}
+	}
+
+	return values
+}
+
+// beamSamples computes the offset into BrbIntensity.TimeSeries of each beam's
+// samples. Beams without samples contain a single NaN sample. Nil is returned
+// if the sample counts are inconsistent with the time series.
+func beamSamples(brb *BrbIntensity, nbeams int) []int {
+	if len(brb.sample_count) != nbeams {
+		return nil
+	}
+
+	offsets := make([]int, nbeams+1)
+	for i, n := range brb.sample_count {
+		if n == 0 {
+			n = 1
+		}
+		offsets[i+1] = offsets[i] + int(n)
+	}
+
+	if offsets[nbeams] != len(brb.TimeSeries) {
+		return nil
+	}
+
+	return offsets
+}
+
+// add accumulates a single backscatter value into the cell given by key.
+func (ms *Mosaicker) add(key [2]int64, value float64, angle_bin int) {
+	cell, ok := ms.cells[key]
+	if !ok {
+		cell = &mosaicCell{}
+		if ms.Normalise {
+			cell.angles = make(map[int]uint32)
+		}
+		ms.cells[key] = cell
+	}
+
+	cell.count++
+	cell.sum += value
+	if ms.Normalise {
+		cell.angles[angle_bin]++
+	}
+
+	ms.ar_sum[angle_bin] += value
+	ms.ar_count[angle_bin]++
+}
+
+// Add places the backscatter of the georeferenced beams of the PingData into
+// the mosaic. Only beams that are not rejected (see BeamFlag.IsRejected, if
+// the beam flags exist) with a valid position and incidence angle are included.
+func (ms *Mosaicker) Add(pd *PingData) {
+	ba := &pd.Beam_array
+	x := pd.Lon_lat.Longitude
+	y := pd.Lon_lat.Latitude
+	if ms.Reference.Projection != nil {
+		x = pd.Easting_northing.Easting
+		y = pd.Easting_northing.Northing
+	}
+
+	nbeams := len(pd.Lon_lat.Longitude)
+	if len(x) != nbeams || len(y) != nbeams {
+		return
+	}
+
+	var (
+		values  []float64
+		offsets []int
+	)
+
+	if ms.Source == BS_TIME_SERIES {
+		offsets = beamSamples(&pd.Brb_intensity, nbeams)
+		if offsets == nil {
+			return
+		}
+	} else {
+		values = beamBackscatter(pd, ms.Source, nbeams)
+		if values == nil {
+			return
+		}
+	}
+
+	ranges := pd.pingBeamRanges()
+	has_flags := len(ba.BeamFlags) == nbeams
+
+	for _, rng := range ranges {
+		// beams with a valid position define the footprints
+		valid := make([]int, 0, rng[1]-rng[0])
+		for i := rng[0]; i < rng[1]; i++ {
+			if pd.Lon_lat.Longitude[i] == NULL_LONGITUDE_F64 || pd.Lon_lat.Latitude[i] == NULL_LATITUDE_F64 {
+				continue
+			}
+			if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+				continue
+			}
+			valid = append(valid, i)
+		}
+
+		for k, i := range valid {
+			if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+				continue
+			}
+
+			angle := incidenceAngle(ba, i)
+			if math.IsNaN(angle) || angle >= float64(mosaicAngleBins) {
+				continue
+			}
+			angle_bin := int(angle)
+
+			// footprint extends halfway to each neighbouring beam, and is
+			// mirrored for the outermost beams
+			x0, y0, x1, y1 := x[i], y[i], x[i], y[i]
+			if k > 0 {
+				x0 = (x[valid[k-1]] + x[i]) / 2.0
+				y0 = (y[valid[k-1]] + y[i]) / 2.0
+			}
+			if k < len(valid)-1 {
+				x1 = (x[valid[k+1]] + x[i]) / 2.0
+				y1 = (y[valid[k+1]] + y[i]) / 2.0
+			}
+			if k == 0 {
+				x0 = 2.0*x[i] - x1
+				y0 = 2.0*y[i] - y1
+			}
+			if k == len(valid)-1 {
+				x1 = 2.0*x[i] - x0
+				y1 = 2.0*y[i] - y0
+			}
+
+			if ms.Source == BS_TIME_SERIES {
+				samples := pd.Brb_intensity.TimeSeries[offsets[i]:offsets[i+1]]
+				n := float64(len(samples))
+				for j, value := range samples {
+					if math.IsNaN(value) {
+						continue
+					}
+					frac := (float64(j) + 0.5) / n
+					key := cellKey(x0+frac*(x1-x0), y0+frac*(y1-y0), ms.Resolution)
+					ms.add(key, value, angle_bin)
+				}
+				continue
+			}
+
+			value := values[i]
+			if math.IsNaN(value) {
+				continue
+			}
+
+			// sample the footprint at half the resolution, adding the beam's
+			// value once to each cell intersected
+			npoints := int(math.Ceil(math.Hypot(x1-x0, y1-y0)/(ms.Resolution/2.0))) + 1
+			keys := make(map[[2]int64]bool, npoints)
+			for j := 0; j < npoints; j++ {
+				frac := (float64(j) + 0.5) / float64(npoints)
+				key := cellKey(x0+frac*(x1-x0), y0+frac*(y1-y0), ms.Resolution)
+				if keys[key] {
+					continue
+				}
+				keys[key] = true
+				ms.add(key, value, angle_bin)
+			}
+		}
+	}
+}
+
+// AngularResponse returns the mean backscatter for each 1 degree incidence
+// angle bin of all the added backscatter. Bins without backscatter are NaN.
+func (ms *Mosaicker) AngularResponse() []float64 {
+	ar := make([]float64, mosaicAngleBins)
+	for i := range ar {
+		ar[i] = math.NaN()
+		if ms.ar_count[i] > 0 {
+			ar[i] = ms.ar_sum[i] / float64(ms.ar_count[i])
+		}
+	}
+
+	return ar
+}
+
+// referenceResponse returns the angular response at the reference angle,
+// or at the nearest bin containing backscatter.
+func referenceResponse(ar []float64, reference_angle float64) float64 {
+	ref := int(reference_angle)
+	for offset := 0; offset < len(ar); offset++ {
+		if ref-offset >= 0 && ref-offset < len(ar) && !math.IsNaN(ar[ref-offset]) {
+			return ar[ref-offset]
+		}
+		if ref+offset < len(ar) && !math.IsNaN(ar[ref+offset]) {
+			return ar[ref+offset]
+		}
+	}
+
+	return math.NaN()
+}
+
+// Mosaic computes the backscatter for each cell and constructs the Mosaic,
+// applying the angle-varying gain normalisation if required.
+// The returned bool is false if no backscatter has been added.
+func (ms *Mosaicker) Mosaic() (Mosaic, bool) {
+	var mosaic Mosaic
+
+	mosaic.Resolution = ms.Resolution
+	mosaic.Crs = ms.Crs
+	mosaic.Projection = ms.Reference.Projection
+	mosaic.Source = ms.Source
+	mosaic.Normalised = ms.Normalise
+	if ms.Normalise {
+		mosaic.Reference_angle = MOSAIC_REFERENCE_ANGLE
+	}
+
+	if len(ms.cells) == 0 {
+		return mosaic, false
+	}
+
+	geom, min_col, max_row := rasterExtent(lo.Keys(ms.cells), ms.Resolution)
+	mosaic.X_origin = geom.X_origin
+	mosaic.Y_origin = geom.Y_origin
+	mosaic.Columns = geom.Columns
+	mosaic.Rows = geom.Rows
+
+	ncells := int(mosaic.Columns * mosaic.Rows)
+	layers := MosaicLayers{
+		Backscatter: make([]float32, ncells),
+		Count:       make([]uint32, ncells),
+	}
+
+	nan := float32(math.NaN())
+	for i := 0; i < ncells; i++ {
+		layers.Backscatter[i] = nan
+	}
+
+	ar := ms.AngularResponse()
+	ar_ref := referenceResponse(ar, MOSAIC_REFERENCE_ANGLE)
+
+	for key, cell := range ms.cells {
+		idx := mosaic.cellIndex(key, min_col, max_row)
+		value := cell.sum / float64(cell.count)
+
+		if ms.Normalise {
+			// the correction is additive in dB, so the mean of the
+			// normalised backscatter is the mean less the mean response
+			response := 0.0
+			for bin, n := range cell.angles {
+				response += float64(n) * ar[bin]
+			}
+			value = value - response/float64(cell.count) + ar_ref
+		}
+
+		layers.Count[idx] = cell.count
+		layers.Backscatter[idx] = float32(value)
+	}
+
+	mosaic.Layers = layers
+
+	return mosaic, true
+}
+
+// ToTileDB writes the Mosaic to a dense TileDB array using [Row, Column] as
+// the dimensional axes. The mosaic geometry (origin, resolution, CRS,
+// projection) and the backscatter source and normalisation are written to
+// the array metadata under the key "Mosaic".
+func (m *Mosaic) ToTileDB(array_uri string, ctx *tiledb.Context) error {
+	md := mosaicMetadata{
+		RasterGeometry:  m.RasterGeometry,
+		Source:          m.Source,
+		Normalised:      m.Normalised,
+		Reference_angle: m.Reference_angle,
+	}
+
+	err := m.writeRasterTileDB(ctx, array_uri, &m.Layers, "Mosaic", md)
+	if err != nil {
+		return errors.Join(ErrMosaic, err)
+	}
+
+	return nil
+}
+
+// ReadMosaicTileDB reads a Mosaic, previously written by Mosaic.ToTileDB,
+// from a dense TileDB array.
+func ReadMosaicTileDB(ctx *tiledb.Context, array_uri string) (Mosaic, error) {
+	var (
+		mosaic Mosaic
+		md     mosaicMetadata
+	)
+
+	geom, err := readRasterTileDB(ctx, array_uri, "Mosaic", &md, &mosaic.Layers)
+	if err != nil {
+		return mosaic, errors.Join(ErrMosaic, err)
+	}
+
+	mosaic.RasterGeometry = geom
+	mosaic.Source = md.Source
+	mosaic.Normalised = md.Normalised
+	mosaic.Reference_angle = md.Reference_angle
+
+	return mosaic, nil
+}
+
+// GeoTiff constructs a GeoTiff from the mosaic layers, using NaN as the no
+// data value. The Count layer is converted to Float32, with zero counts as
+// no data.
+func (m *Mosaic) GeoTiff(compression TiffCompression) GeoTiff {
+	count := make([]float32, len(m.Layers.Count))
+	for i, c := range m.Layers.Count {
+		count[i] = float32(c)
+		if c == 0 {
+			count[i] = float32(math.NaN())
+		}
+	}
+
+	gt := m.geoTiff(compression)
+	gt.Band_names = []string{"Backscatter", "Count"}
+	gt.Bands = [][]float32{m.Layers.Backscatter, count}
+
+	return gt
+}
@@ -0,0 +1,162 @@
+package gsf
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestPingBeamRanges checks the beam ranges of contiguous and padded (dense)
+// beams, and that nil is returned when the layout cannot be determined.
+func TestPingBeamRanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		number_beams []uint16
+		nbeams       int
+		ranges       [][2]int
+	}{
+		{"contiguous", []uint16{3, 0, 2}, 5, [][2]int{{0, 3}, {3, 3}, {3, 5}}},
+		{"dense", []uint16{3, 1, 2}, 9, [][2]int{{0, 3}, {3, 4}, {6, 8}}},
+		{"dense without beams", []uint16{0, 2}, 4, [][2]int{{0, 0}, {2, 4}}},
+		{"inconsistent", []uint16{3, 1, 2}, 7, nil},
+		{"exceeds the padding", []uint16{2, 5}, 6, nil},
+		{"no pings", nil, 0, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pd PingData
+			pd.Ping_headers.Number_beams = test.number_beams
+			pd.Lon_lat.Longitude = make([]float64, test.nbeams)
+			pd.Lon_lat.Latitude = make([]float64, test.nbeams)
+
+			ranges := pd.pingBeamRanges()
+			if !reflect.DeepEqual(ranges, test.ranges) {
+				t.Errorf("got %v, want %v", ranges, test.ranges)
+			}
+		})
+	}
+}
+
+// mosaicObservations adds backscatter to cells (column, row) in a single
+// row; (0, 0) observed at the reference angle, (1, 0) observed only at
+// 10 degrees, (2, 0) observed at both 30 and 45 degrees, and (3, 0) observed
+// at 30 degrees.
+func mosaicObservations(ms *Mosaicker) {
+	ms.add([2]int64{0, 0}, -20.0, 45)
+	ms.add([2]int64{0, 0}, -22.0, 45)
+	ms.add([2]int64{1, 0}, -10.0, 10)
+	ms.add([2]int64{1, 0}, -14.0, 10)
+	ms.add([2]int64{2, 0}, -24.0, 45)
+	ms.add([2]int64{2, 0}, -15.0, 30)
+	ms.add([2]int64{3, 0}, -17.0, 30)
+}
+
+// TestMosaicNormalise checks the angle-varying gain normalisation, where the
+// mean response of each cell's incidence angles is replaced by the response
+// at the reference angle (value - response/count + ar_ref). The cell
+// observed at a single incidence angle normalises to the reference response.
+func TestMosaicNormalise(t *testing.T) {
+	ms, err := NewMosaicker(1.0, &SpatialReference{}, Crs{}, BS_MEAN_CAL_AMPLITUDE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mosaicObservations(ms)
+
+	ar := ms.AngularResponse()
+	for i, v := range ar {
+		want := math.NaN()
+		switch i {
+		case 10:
+			want = -12.0
+		case 30:
+			want = -16.0
+		case 45:
+			want = -22.0
+		}
+		if v != want && !(math.IsNaN(v) && math.IsNaN(want)) {
+			t.Errorf("angular response bin %d: got %v, want %v", i, v, want)
+		}
+	}
+
+	mosaic, ok := ms.Mosaic()
+	if !ok {
+		t.Fatal("expected a mosaic")
+	}
+	if !mosaic.Normalised || mosaic.Reference_angle != MOSAIC_REFERENCE_ANGLE {
+		t.Errorf("got normalised %v at %v degrees", mosaic.Normalised, mosaic.Reference_angle)
+	}
+	if mosaic.Columns != 4 || mosaic.Rows != 1 {
+		t.Fatalf("shape: got (%d, %d), want (1, 4)", mosaic.Rows, mosaic.Columns)
+	}
+
+	ar_ref := -22.0
+	want := []float64{
+		-21.0 - (-22.0) + ar_ref,
+		-12.0 - (-12.0) + ar_ref,
+		-19.5 - (-22.0-16.0)/2.0 + ar_ref,
+		-17.0 - (-16.0) + ar_ref,
+	}
+	counts := []uint32{2, 2, 2, 1}
+	for i := range want {
+		if math.Abs(float64(mosaic.Layers.Backscatter[i])-want[i]) > 1e-6 {
+			t.Errorf("cell %d: got %v, want %v", i, mosaic.Layers.Backscatter[i], want[i])
+		}
+		if mosaic.Layers.Count[i] != counts[i] {
+			t.Errorf("cell %d count: got %d, want %d", i, mosaic.Layers.Count[i], counts[i])
+		}
+	}
+
+	if mosaic.Layers.Backscatter[1] != float32(ar_ref) {
+		t.Errorf("single angle cell: got %v, want the reference response %v", mosaic.Layers.Backscatter[1], ar_ref)
+	}
+}
+
+// TestMosaicUnnormalised checks that the backscatter is the mean of each
+// cell's observations when the normalisation isn't applied.
+func TestMosaicUnnormalised(t *testing.T) {
+	ms, err := NewMosaicker(1.0, &SpatialReference{}, Crs{}, BS_MEAN_CAL_AMPLITUDE, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mosaicObservations(ms)
+
+	mosaic, ok := ms.Mosaic()
+	if !ok {
+		t.Fatal("expected a mosaic")
+	}
+	if mosaic.Normalised || mosaic.Reference_angle != 0.0 {
+		t.Errorf("got normalised %v at %v degrees", mosaic.Normalised, mosaic.Reference_angle)
+	}
+
+	want := []float32{-21.0, -12.0, -19.5, -17.0}
+	for i := range want {
+		if mosaic.Layers.Backscatter[i] != want[i] {
+			t.Errorf("cell %d: got %v, want %v", i, mosaic.Layers.Backscatter[i], want[i])
+		}
+	}
+}
+
+// TestReferenceResponse checks that the nearest bin containing backscatter
+// is used when the reference angle bin is empty.
+func TestReferenceResponse(t *testing.T) {
+	ar := make([]float64, mosaicAngleBins)
+	for i := range ar {
+		ar[i] = math.NaN()
+	}
+
+	if got := referenceResponse(ar, MOSAIC_REFERENCE_ANGLE); !math.IsNaN(got) {
+		t.Errorf("empty response: got %v, want NaN", got)
+	}
+
+	ar[30] = -16.0
+	ar[52] = -25.0
+	if got := referenceResponse(ar, MOSAIC_REFERENCE_ANGLE); got != -25.0 {
+		t.Errorf("got %v, want -25", got)
+	}
+
+	ar[45] = -22.0
+	if got := referenceResponse(ar, MOSAIC_REFERENCE_ANGLE); got != -22.0 {
+		t.Errorf("got %v, want -22", got)
+	}
+}
@@ -3,6 +3,8 @@ package gsf
 import (
 	"errors"
 	"math"
+	"reflect"
+	"time"
 
 	"github.com/samber/lo"
 )
@@ -40,6 +42,76 @@ func (pd *PingData) fillNulls(singlePing *PingData, sensor_id SubRecordID) error
 	return nil
 }
 
+// appendNullRow appends a single null value to every (initialised) exported
+// slice field of the struct pointed to by t, including the slice fields of
+// any nested structs. Strings are filled with "NULL", timestamps with the
+// UNIX epoch, and all other types with their zero value.
+func appendNullRow(t any) {
+	values := reflect.ValueOf(t).Elem()
+	types := values.Type()
+
+	for i := 0; i < values.NumField(); i++ {
+		fld := values.Field(i)
+		if !types.Field(i).IsExported() {
+			continue
+		}
+
+		switch fld.Kind() {
+		case reflect.Struct:
+			appendNullRow(fld.Addr().Interface())
+		case reflect.Slice:
+			if fld.IsNil() {
+				continue
+			}
+
+			value := reflect.Zero(fld.Type().Elem())
+			switch fld.Type().Elem() {
+			case timeType:
+				value = reflect.ValueOf(time.Unix(0, 0).UTC())
+			case reflect.TypeOf(""):
+				value = reflect.ValueOf("NULL")
+			}
+			fld.Set(reflect.Append(fld, value))
+		}
+	}
+}
+
+// appendNullPing appends a ping containing no beams, with null PingHeader,
+// SensorMetadata and (if contains_intensity) SensorImageryMetadata values.
+// This stands in for a ping that failed to decode, so that every ping within
+// a chunk retains its position (PING_ID) along the ping axis.
+func (pd *PingData) appendNullPing(sensor_id SubRecordID, contains_intensity bool) error {
+	hdr := &pd.Ping_headers
+	appendNullRow(hdr)
+
+	n := len(hdr.Number_beams) - 1
+	hdr.Longitude[n] = NULL_LONGITUDE_F64
+	hdr.Latitude[n] = NULL_LATITUDE_F64
+	hdr.Heading[n] = NULL_HEADING_F32
+	hdr.Pitch[n] = NULL_PITCH_F32
+	hdr.Roll[n] = NULL_ROLL_F32
+	hdr.Heave[n] = NULL_HEAVE_F32
+	hdr.Course[n] = NULL_COURSE_F32
+	hdr.Speed[n] = NULL_SPEED_F32
+
+	sen_md := newSensorMetadata(1, sensor_id)
+	appendNullRow(&sen_md)
+	err := pd.Sensor_metadata.appendSensorMetadata(&sen_md, sensor_id)
+	if err != nil {
+		return errors.Join(err, errors.New("Error appending SensorMetadata"))
+	}
+
+	if contains_intensity {
+		simd := nullSensorImagery(sensor_id)
+		err = pd.Sensor_imagery_metadata.appendSensorImageryMetadata(&simd, sensor_id)
+		if err != nil {
+			return errors.Join(err, errors.New("Error appending SensorImageryMetadata"))
+		}
+	}
+
+	return nil
+}
+
 // padDense pads the BeamArray, LatLon and BrbIntensity structures and their
 // numerous slices by a given size.
 // This padding is only applied when the beam data array is to be output as
@@ -156,6 +228,7 @@ func (pd *PingData) beamArrayNulls(size uint64, fields []string) error {
 				// pd.Brb_intensity.BottomDetect = append(pd.Brb_intensity.BottomDetect, NULL_FLOAT32_ZERO)
 				pd.Brb_intensity.BottomDetectIndex = append(pd.Brb_intensity.BottomDetectIndex, NULL_UINT16_ZERO)
 				pd.Brb_intensity.StartRange = append(pd.Brb_intensity.StartRange, NULL_UINT16_ZERO)
+				pd.Brb_intensity.TsMean = append(pd.Brb_intensity.TsMean, math.NaN())
 				pd.Brb_intensity.sample_count = append(pd.Brb_intensity.sample_count, uint16(0))
 			}
 		case SECTOR_NUMBER:
@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"log"
-	"path/filepath"
 	"reflect"
 	"strconv"
 	"time"
@@ -14,6 +13,10 @@ import (
 	"github.com/samber/lo"
 )
 
+// PING_CHUNK_SIZE is the number of pings that are decoded and combined into
+// a single block of data prior to serialisation.
+const PING_CHUNK_SIZE = 1000
+
 // PingHeader contains the base information recorded for every SWATH_BATHYMETRY_PING
 // record.
 type PingHeader struct {
@@ -214,12 +217,17 @@ type PingGroup struct {
 // The initial reasoning behind why, is to provide a basic descriptor
 // to inform a global schema across all pings, and derive max(n_beams) to
 // inform a global [ping, beam] dimensional array structure.
+// The position, heading and course are retained for the navigation QA.
 type PingInfo struct {
 	Timestamp     time.Time
 	Number_Beams  uint16
 	Sub_Records   []SubRecordID
 	Scale_Factors bool
 	scale_factors map[SubRecordID]ScaleFactor
+	longitude     float64
+	latitude      float64
+	heading       float32
+	course        float32
 }
 
 // PingData is the main type for holding all information relevant to n pings worth
@@ -231,7 +239,17 @@ type PingData struct {
 	Sensor_metadata         SensorMetadata
 	Sensor_imagery_metadata SensorImageryMetadata
 	Lon_lat                 LonLat
+	Easting_northing        EastingNorthing
+	Ping_attitude           PingAttitude
+	Ping_svp                PingSvp
+	Beam_flags              BeamFlagAttrs
+	Ping_rejected           PingRejected
+	Ping_statistics         PingStatistics
+	Ping_head               PingHead
+	Beam_s44                S44Attrs
+	Ping_s44                PingS44
 	n_pings                 uint64
+	ping_start              uint64
 	ba_subrecords           []string
 }
 
@@ -539,6 +557,10 @@ func ping_info(reader *bytes.Reader, rec RecordHdr, gsfd GsfDetails) PingInfo {
 	pinfo.Number_Beams = hdr.Number_beams
 	pinfo.Sub_Records = records[:]
 	pinfo.Scale_Factors = sf
+	pinfo.longitude = hdr.Longitude
+	pinfo.latitude = hdr.Latitude
+	pinfo.heading = hdr.Heading
+	pinfo.course = hdr.Course
 
 	if sf {
 		pinfo.scale_factors = scl_fac
@@ -1189,8 +1211,44 @@ func SwathBathymetryPingRec(buffer []byte, rec RecordHdr, pinfo PingInfo, sensor
 	return ping_data, err
 }
 
+// readPing seeks to and decodes a single SWATH_BATHYMETRY_PING record, where
+// idx is the ping's position (ping id) within the GSF file.
+// The beams are georeferenced using the method given by GsfFile.Georef, and
+// if GsfFile.Vertical is set, the Z values are reduced to that vertical reference.
+func (g *GsfFile) readPing(fi *FileInfo, idx uint64) (PingData, error) {
+	rec := fi.Index.Record_Index[RecordNames[SWATH_BATHYMETRY_PING]][idx]
+	pinfo := fi.Ping_Info[idx]
+	sensor_id := SubRecordID(fi.Metadata.Sensor_Info.Sensor_ID)
+
+	// seek to record
+	_, _ = g.Stream.Seek(rec.Byte_index, 0)
+
+	buffer := make([]byte, rec.Datasize)
+	_ = binary.Read(g.Stream, binary.BigEndian, &buffer)
+
+	ping_data, err := SwathBathymetryPingRec(buffer, rec, pinfo, sensor_id, fi.Metadata.GSF_Details)
+	if err != nil {
+		return ping_data, err
+	}
+
+	// re-georeference the beams on the ellipsoid of the horizontal datum
+	if g.Georef == GEOREF_GEODESIC {
+		hdr := &ping_data.Ping_headers
+		ellipsoid, _ := fi.Metadata.CRS.Ellipsoid()
+		ping_data.Lon_lat = ping_data.Beam_array.BeamsLonLatGeodesic(hdr.Longitude[0], hdr.Latitude[0], hdr.Heading[0], &ellipsoid)
+	}
+
+	if g.Vertical != nil {
+		err = ping_data.ReduceVertical(g.Vertical)
+	}
+
+	return ping_data, err
+}
+
 // writeBeamData serialises the beam data to a sparse TileDB array
-// using longitude and latitude as the dimensional axes.
+// using longitude and latitude (or projected coordinates) as the dimensional axes.
+// Nullable attributes are written with the beams rejected by their BeamFlags
+// as nulls.
 func (pd *PingData) writeBeamData(ctx *tiledb.Context, array *tiledb.Array, ping_beam_ids *PingBeamNumbers) error {
 	schema, err := array.Schema()
 	if err != nil {
@@ -1262,13 +1320,59 @@ func (pd *PingData) writeBeamData(ctx *tiledb.Context, array *tiledb.Array, ping
 
 	// dimensional axes buffers (or attributes depending on sparse/dense array)
 	// X & Y for sparse array
-	_, err = query.SetDataBuffer("X", pd.Lon_lat.Longitude)
+	// X & Y are the projected coordinates if the array contains Longitude and
+	// Latitude attributes, otherwise Easting and Northing may exist as attributes
+	x := pd.Lon_lat.Longitude
+	y := pd.Lon_lat.Latitude
+
+	projected_dims, err := schema.HasAttribute("Longitude")
+	if err != nil {
+		return err
+	}
+
+	has_en, err := schema.HasAttribute("Easting")
+	if err != nil {
+		return err
+	}
+
+	if projected_dims {
+		x = pd.Easting_northing.Easting
+		y = pd.Easting_northing.Northing
+
+		_, err = query.SetDataBuffer("Longitude", pd.Lon_lat.Longitude)
+		if err != nil {
+			errn := errors.New("Error setting TileDB data buffer for attribute: Longitude")
+			return errors.Join(err, errn)
+		}
+
+		_, err = query.SetDataBuffer("Latitude", pd.Lon_lat.Latitude)
+		if err != nil {
+			errn := errors.New("Error setting TileDB data buffer for attribute: Latitude")
+			return errors.Join(err, errn)
+		}
+	}
+
+	if has_en {
+		_, err = query.SetDataBuffer("Easting", pd.Easting_northing.Easting)
+		if err != nil {
+			errn := errors.New("Error setting TileDB data buffer for attribute: Easting")
+			return errors.Join(err, errn)
+		}
+
+		_, err = query.SetDataBuffer("Northing", pd.Easting_northing.Northing)
+		if err != nil {
+			errn := errors.New("Error setting TileDB data buffer for attribute: Northing")
+			return errors.Join(err, errn)
+		}
+	}
+
+	_, err = query.SetDataBuffer("X", x)
 	if err != nil {
 		errn := errors.New("Error setting TileDB data buffer for dimension/attribute: X")
 		return errors.Join(err, errn)
 	}
 
-	_, err = query.SetDataBuffer("Y", pd.Lon_lat.Latitude)
+	_, err = query.SetDataBuffer("Y", y)
 	if err != nil {
 		errn := errors.New("Error setting TileDB data buffer for dimension/attribute: Y")
 		return errors.Join(err, errn)
@@ -1531,6 +1635,68 @@ func (pd *PingData) writeBeamData(ctx *tiledb.Context, array *tiledb.Array, ping
 		}
 	}
 
+	// validity buffers for any nullable attributes, with the beams rejected
+	// by their BeamFlags being null
+	attrs, err := schema.Attributes()
+	if err != nil {
+		return err
+	}
+
+	var validity []uint8
+	for _, attr := range attrs {
+		nullable, err := attr.Nullable()
+		if err != nil {
+			attr.Free()
+			return err
+		}
+
+		name, err := attr.Name()
+		attr.Free()
+		if err != nil {
+			return err
+		}
+
+		if !nullable {
+			continue
+		}
+
+		if validity == nil {
+			validity = pd.beamValidity()
+		}
+
+		_, err = query.SetValidityBuffer(name, validity)
+		if err != nil {
+			errn := errors.New("Error setting TileDB validity buffer for attribute: " + name)
+			return errors.Join(err, errn)
+		}
+	}
+
+	// decoded beam flags
+	has_flags, err := schema.HasAttribute("FlagRejected")
+	if err != nil {
+		return err
+	}
+
+	if has_flags {
+		err = setStructFieldBuffers(query, &pd.Beam_flags)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing decoded BeamFlags"))
+		}
+	}
+
+	// S-44 compliance
+	has_s44, err := schema.HasAttribute("S44Compliance")
+	if err != nil {
+		return err
+	}
+
+	if has_s44 {
+		err = setStructFieldBuffers(query, &pd.Beam_s44)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing S-44 compliance"))
+		}
+	}
+
 	// write the data and flush
 	err = query.Submit()
 	if err != nil {
@@ -1551,7 +1717,9 @@ func (pd *PingData) writeBeamData(ctx *tiledb.Context, array *tiledb.Array, ping
 
 // writePingHeaders is a helper to serialise the PingHeaders
 // to the respective TileDB array.
-func (ph *PingHeaders) writePingHeaders(ctx *tiledb.Context, array *tiledb.Array, ping_start, ping_end uint64) error {
+// The PingStatistics, PingHead, and if populated, the PingAttitude, PingSvp,
+// PingRejected and PingS44 are written alongside the PingHeaders.
+func (pd *PingData) writePingHeaders(ctx *tiledb.Context, array *tiledb.Array, ping_start, ping_end uint64) error {
 	// query construction
 	query, err := tiledb.NewQuery(ctx, array)
 	if err != nil {
@@ -1579,11 +1747,49 @@ func (ph *PingHeaders) writePingHeaders(ctx *tiledb.Context, array *tiledb.Array
 		return errors.Join(ErrWriteMdTdb, err)
 	}
 
-	err = setStructFieldBuffers(query, ph)
+	err = setStructFieldBuffers(query, &pd.Ping_headers)
 	if err != nil {
 		return errors.Join(err, errors.New("Error writing PingHeaders"))
 	}
 
+	err = setStructFieldBuffers(query, &pd.Ping_statistics)
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing PingStatistics"))
+	}
+
+	err = setStructFieldBuffers(query, &pd.Ping_head)
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing PingHead"))
+	}
+
+	if len(pd.Ping_attitude.Attitude_gap) > 0 {
+		err = setStructFieldBuffers(query, &pd.Ping_attitude)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingAttitude"))
+		}
+	}
+
+	if len(pd.Ping_svp.Svp_index) > 0 {
+		err = setStructFieldBuffers(query, &pd.Ping_svp)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingSvp"))
+		}
+	}
+
+	if len(pd.Ping_rejected.Rejected_beams) > 0 {
+		err = setStructFieldBuffers(query, &pd.Ping_rejected)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingRejected"))
+		}
+	}
+
+	if len(pd.Ping_s44.S44_assessed) > 0 {
+		err = setStructFieldBuffers(query, &pd.Ping_s44)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingS44"))
+		}
+	}
+
 	// write the data flush
 	err = query.Submit()
 	if err != nil {
@@ -1606,13 +1812,27 @@ func (ph *PingHeaders) writePingHeaders(ctx *tiledb.Context, array *tiledb.Array
 // and PingBeamNumbers.
 // The ping metadata consists of the PingHeaders, sensor metadata, and
 // sensor imagery (if intensity exists)
-func (pd *PingData) toTileDB(ph_array, s_md_array, si_md_array, bd_array *tiledb.Array, ctx *tiledb.Context, ping_beam_ids *PingBeamNumbers, sensor_id SubRecordID, contains_intensity bool) error {
-	ping_start := ping_beam_ids.PingNumber[0]
-	end_idx := len(ping_beam_ids.PingNumber) - 1
-	ping_end := ping_beam_ids.PingNumber[end_idx]
+// If the reject_policy is REJECT_DROP, the rejected beams are removed from the
+// beam data after the ping metadata has been written.
+func (pd *PingData) toTileDB(ph_array, s_md_array, si_md_array, bd_array *tiledb.Array, ctx *tiledb.Context, ping_beam_ids *PingBeamNumbers, sensor_id SubRecordID, contains_intensity bool, reject_policy RejectPolicy) error {
+	err := pd.pingMetadataToTileDB(ph_array, s_md_array, si_md_array, ctx, sensor_id, contains_intensity)
+	if err != nil {
+		return err
+	}
+
+	return pd.beamDataToTileDB(bd_array, ctx, ping_beam_ids, reject_policy)
+}
+
+// pingMetadataToTileDB serialises the ping metadata; PingHeaders, sensor
+// metadata, and sensor imagery (if intensity exists) to TileDB arrays.
+// The ping range is defined by the pings of the chunk rather than the beams,
+// as pings can contain no beams.
+func (pd *PingData) pingMetadataToTileDB(ph_array, s_md_array, si_md_array *tiledb.Array, ctx *tiledb.Context, sensor_id SubRecordID, contains_intensity bool) error {
+	ping_start := pd.ping_start
+	ping_end := ping_start + uint64(len(pd.Ping_headers.Number_beams)) - 1
 
 	// PingHeaders
-	err := pd.Ping_headers.writePingHeaders(ctx, ph_array, ping_start, ping_end)
+	err := pd.writePingHeaders(ctx, ph_array, ping_start, ping_end)
 	if err != nil {
 		errn := errors.New("Error writing PingHeaders")
 		return errors.Join(err, errn)
@@ -1634,6 +1854,37 @@ func (pd *PingData) toTileDB(ph_array, s_md_array, si_md_array, bd_array *tiledb
 		}
 	}
 
+	return nil
+}
+
+// beamDataToTileDB serialises the beam data to a TileDB array.
+// If the reject_policy is REJECT_DROP, the rejected beams are dropped, and if
+// the array uses the projected coordinates as the dimensional axes, the beams
+// without a position are dropped.
+func (pd *PingData) beamDataToTileDB(bd_array *tiledb.Array, ctx *tiledb.Context, ping_beam_ids *PingBeamNumbers, reject_policy RejectPolicy) error {
+	if reject_policy == REJECT_DROP {
+		ping_beam_ids = pd.dropRejected(ping_beam_ids)
+	}
+
+	schema, err := bd_array.Schema()
+	if err != nil {
+		return errors.Join(err, errors.New("Error retrieving TileDB beam array schema"))
+	}
+	defer schema.Free()
+
+	projected_dims, err := schema.HasAttribute("Longitude")
+	if err != nil {
+		return err
+	}
+
+	if projected_dims {
+		ping_beam_ids = pd.dropUnprojected(ping_beam_ids)
+	}
+
+	if len(ping_beam_ids.PingNumber) == 0 {
+		return nil
+	}
+
 	// beam array data; BeamArray, PingBeamNumbers, LonLat, BrbIntensity
 	err = pd.writeBeamData(ctx, bd_array, ping_beam_ids)
 	if err != nil {
@@ -1644,132 +1895,54 @@ func (pd *PingData) toTileDB(ph_array, s_md_array, si_md_array, bd_array *tiledb
 	return nil
 }
 
-// SbpToTileDB converts SwathBathymetryPing Records to TileDB arrays.
-// Beam array data will be converted to a sparse point cloud using
-// longitude and latitude (named as X and Y) dimensional axes.
-// SensorMetadata and SensorImageryMetadata subrecords will be written to a dense
-// array along with the PingHeader data. This dense array will be single axis, using
-// pings [0, n] as the axis units, akin to a table of data with n-rows where n is
-// the number of pings.
-// As there potentially are a lot of ping records, this process will be chunked
-// into roughly chunks of 1000 pings in size given by:
-// github.com/samber/lo.Chunk([]ping_records, 1000).
-// In time (and interest), this chunk size can be made configurable.
-// There is potential to create the beam arrays as a 2D dense array using [ping, beam]
-// as the dimensional axes. The rationale is for input into algorithms that require
-// input based on the sensor configuration; such as a beam adjacency filter that
-// operates on a ping by ping basis.
-func (g *GsfFile) SbpToTileDB(fi *FileInfo, ctx *tiledb.Context, grp *tiledb.Group, outdir_uri string, dense_bd bool) error {
+// beamSchemaNames cleans up the sub-record names of the beam array schema
+// to match the BeamArray field names.
+func (fi *FileInfo) beamSchemaNames() []string {
+	sr_schema_c := make([]string, len(fi.SubRecord_Schema))
+	for k, v := range fi.SubRecord_Schema {
+		sr_schema_c[k] = pascalCase(v)
+	}
+
+	return sr_schema_c
+}
+
+// pingChunks reads and decodes the SWATH_BATHYMETRY_PING records in chunks
+// of PING_CHUNK_SIZE pings, combining each chunk into a single cohesive
+// PingData block that is handed to the write func along with the ping and
+// beam ids. The PingStatistics and PingHead are computed for each chunk.
+// When dense_bd is true, every ping is padded with nulls up to the
+// maximum number of beams found across the GSF file.
+// If GsfFile.Projection is set, the projected beam coordinates are computed
+// for each chunk, and the GsfFile.Processing is applied (see PingProcessing).
+// If the Reject_policy excludes rejected beams, the rejected beams of each
+// ping are counted.
+// Pings that fail to decode are logged and replaced by a null ping containing
+// no beams (padded with nulls when dense_bd is true), so that the PING_ID of
+// every ping remains its index within the GSF file.
+func (g *GsfFile) pingChunks(fi *FileInfo, dense_bd bool, write func(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error) error {
 	var (
 		ping_data       PingData
 		ping_data_chunk PingData
 		ping_beam_ids   PingBeamNumbers
 		err             error
 		number_beams    uint64
-
-		// declaring these so they can be passed through to various
-		// funcs, even if no intensity data is present
-		si_md_array *tiledb.Array
 	)
-	number_beams = 0
 
 	rec_name := RecordNames[SWATH_BATHYMETRY_PING]
 	total_pings := fi.Record_Counts[rec_name]
-	ping_records := fi.Index.Record_Index[rec_name]
 
-	// schema and cleanup subrecord names to match the BeamArray fields names
-	sr_schema := make([]string, 0, len(fi.SubRecord_Schema))
-	for _, v := range fi.SubRecord_Schema {
-		sr_schema = append(sr_schema, v)
-	}
-	sr_schema_c := make([]string, len(sr_schema))
-	for k, v := range sr_schema {
-		sr_schema_c[k] = pascalCase(v)
-	}
-
-	contains_intensity := lo.Contains(sr_schema, SubRecordNames[INTENSITY_SERIES])
+	sr_schema_c := fi.beamSchemaNames()
+	contains_intensity := lo.Contains(fi.SubRecord_Schema, SubRecordNames[INTENSITY_SERIES])
 	sensor_id := SubRecordID(fi.Metadata.Sensor_Info.Sensor_ID)
-
-	// output locations
-	ph_name := "PingHeader.tiledb"
-	ph_aname := "PingHeader"
-	s_md_name := "SensorMetadata.tiledb"
-	s_md_aname := "SensorMetadata"
-	si_md_name := "SensorImageryMetadata.tiledb"
-	si_md_aname := "SensorImageryMetadata"
-	bd_name := "BeamData.tiledb"
-	bd_aname := "BeamData"
-	ph_uri := filepath.Join(outdir_uri, ph_name)
-	s_md_uri := filepath.Join(outdir_uri, s_md_name)
-	si_md_uri := filepath.Join(outdir_uri, si_md_name)
-	bd_uri := filepath.Join(outdir_uri, bd_name)
-
-	err = fi.pingTdbArrays(ctx, ph_uri, s_md_uri, si_md_uri, bd_uri, dense_bd)
-	if err != nil {
-		return errors.Join(err, errors.New("Error creating PingData TileDB arrays"))
-	}
-
-	// add arrays to tiledb group
-	err = grp.AddMember(ph_name, ph_aname, true)
-	if err != nil {
-		return errors.Join(err, errors.New("Error adding ping headers to group"))
-	}
-	err = grp.AddMember(s_md_name, s_md_aname, true)
-	if err != nil {
-		return errors.Join(err, errors.New("Error adding sensor metadata to group"))
-	}
-	err = grp.AddMember(bd_name, bd_aname, true)
-	if err != nil {
-		return errors.Join(err, errors.New("Error adding beam data to group"))
-	}
-
-	// open the arrays for writing
-
-	// PingHeaders
-	ph_array, err := ArrayOpenWrite(ctx, ph_uri)
-	if err != nil {
-		return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) PingHeaders TileDB array"))
-	}
-	defer ph_array.Free()
-	defer ph_array.Close()
-
-	// SensorMetadata
-	s_md_array, err := ArrayOpenWrite(ctx, s_md_uri)
-	if err != nil {
-		return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) SensorMetadata TileDB array"))
-	}
-	defer s_md_array.Free()
-	defer s_md_array.Close()
-
-	// SensorImageryMetadata (only exists if intensity exists)
-	if contains_intensity {
-		err = grp.AddMember(si_md_name, si_md_aname, true)
-		if err != nil {
-			return errors.Join(err, errors.New("Error adding sensor imagery metadata to group"))
-		}
-
-		si_md_array, err = ArrayOpenWrite(ctx, si_md_uri)
-		if err != nil {
-			return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) SensorImageryMetadata TileDB array"))
-		}
-		defer si_md_array.Free()
-		defer si_md_array.Close()
-	}
-
-	// beam data; BeamArray, LonLat, PingBeamNumbers, BrbIntensity
-	bd_array, err := ArrayOpenWrite(ctx, bd_uri)
-	if err != nil {
-		return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) TileDB beam array"))
-	}
-	defer bd_array.Free()
-	defer bd_array.Close()
+	heads := newHeadTracker()
+	proc := &g.Processing
 
 	// setup the chunks to process
 	idxs := make([]uint64, total_pings)
 	for i := uint64(0); i < total_pings; i++ {
 		idxs[i] = i
 	}
-	chunks := lo.Chunk(idxs, int(1000))
+	chunks := lo.Chunk(idxs, PING_CHUNK_SIZE)
 
 	// need some info to initialise arrays that will get written into
 	// also need to cater for intensity, which at the moment are stored
@@ -1793,27 +1966,31 @@ func (g *GsfFile) SbpToTileDB(fi *FileInfo, ctx *tiledb.Context, grp *tiledb.Gro
 			ping_beam_ids = newPingBeamNumbers(int(number_beams))
 		}
 
+		ping_data_chunk.ping_start = chunk[0]
+
 		// for dense_ba, need to account for failed ping read and fill with nulls
 		// also need to account for adding null data for additional beams if ping.nbeams < max_beams
 
 		// loop over each ping for this chunk of pings
 		for _, idx := range chunk {
-			rec := ping_records[idx]
 			pinfo := fi.Ping_Info[idx]
 
-			// seek to record
-			_, _ = g.Stream.Seek(rec.Byte_index, 0)
-
-			buffer := make([]byte, rec.Datasize)
-			_ = binary.Read(g.Stream, binary.BigEndian, &buffer)
-			ping_data, err = SwathBathymetryPingRec(buffer, rec, pinfo, sensor_id, fi.Metadata.GSF_Details)
+			ping_data, err = g.readPing(fi, idx)
 			if err != nil {
 				// for the time being, rather than stop and return,
 				// log an issue, and keep processing
 				errn := errors.New("Error reading ping: " + strconv.Itoa(int(idx)))
 				// return errors.Join(err, errn)
 				log.Println(errors.Join(err, errn))
-				log.Println("Skipping PingID: ", idx)
+				log.Println("Null filling PingID: ", idx)
+
+				// retain the ping's position along the ping axis
+				_ = ping_data_chunk.appendNullPing(sensor_id, contains_intensity)
+				if dense_bd {
+					max_beams := fi.Metadata.Quality_Info.Min_Max_Beams[1]
+					_ = ping_data_chunk.padDense(max_beams)
+					_ = ping_beam_ids.padPingBeam(idx, 0, max_beams)
+				}
 				continue
 			}
 
@@ -1831,21 +2008,73 @@ func (g *GsfFile) SbpToTileDB(fi *FileInfo, ctx *tiledb.Context, grp *tiledb.Gro
 			}
 		}
 
-		// serialise chunk to the TileDB array
-		err = ping_data_chunk.toTileDB(
-			ph_array,
-			s_md_array,
-			si_md_array,
-			bd_array,
-			ctx,
-			&ping_beam_ids,
-			sensor_id,
-			contains_intensity,
-		)
+		if g.Projection != nil {
+			ping_data_chunk.Easting_northing = g.Projection.Project(&ping_data_chunk.Lon_lat)
+		}
+
+		if proc.Attitude != nil {
+			ping_data_chunk.Ping_attitude = proc.Attitude.Interpolate(ping_data_chunk.Ping_headers.Timestamp, proc.Attitude_tolerance)
+		}
+
+		if proc.Svp != nil {
+			hdr := &ping_data_chunk.Ping_headers
+			ping_data_chunk.Ping_svp = proc.Svp.Resolve(hdr.Timestamp, hdr.Longitude, hdr.Latitude)
+		}
+
+		ping_data_chunk.Ping_statistics = ping_data_chunk.pingStatistics()
+		ping_data_chunk.Ping_head = heads.identify(&ping_data_chunk, sensor_id)
+
+		if proc.Decode_flags {
+			ping_data_chunk.Beam_flags = DecodeBeamFlags(ping_data_chunk.Beam_array.BeamFlags)
+		}
+
+		if proc.Reject_policy.excludes() {
+			ping_data_chunk.Ping_rejected = ping_data_chunk.pingRejected()
+		}
+
+		if proc.Angular_response != nil {
+			proc.Angular_response.Add(&ping_data_chunk, sensor_id)
+		}
+
+		if proc.S44 != nil {
+			ping_data_chunk.Beam_s44, ping_data_chunk.Ping_s44 = proc.S44.Assess(&ping_data_chunk)
+		}
+
+		err = write(&ping_data_chunk, &ping_beam_ids)
 		if err != nil {
-			return errors.Join(err, errors.New("Error writing PingData chunk"))
+			return err
 		}
 	}
 
 	return nil
 }
+
+// SbpToTileDB converts SwathBathymetryPing Records to TileDB arrays.
+// Beam array data will be converted to a sparse point cloud using
+// longitude and latitude (named as X and Y) dimensional axes.
+// SensorMetadata and SensorImageryMetadata subrecords will be written to a dense
+// array along with the PingHeader data. This dense array will be single axis, using
+// pings [0, n] as the axis units, akin to a table of data with n-rows where n is
+// the number of pings.
+// As there potentially are a lot of ping records, this process will be chunked
+// into roughly chunks of 1000 pings in size given by:
+// github.com/samber/lo.Chunk([]ping_records, PING_CHUNK_SIZE).
+// In time (and interest), this chunk size can be made configurable.
+// There is potential to create the beam arrays as a 2D dense array using [ping, beam]
+// as the dimensional axes. The rationale is for input into algorithms that require
+// input based on the sensor configuration; such as a beam adjacency filter that
+// operates on a ping by ping basis.
+// This is a convenience wrapper around SbpToSink using a TileDBSink for
+// an existing TileDB group.
+func (g *GsfFile) SbpToTileDB(fi *FileInfo, ctx *tiledb.Context, grp *tiledb.Group, outdir_uri string, dense_bd bool) error {
+	// the group is owned by the caller, so only the ping arrays are closed
+	sink := TileDBSink{ctx: ctx, grp: grp, grp_uri: outdir_uri, dense_bd: dense_bd}
+	defer sink.closePings()
+
+	err := g.SbpToSink(fi, &sink)
+	if err != nil {
+		return err
+	}
+
+	return sink.closePings()
+}
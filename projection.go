@@ -0,0 +1,421 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EastingNorthing contains the projected coordinates for each beam in each ping.
+type EastingNorthing struct {
+	Easting  []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+	Northing []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// Projection defines a map projection used to convert longitude and latitude
+// coordinates to easting and northing coordinates in metres.
+// Supported projections are Universal Transverse Mercator (utm), Transverse
+// Mercator (tmerc) and Lambert Conformal Conic with two standard parallels (lcc).
+// The parameter names follow those used by PROJ.
+type Projection struct {
+	Name       string
+	Definition string
+	Epsg       int
+	Ellipsoid  Ellipsoid
+	Lon_0      float64
+	Lat_0      float64
+	Lat_1      float64
+	Lat_2      float64
+	K_0        float64
+	X_0        float64
+	Y_0        float64
+	Zone       int
+	South      bool
+	forward    func(lon, lat float64) (float64, float64)
+}
+
+// utmEpsgBase maps normalised horizontal datum names to the base EPSG code
+// for the [north, south] UTM zones, such that the EPSG code is base + zone.
+// A base of zero indicates that no EPSG code is defined for that hemisphere.
+var utmEpsgBase = map[string][2]int{
+	"wgs84":   {32600, 32700},
+	"wgs72":   {32200, 32300},
+	"nad83":   {26900, 0},
+	"nad27":   {26700, 0},
+	"etrs89":  {25800, 0},
+	"ed50":    {23000, 0},
+	"gda94":   {0, 28300},
+	"gda2020": {0, 7800},
+}
+
+// projEllipsoids maps PROJ ellipsoid names to the Ellipsoid type.
+var projEllipsoids = map[string]Ellipsoid{
+	"WGS84":  WGS84,
+	"GRS80":  GRS80,
+	"WGS72":  WGS72,
+	"intl":   INTERNATIONAL_1924,
+	"clrk66": CLARKE_1866,
+}
+
+// UtmZone determines the UTM zone and hemisphere for a given longitude and
+// latitude, including the exceptions for southern Norway and Svalbard.
+func UtmZone(lon, lat float64) (int, bool) {
+	lon = math.Mod(lon+540.0, 360.0) - 180.0
+	zone := int(math.Floor((lon+180.0)/6.0)) + 1
+	if zone > 60 {
+		zone = 60
+	}
+
+	switch {
+	case lat >= 56.0 && lat < 64.0 && lon >= 3.0 && lon < 12.0:
+		zone = 32
+	case lat >= 72.0 && lat < 84.0 && lon >= 0.0 && lon < 42.0:
+		switch {
+		case lon < 9.0:
+			zone = 31
+		case lon < 21.0:
+			zone = 33
+		case lon < 33.0:
+			zone = 35
+		default:
+			zone = 37
+		}
+	}
+
+	return zone, lat < 0.0
+}
+
+// NewUtmProjection constructs a UTM Projection for the given zone and
+// hemisphere, using the ellipsoid of the horizontal datum.
+// The EPSG code is populated if one is defined for the datum and zone.
+func NewUtmProjection(zone int, south bool, crs *Crs) Projection {
+	ellipsoid, _ := crs.Ellipsoid()
+
+	proj := Projection{
+		Name:      "utm",
+		Ellipsoid: ellipsoid,
+		Lon_0:     float64(zone)*6.0 - 183.0,
+		K_0:       0.9996,
+		X_0:       500000.0,
+		Zone:      zone,
+		South:     south,
+	}
+
+	if south {
+		proj.Y_0 = 10000000.0
+	}
+	proj.Definition = proj.utmDefinition()
+
+	base, ok := utmEpsgBase[normaliseDatum(crs.Horizontal_Datum)]
+	if ok {
+		hemisphere := 0
+		if south {
+			hemisphere = 1
+		}
+		if base[hemisphere] != 0 {
+			proj.Epsg = base[hemisphere] + zone
+		}
+	}
+	proj.forward = proj.forwardFunc()
+
+	return proj
+}
+
+// ParseProjection constructs a Projection from a PROJ style definition, eg
+// "+proj=tmerc +lon_0=147 +k_0=0.9996 +x_0=500000 +y_0=10000000" or
+// "+proj=lcc +lat_1=-36 +lat_2=-38 +lat_0=-37 +lon_0=145 +x_0=2500000 +y_0=2500000".
+// Supported projections are utm, tmerc and lcc. The ellipsoid is taken from
+// the +ellps parameter if given, otherwise from the horizontal datum.
+// For utm, the +zone parameter is required.
+func ParseProjection(definition string, crs *Crs) (Projection, error) {
+	var proj Projection
+
+	params := make(map[string]string)
+	for _, token := range strings.Fields(definition) {
+		key, val, _ := strings.Cut(strings.TrimPrefix(token, "+"), "=")
+		params[key] = val
+	}
+
+	values := make(map[string]float64)
+	for _, key := range []string{"lon_0", "lat_0", "lat_1", "lat_2", "k_0", "k", "x_0", "y_0", "zone", "a", "rf"} {
+		val, ok := params[key]
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return proj, errors.Join(ErrProjection, err, errors.New("Invalid value for parameter: "+key))
+		}
+		values[key] = f
+	}
+
+	switch params["proj"] {
+	case "utm":
+		zone, ok := values["zone"]
+		if !ok || zone < 1 || zone > 60 {
+			return proj, errors.Join(ErrProjection, errors.New("utm requires a +zone parameter between 1 and 60"))
+		}
+		_, south := params["south"]
+		proj = NewUtmProjection(int(zone), south, crs)
+	case "tmerc", "lcc":
+		proj.Name = params["proj"]
+		proj.Lon_0 = values["lon_0"]
+		proj.Lat_0 = values["lat_0"]
+		proj.Lat_1 = values["lat_1"]
+		proj.Lat_2 = values["lat_2"]
+		proj.X_0 = values["x_0"]
+		proj.Y_0 = values["y_0"]
+		proj.K_0 = 1.0
+		if k, ok := values["k"]; ok {
+			proj.K_0 = k
+		}
+		if k, ok := values["k_0"]; ok {
+			proj.K_0 = k
+		}
+		if _, ok := values["lat_2"]; !ok {
+			proj.Lat_2 = proj.Lat_1
+		}
+		proj.Ellipsoid, _ = crs.Ellipsoid()
+		proj.Definition = strings.Join(strings.Fields(definition), " ")
+	default:
+		return proj, errors.Join(ErrProjection, errors.New("Unsupported projection: "+params["proj"]))
+	}
+
+	// an explicit ellipsoid overrides the ellipsoid of the horizontal datum
+	ellps, has_ellps := params["ellps"]
+	a, has_a := values["a"]
+	rf, has_rf := values["rf"]
+	switch {
+	case has_ellps:
+		ellipsoid, ok := projEllipsoids[ellps]
+		if !ok {
+			return proj, errors.Join(ErrProjection, errors.New("Unsupported ellipsoid: "+ellps))
+		}
+		proj.Ellipsoid = ellipsoid
+		proj.Epsg = 0
+	case has_a && has_rf:
+		proj.Ellipsoid = Ellipsoid{"User defined", a, 1.0 / rf}
+		proj.Epsg = 0
+	case has_a || has_rf:
+		return proj, errors.Join(ErrProjection, errors.New("Both +a and +rf are required to define an ellipsoid"))
+	}
+
+	if proj.Name == "utm" {
+		proj.Definition = proj.utmDefinition()
+	} else if !has_ellps && !has_a {
+		proj.Definition += proj.ellipsoidDefinition()
+	}
+	proj.forward = proj.forwardFunc()
+
+	return proj, nil
+}
+
+// utmDefinition returns the PROJ definition of a UTM projection.
+func (p *Projection) utmDefinition() string {
+	definition := "+proj=utm +zone=" + strconv.Itoa(p.Zone)
+	if p.South {
+		definition += " +south"
+	}
+
+	return definition + p.ellipsoidDefinition()
+}
+
+// ellipsoidDefinition returns the PROJ parameters defining the ellipsoid.
+func (p *Projection) ellipsoidDefinition() string {
+	a := strconv.FormatFloat(p.Ellipsoid.A, 'f', -1, 64)
+	rf := strconv.FormatFloat(math.Round(1e9/p.Ellipsoid.Flattening)/1e9, 'f', -1, 64)
+
+	return " +a=" + a + " +rf=" + rf + " +units=m"
+}
+
+// forwardFunc returns a func that projects a single longitude and latitude
+// to an easting and northing. The constants of the projection are computed
+// once, so that the returned func can be applied to many coordinates.
+// The func is independent of the Projection, and is built by
+// NewUtmProjection and ParseProjection.
+func (p *Projection) forwardFunc() func(lon, lat float64) (float64, float64) {
+	if p.Name == "lcc" {
+		return p.lccForward()
+	}
+
+	return p.tmForward()
+}
+
+// tmForward sets up the Transverse Mercator projection using the Krüger
+// series (to 4th order in the third flattening) as described by
+// Karney (2011), Transverse Mercator with an accuracy of a few nanometers.
+// https://doi.org/10.1007/s00190-011-0445-3
+// The series are accurate to well below a millimetre within 4000km of the
+// central meridian.
+func (p *Projection) tmForward() func(lon, lat float64) (float64, float64) {
+	deg2rad := math.Pi / 180.0
+	f := p.Ellipsoid.Flattening
+	e := math.Sqrt(f * (2.0 - f))
+	n := f / (2.0 - f)
+	n2 := n * n
+	n3 := n2 * n
+	n4 := n3 * n
+
+	// rectifying radius
+	big_a := p.Ellipsoid.A / (1.0 + n) * (1.0 + n2/4.0 + n4/64.0)
+
+	alpha := [4]float64{
+		n/2.0 - 2.0/3.0*n2 + 5.0/16.0*n3 + 41.0/180.0*n4,
+		13.0/48.0*n2 - 3.0/5.0*n3 + 557.0/1440.0*n4,
+		61.0/240.0*n3 - 103.0/140.0*n4,
+		49561.0 / 161280.0 * n4,
+	}
+
+	// xi and eta for a given latitude and longitude difference (radians)
+	xi_eta := func(phi, lambda float64) (float64, float64) {
+		sin_phi := math.Sin(phi)
+		t := math.Sinh(math.Atanh(sin_phi) - e*math.Atanh(e*sin_phi))
+		xi_p := math.Atan2(t, math.Cos(lambda))
+		eta_p := math.Atanh(math.Sin(lambda) / math.Sqrt(1.0+t*t))
+
+		xi := xi_p
+		eta := eta_p
+		for j := 1; j <= 4; j++ {
+			k := 2.0 * float64(j)
+			xi += alpha[j-1] * math.Sin(k*xi_p) * math.Cosh(k*eta_p)
+			eta += alpha[j-1] * math.Cos(k*xi_p) * math.Sinh(k*eta_p)
+		}
+
+		return xi, eta
+	}
+
+	// meridian distance to the latitude of origin
+	xi_0, _ := xi_eta(deg2rad*p.Lat_0, 0.0)
+	m_0 := big_a * xi_0
+
+	lon_0, x_0, y_0, k_0 := p.Lon_0, p.X_0, p.Y_0, p.K_0
+
+	return func(lon, lat float64) (float64, float64) {
+		lambda := math.Mod(lon-lon_0+540.0, 360.0) - 180.0
+		xi, eta := xi_eta(deg2rad*lat, deg2rad*lambda)
+
+		easting := x_0 + k_0*big_a*eta
+		northing := y_0 + k_0*(big_a*xi-m_0)
+
+		return easting, northing
+	}
+}
+
+// lccForward sets up the Lambert Conformal Conic projection with two standard
+// parallels, following Snyder (1987), Map Projections: A Working Manual,
+// USGS Professional Paper 1395, pp. 107-109.
+// If both standard parallels are equal, the single standard parallel form is
+// used, with the scale factor applied along the parallel.
+func (p *Projection) lccForward() func(lon, lat float64) (float64, float64) {
+	deg2rad := math.Pi / 180.0
+	f := p.Ellipsoid.Flattening
+	e := math.Sqrt(f * (2.0 - f))
+
+	m := func(phi float64) float64 {
+		sin_phi := math.Sin(phi)
+		return math.Cos(phi) / math.Sqrt(1.0-e*e*sin_phi*sin_phi)
+	}
+
+	t := func(phi float64) float64 {
+		sin_phi := math.Sin(phi)
+		return math.Tan(math.Pi/4.0-phi/2.0) / math.Pow((1.0-e*sin_phi)/(1.0+e*sin_phi), e/2.0)
+	}
+
+	phi_1 := deg2rad * p.Lat_1
+	phi_2 := deg2rad * p.Lat_2
+	m_1 := m(phi_1)
+	t_1 := t(phi_1)
+
+	var n float64
+	if math.Abs(phi_1-phi_2) < 1e-10 {
+		n = math.Sin(phi_1)
+	} else {
+		n = (math.Log(m_1) - math.Log(m(phi_2))) / (math.Log(t_1) - math.Log(t(phi_2)))
+	}
+
+	big_f := m_1 / (n * math.Pow(t_1, n))
+	scale := p.Ellipsoid.A * big_f * p.K_0
+	rho_0 := scale * math.Pow(t(deg2rad*p.Lat_0), n)
+
+	lon_0, x_0, y_0 := p.Lon_0, p.X_0, p.Y_0
+
+	return func(lon, lat float64) (float64, float64) {
+		lambda := math.Mod(lon-lon_0+540.0, 360.0) - 180.0
+		rho := scale * math.Pow(t(deg2rad*lat), n)
+		theta := n * deg2rad * lambda
+
+		easting := x_0 + rho*math.Sin(theta)
+		northing := y_0 + rho_0 - rho*math.Cos(theta)
+
+		return easting, northing
+	}
+}
+
+// Forward projects a single longitude and latitude (degrees) to an easting
+// and northing (metres).
+// A Projection that wasn't constructed by NewUtmProjection or ParseProjection
+// (eg decoded from JSON) has its projection func built upon first use.
+func (p *Projection) Forward(lon, lat float64) (float64, float64) {
+	if p.forward == nil {
+		p.forward = p.forwardFunc()
+	}
+
+	return p.forward(lon, lat)
+}
+
+// Project converts the LonLat coordinates to EastingNorthing coordinates.
+// Null longitude and latitude values (as inserted when padding dense beam
+// arrays) are converted to NaN.
+func (p *Projection) Project(ll *LonLat) EastingNorthing {
+	if p.forward == nil {
+		p.forward = p.forwardFunc()
+	}
+
+	n := len(ll.Longitude)
+	en := EastingNorthing{
+		Easting:  make([]float64, n),
+		Northing: make([]float64, n),
+	}
+
+	for i := 0; i < n; i++ {
+		lon := ll.Longitude[i]
+		lat := ll.Latitude[i]
+		if lon == NULL_LONGITUDE_F64 || lat == NULL_LATITUDE_F64 {
+			en.Easting[i] = math.NaN()
+			en.Northing[i] = math.NaN()
+			continue
+		}
+		en.Easting[i], en.Northing[i] = p.forward(lon, lat)
+	}
+
+	return en
+}
+
+// dropUnprojected removes the beams without projected coordinates (i.e. a
+// null longitude or latitude) from the beam data, as they can't be located
+// along the projected dimensional axes of a sparse array.
+// The ping and beam numbers of the retained beams are returned.
+// The PingData is left as is if the projected coordinates don't exist.
+func (pd *PingData) dropUnprojected(ping_beam_ids *PingBeamNumbers) *PingBeamNumbers {
+	en := &pd.Easting_northing
+	nbeams := len(pd.Lon_lat.Longitude)
+	if len(en.Easting) != nbeams || len(ping_beam_ids.PingNumber) != nbeams {
+		return ping_beam_ids
+	}
+
+	keep := make([]bool, nbeams)
+	nkeep := 0
+	for i := range keep {
+		keep[i] = !math.IsNaN(en.Easting[i]) && !math.IsNaN(en.Northing[i])
+		if keep[i] {
+			nkeep++
+		}
+	}
+
+	if nkeep == nbeams {
+		return ping_beam_ids
+	}
+
+	return pd.retainBeams(keep, ping_beam_ids)
+}
@@ -0,0 +1,252 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// TestTmForward checks the Transverse Mercator projection against published
+// reference values; the ellipsoidal worked example from Snyder (1987), Map
+// Projections: A Working Manual, p. 269 (Clarke 1866), and the Geoscience
+// Australia Flinders Peak and Buninyong UTM coordinates (GRS80), which lie
+// either side of the boundary between zones 54 and 55 in the southern
+// hemisphere. Snyder's values are given to 0.1m, and Geoscience Australia's
+// values to 1mm.
+func TestTmForward(t *testing.T) {
+	crs := Crs{Horizontal_Datum: "GDA94"}
+
+	tests := []struct {
+		name       string
+		definition string
+		lon, lat   float64
+		easting    float64
+		northing   float64
+		tolerance  float64
+	}{
+		{
+			name:       "snyder",
+			definition: "+proj=tmerc +lon_0=-75 +k_0=0.9996 +ellps=clrk66",
+			lon:        dms(-73, 30, 0),
+			lat:        dms(40, 30, 0),
+			easting:    127106.5,
+			northing:   4484124.4,
+			tolerance:  0.05,
+		},
+		{
+			name:       "flinders peak",
+			definition: "+proj=utm +zone=55 +south",
+			lon:        dms(144, 25, 29.52440),
+			lat:        dms(-37, 57, 3.72030),
+			easting:    273741.297,
+			northing:   5796489.777,
+			tolerance:  0.001,
+		},
+		{
+			name:       "buninyong",
+			definition: "+proj=utm +zone=54 +south",
+			lon:        dms(143, 55, 35.38390),
+			lat:        dms(-37, 39, 10.15610),
+			easting:    758173.797,
+			northing:   5828674.340,
+			tolerance:  0.001,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proj, err := ParseProjection(test.definition, &crs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			easting, northing := proj.Forward(test.lon, test.lat)
+			if math.Abs(easting-test.easting) > test.tolerance {
+				t.Errorf("easting: got %.4f, want %.4f", easting, test.easting)
+			}
+			if math.Abs(northing-test.northing) > test.tolerance {
+				t.Errorf("northing: got %.4f, want %.4f", northing, test.northing)
+			}
+		})
+	}
+}
+
+// TestLccForward checks the Lambert Conformal Conic projection against the
+// ellipsoidal worked example from Snyder (1987), p. 296 (Clarke 1866), and
+// that the origin maps to the false easting and northing.
+func TestLccForward(t *testing.T) {
+	crs := Crs{Horizontal_Datum: "NAD27"}
+
+	proj, err := ParseProjection("+proj=lcc +lat_1=33 +lat_2=45 +lat_0=23 +lon_0=-96", &crs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	easting, northing := proj.Forward(-75.0, 35.0)
+	if math.Abs(easting-1894410.9) > 0.05 {
+		t.Errorf("easting: got %.4f, want %.4f", easting, 1894410.9)
+	}
+	if math.Abs(northing-1564649.5) > 0.05 {
+		t.Errorf("northing: got %.4f, want %.4f", northing, 1564649.5)
+	}
+
+	proj, err = ParseProjection("+proj=lcc +lat_1=-36 +lat_2=-38 +lat_0=-37 +lon_0=145 +x_0=2500000 +y_0=2500000", &crs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	easting, northing = proj.Forward(145.0, -37.0)
+	if math.Abs(easting-2500000.0) > 1e-6 || math.Abs(northing-2500000.0) > 1e-6 {
+		t.Errorf("origin: got (%.6f, %.6f), want (2500000, 2500000)", easting, northing)
+	}
+}
+
+// TestUtmZone checks the zone boundaries, the southern Norway and Svalbard
+// exceptions, and the hemisphere.
+func TestUtmZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		lon, lat float64
+		zone     int
+		south    bool
+	}{
+		{"zone 55 western boundary", 144.0, -37.0, 55, true},
+		{"zone 54 eastern boundary", 143.999, -37.0, 54, true},
+		{"antimeridian", 180.0, 10.0, 1, false},
+		{"antimeridian west", -180.0, 10.0, 1, false},
+		{"last zone", 179.999, 10.0, 60, false},
+		{"equator", 3.0, 0.0, 31, false},
+		{"southern norway", 5.0, 60.0, 32, false},
+		{"svalbard", 10.0, 78.0, 33, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zone, south := UtmZone(test.lon, test.lat)
+			if zone != test.zone || south != test.south {
+				t.Errorf("got (%d, %v), want (%d, %v)", zone, south, test.zone, test.south)
+			}
+		})
+	}
+}
+
+// TestUtmProjection checks the EPSG code, the false northing of the southern
+// hemisphere, and the symmetry of the easting about the central meridian.
+func TestUtmProjection(t *testing.T) {
+	crs := Crs{Horizontal_Datum: "WGS84"}
+	proj := NewUtmProjection(55, true, &crs)
+
+	if proj.Epsg != 32755 {
+		t.Errorf("epsg: got %d, want 32755", proj.Epsg)
+	}
+
+	easting, northing := proj.Forward(147.0, 0.0)
+	if math.Abs(easting-500000.0) > 1e-6 || math.Abs(northing-10000000.0) > 1e-6 {
+		t.Errorf("equator: got (%.6f, %.6f), want (500000, 10000000)", easting, northing)
+	}
+
+	east, north_e := proj.Forward(148.0, -45.0)
+	west, north_w := proj.Forward(146.0, -45.0)
+	if math.Abs((east-500000.0)-(500000.0-west)) > 1e-6 || math.Abs(north_e-north_w) > 1e-6 {
+		t.Errorf("asymmetric about the central meridian: (%.6f, %.6f), (%.6f, %.6f)", west, north_w, east, north_e)
+	}
+
+	crs = Crs{Horizontal_Datum: "NAD83"}
+	proj = NewUtmProjection(55, true, &crs)
+	if proj.Epsg != 0 {
+		t.Errorf("nad83 south epsg: got %d, want 0", proj.Epsg)
+	}
+}
+
+// TestParseProjectionRoundTrip checks that the Definition of a parsed
+// Projection parses to the same projection.
+func TestParseProjectionRoundTrip(t *testing.T) {
+	crs := Crs{Horizontal_Datum: "GDA2020"}
+	definitions := []string{
+		"+proj=utm +zone=55 +south",
+		"+proj=utm +zone=31 +ellps=intl",
+		"+proj=tmerc +lon_0=147 +k_0=0.9996 +x_0=500000 +y_0=10000000",
+		"+proj=tmerc +lat_0=-37 +lon_0=145 +k=1.0 +a=6378137 +rf=298.257223563",
+		"+proj=lcc +lat_1=-36 +lat_2=-38 +lat_0=-37 +lon_0=145 +x_0=2500000 +y_0=2500000",
+		"+proj=lcc +lat_1=33 +lat_0=23 +lon_0=-96 +k_0=0.9999 +ellps=clrk66",
+	}
+
+	for _, definition := range definitions {
+		t.Run(definition, func(t *testing.T) {
+			proj, err := ParseProjection(definition, &crs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reparsed, err := ParseProjection(proj.Definition, &crs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reparsed.Definition != proj.Definition {
+				t.Errorf("definition: got %q, want %q", reparsed.Definition, proj.Definition)
+			}
+
+			if reparsed.Name != proj.Name || reparsed.Zone != proj.Zone || reparsed.South != proj.South ||
+				reparsed.Lon_0 != proj.Lon_0 || reparsed.Lat_0 != proj.Lat_0 ||
+				reparsed.Lat_1 != proj.Lat_1 || reparsed.Lat_2 != proj.Lat_2 ||
+				reparsed.K_0 != proj.K_0 || reparsed.X_0 != proj.X_0 || reparsed.Y_0 != proj.Y_0 {
+				t.Errorf("parameters: got %+v, want %+v", reparsed, proj)
+			}
+
+			// the flattening is written to 9 decimal places of its inverse
+			if reparsed.Ellipsoid.A != proj.Ellipsoid.A || math.Abs(1.0/reparsed.Ellipsoid.Flattening-1.0/proj.Ellipsoid.Flattening) > 1e-9 {
+				t.Errorf("ellipsoid: got %+v, want %+v", reparsed.Ellipsoid, proj.Ellipsoid)
+			}
+
+			x0, y0 := proj.Forward(proj.Lon_0+1.5, proj.Lat_0-2.5)
+			x1, y1 := reparsed.Forward(proj.Lon_0+1.5, proj.Lat_0-2.5)
+			if math.Abs(x1-x0) > 1e-6 || math.Abs(y1-y0) > 1e-6 {
+				t.Errorf("forward: got (%.6f, %.6f), want (%.6f, %.6f)", x1, y1, x0, y0)
+			}
+		})
+	}
+}
+
+// TestParseProjectionErrors checks that invalid definitions are rejected.
+func TestParseProjectionErrors(t *testing.T) {
+	crs := Crs{Horizontal_Datum: "WGS84"}
+	definitions := []string{
+		"+proj=utm",
+		"+proj=utm +zone=61",
+		"+proj=merc +lon_0=147",
+		"+proj=tmerc +lon_0=abc",
+		"+proj=tmerc +lon_0=147 +ellps=bessel",
+		"+proj=tmerc +lon_0=147 +a=6378137",
+	}
+
+	for _, definition := range definitions {
+		t.Run(definition, func(t *testing.T) {
+			_, err := ParseProjection(definition, &crs)
+			if !errors.Is(err, ErrProjection) {
+				t.Errorf("got %v, want ErrProjection", err)
+			}
+		})
+	}
+}
+
+// TestProject checks that null longitudes and latitudes are projected to NaN.
+func TestProject(t *testing.T) {
+	crs := Crs{Horizontal_Datum: "WGS84"}
+	proj := NewUtmProjection(55, true, &crs)
+
+	ll := LonLat{
+		Longitude: []float64{147.0, NULL_LONGITUDE_F64, 147.0},
+		Latitude:  []float64{0.0, -45.0, NULL_LATITUDE_F64},
+	}
+	en := proj.Project(&ll)
+
+	if en.Easting[0] != 500000.0 || en.Northing[0] != 10000000.0 {
+		t.Errorf("got (%f, %f), want (500000, 10000000)", en.Easting[0], en.Northing[0])
+	}
+	for i := 1; i < 3; i++ {
+		if !math.IsNaN(en.Easting[i]) || !math.IsNaN(en.Northing[i]) {
+			t.Errorf("beam %d: got (%f, %f), want NaN", i, en.Easting[i], en.Northing[i])
+		}
+	}
+}
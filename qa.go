@@ -1,6 +1,7 @@
 package gsf
 
 import (
+	"math"
 	"time"
 
 	"github.com/samber/lo"
@@ -10,13 +11,67 @@ import (
 // Quality is a subjective matter, and this is looking at file makeup and assessing
 // for duplicate SWATH_BATHYMETRY_PING records, whether the number of beams is consistent
 // across all pings, and whether the ping SubRecords are consistent across all pings.
+// Navigation contains the events found by scanning the ping headers for gaps in time,
+// implied speed spikes, heading and course discontinuities, and null positions.
+// Summary_Validation contains the comparison of the stored SWATH_BATHY_SUMMARY
+// against the summary computed from the ping data (see FileInfo.SummaryQA).
 type QualityInfo struct {
-	Min_Max_Beams     []uint16
-	Consistent_Beams  bool
-	Coincident_Pings  bool
-	Duplicate_Pings   bool
-	Duplicates        []time.Time
-	Consistent_Schema bool
+	Min_Max_Beams      []uint16
+	Consistent_Beams   bool
+	Coincident_Pings   bool
+	Duplicate_Pings    bool
+	Duplicates         []time.Time
+	Consistent_Schema  bool
+	Navigation         NavigationQuality
+	Summary_Validation SummaryValidation
+}
+
+// NavigationThresholds are the limits used by the navigation QA.
+// Time_Gap is the maximum interval (seconds) between successive pings,
+// Speed is the maximum speed (metres per second) implied by the positions
+// of successive pings, and Heading_Change is the maximum change (degrees)
+// in heading or course between successive pings.
+// A threshold that isn't positive disables the respective check.
+type NavigationThresholds struct {
+	Time_Gap       float64
+	Speed          float64
+	Heading_Change float64
+}
+
+// DEFAULT_NAVIGATION_THRESHOLDS are the default thresholds for NavigationQA.
+var DEFAULT_NAVIGATION_THRESHOLDS = NavigationThresholds{
+	Time_Gap:       30.0,
+	Speed:          15.0,
+	Heading_Change: 30.0,
+}
+
+// NavigationEvent is a navigation QA event, identified by the ping's index
+// (the order of the ping within the GSF file) and timestamp.
+// Value is the measure that exceeded the threshold; the interval (seconds)
+// for a time gap or time reversal (negative), the implied speed (metres per
+// second) for a speed spike, and the change (degrees) for a heading or course
+// jump. Value is zero for a null position.
+type NavigationEvent struct {
+	Ping_Index uint64
+	Timestamp  time.Time
+	Value      float64
+}
+
+// NavigationQuality contains the events found by the navigation QA, along
+// with the thresholds used.
+type NavigationQuality struct {
+	Thresholds     NavigationThresholds
+	Time_Gaps      []NavigationEvent
+	Time_Reversals []NavigationEvent
+	Speed_Spikes   []NavigationEvent
+	Heading_Jumps  []NavigationEvent
+	Course_Jumps   []NavigationEvent
+	Null_Positions []NavigationEvent
+}
+
+// Events returns the total number of navigation QA events.
+func (nq *NavigationQuality) Events() int {
+	return len(nq.Time_Gaps) + len(nq.Time_Reversals) + len(nq.Speed_Spikes) + len(nq.Heading_Jumps) + len(nq.Course_Jumps) + len(nq.Null_Positions)
 }
 
 // QInfo is a constructor for the QualityInfo type.
@@ -106,3 +161,102 @@ func (fi *FileInfo) QInfo() {
 
 	fi.Metadata.Quality_Info = qa
 }
+
+// angularChange is the smallest difference (degrees) between two directions.
+func angularChange(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360.0)
+	return math.Min(d, 360.0-d)
+}
+
+// NavigationQA scans the ping headers for navigation events and records them
+// in the QualityInfo. Each ping is compared against the preceding ping, and
+// pings sharing a timestamp (dual head or dual swath) are not compared.
+// A ping earlier than the preceding ping is reported as a time reversal, and
+// isn't otherwise compared.
+// Speed is computed from the great circle distance between the ping and the
+// most recent ping with a valid position, so null positions don't produce
+// speed spikes. Heading and course changes aren't assessed across a time gap,
+// and are skipped where either value is null.
+func (fi *FileInfo) NavigationQA(thresholds NavigationThresholds) {
+	nq := NavigationQuality{
+		Thresholds:     thresholds,
+		Time_Gaps:      make([]NavigationEvent, 0),
+		Time_Reversals: make([]NavigationEvent, 0),
+		Speed_Spikes:   make([]NavigationEvent, 0),
+		Heading_Jumps:  make([]NavigationEvent, 0),
+		Course_Jumps:   make([]NavigationEvent, 0),
+		Null_Positions: make([]NavigationEvent, 0),
+	}
+
+	// index of the most recent ping with a valid position
+	prev_pos := -1
+
+	for i, ping := range fi.Ping_Info {
+		event := NavigationEvent{Ping_Index: uint64(i), Timestamp: ping.Timestamp}
+
+		null_pos := ping.longitude == NULL_LONGITUDE_F64 || ping.latitude == NULL_LATITUDE_F64
+		if null_pos {
+			nq.Null_Positions = append(nq.Null_Positions, event)
+		}
+
+		if i == 0 {
+			if !null_pos {
+				prev_pos = i
+			}
+			continue
+		}
+
+		prev := fi.Ping_Info[i-1]
+		dt := ping.Timestamp.Sub(prev.Timestamp).Seconds()
+		if dt == 0.0 {
+			continue
+		}
+
+		if dt < 0.0 {
+			event.Value = dt
+			nq.Time_Reversals = append(nq.Time_Reversals, event)
+			continue
+		}
+
+		gap := thresholds.Time_Gap > 0.0 && dt > thresholds.Time_Gap
+		if gap {
+			event.Value = dt
+			nq.Time_Gaps = append(nq.Time_Gaps, event)
+		}
+
+		if !null_pos {
+			if prev_pos >= 0 && thresholds.Speed > 0.0 {
+				pos := fi.Ping_Info[prev_pos]
+				pos_dt := ping.Timestamp.Sub(pos.Timestamp).Seconds()
+				if pos_dt > 0.0 {
+					distance := GreatCircleDistance(pos.longitude, pos.latitude, ping.longitude, ping.latitude)
+					if speed := distance / pos_dt; speed > thresholds.Speed {
+						event.Value = speed
+						nq.Speed_Spikes = append(nq.Speed_Spikes, event)
+					}
+				}
+			}
+			prev_pos = i
+		}
+
+		if gap || !(thresholds.Heading_Change > 0.0) {
+			continue
+		}
+
+		if ping.heading < NULL_HEADING_F32 && prev.heading < NULL_HEADING_F32 {
+			if change := angularChange(float64(ping.heading), float64(prev.heading)); change > thresholds.Heading_Change {
+				event.Value = change
+				nq.Heading_Jumps = append(nq.Heading_Jumps, event)
+			}
+		}
+
+		if ping.course < NULL_COURSE_F32 && prev.course < NULL_COURSE_F32 {
+			if change := angularChange(float64(ping.course), float64(prev.course)); change > thresholds.Heading_Change {
+				event.Value = change
+				nq.Course_Jumps = append(nq.Course_Jumps, event)
+			}
+		}
+	}
+
+	fi.Metadata.Quality_Info.Navigation = nq
+}
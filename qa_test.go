@@ -0,0 +1,41 @@
+package gsf
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNavigationQATimeReversal checks that a ping earlier than the preceding
+// ping is reported as a time reversal, and that pings sharing a timestamp
+// aren't reported.
+func TestNavigationQATimeReversal(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, time.Second, time.Second, -2 * time.Second, 3 * time.Second}
+
+	var fi FileInfo
+	for _, offset := range offsets {
+		fi.Ping_Info = append(fi.Ping_Info, PingInfo{
+			Timestamp: start.Add(offset),
+			longitude: 145.0,
+			latitude:  -38.0,
+			heading:   90.0,
+			course:    90.0,
+		})
+	}
+
+	fi.NavigationQA(DEFAULT_NAVIGATION_THRESHOLDS)
+	nq := &fi.Metadata.Quality_Info.Navigation
+
+	if len(nq.Time_Reversals) != 1 {
+		t.Fatalf("Time_Reversals = %d, want 1", len(nq.Time_Reversals))
+	}
+
+	event := nq.Time_Reversals[0]
+	if event.Ping_Index != 3 || event.Value != -3.0 {
+		t.Errorf("time reversal = (%d, %v), want (3, -3)", event.Ping_Index, event.Value)
+	}
+
+	if nq.Events() != 1 {
+		t.Errorf("Events() = %d, want 1", nq.Events())
+	}
+}
@@ -0,0 +1,329 @@
+package gsf
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+
+	tiledb "github.com/TileDB-Inc/TileDB-Go"
+)
+
+// RasterGeometry defines a regular north-up raster.
+// X_origin and Y_origin define the outer corner of the north-west cell, and
+// Resolution the size of each cell, in the units of the raster coordinates.
+// If Projection is nil, the raster coordinates are the longitude and latitude
+// of the GSF file's horizontal datum (Crs), otherwise they are the projected
+// coordinates.
+type RasterGeometry struct {
+	X_origin   float64
+	Y_origin   float64
+	Resolution float64
+	Columns    uint64
+	Rows       uint64
+	Crs        Crs
+	Projection *Projection
+}
+
+// cellKey computes the [column, row] index of the cell containing (x, y),
+// relative to an origin of (0, 0), with rows increasing northwards.
+func cellKey(x, y, resolution float64) [2]int64 {
+	return [2]int64{int64(math.Floor(x / resolution)), int64(math.Floor(y / resolution))}
+}
+
+// rasterExtent computes the RasterGeometry that contains each of the cells
+// given by keys (as computed by cellKey). The minimum column and maximum row
+// are also returned for converting keys into raster indices.
+func rasterExtent(keys [][2]int64, resolution float64) (RasterGeometry, int64, int64) {
+	var (
+		geom       RasterGeometry
+		min_col    int64
+		max_col    int64
+		min_row    int64
+		max_row    int64
+		initialise bool = true
+	)
+
+	for _, key := range keys {
+		if initialise {
+			min_col, max_col, min_row, max_row = key[0], key[0], key[1], key[1]
+			initialise = false
+			continue
+		}
+		if key[0] < min_col {
+			min_col = key[0]
+		}
+		if key[0] > max_col {
+			max_col = key[0]
+		}
+		if key[1] < min_row {
+			min_row = key[1]
+		}
+		if key[1] > max_row {
+			max_row = key[1]
+		}
+	}
+
+	geom.Resolution = resolution
+	geom.Columns = uint64(max_col - min_col + 1)
+	geom.Rows = uint64(max_row - min_row + 1)
+	geom.X_origin = float64(min_col) * resolution
+	geom.Y_origin = float64(max_row+1) * resolution
+
+	return geom, min_col, max_row
+}
+
+// cellIndex converts a cell key into the row-major index of the raster,
+// with the first row being the northern most row.
+func (rg *RasterGeometry) cellIndex(key [2]int64, min_col, max_row int64) uint64 {
+	row := uint64(max_row - key[1])
+	col := uint64(key[0] - min_col)
+	return row*rg.Columns + col
+}
+
+// rasterTdbArray establishes the schema and dense array using [Row, Column]
+// as the dimensional axes, with the attributes defined by the layers type.
+func (rg *RasterGeometry) rasterTdbArray(ctx *tiledb.Context, array_uri string, layers any) error {
+	domain, err := tiledb.NewDomain(ctx)
+	if err != nil {
+		return err
+	}
+	defer domain.Free()
+
+	// an arbitrary choice of tile size
+	row_tile_sz := uint64(math.Min(float64(256), float64(rg.Rows)))
+	col_tile_sz := uint64(math.Min(float64(256), float64(rg.Columns)))
+
+	rdim, err := tiledb.NewDimension(ctx, "Row", tiledb.TILEDB_UINT64, []uint64{0, rg.Rows - uint64(1)}, row_tile_sz)
+	if err != nil {
+		return err
+	}
+	defer rdim.Free()
+
+	cdim, err := tiledb.NewDimension(ctx, "Column", tiledb.TILEDB_UINT64, []uint64{0, rg.Columns - uint64(1)}, col_tile_sz)
+	if err != nil {
+		return err
+	}
+	defer cdim.Free()
+
+	err = domain.AddDimensions(rdim, cdim)
+	if err != nil {
+		return err
+	}
+
+	schema, err := tiledb.NewArraySchema(ctx, tiledb.TILEDB_DENSE)
+	if err != nil {
+		return err
+	}
+	defer schema.Free()
+
+	err = schema.SetDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	err = schema.SetCellOrder(tiledb.TILEDB_ROW_MAJOR)
+	if err != nil {
+		return err
+	}
+
+	err = schema.SetTileOrder(tiledb.TILEDB_ROW_MAJOR)
+	if err != nil {
+		return err
+	}
+
+	err = schemaAttrs(layers, schema, ctx)
+	if err != nil {
+		return errors.Join(errors.New("Error creating raster layer attributes"), err)
+	}
+
+	err = schema.Check()
+	if err != nil {
+		return errors.Join(errors.New("Error checking raster schema"), err)
+	}
+
+	array, err := tiledb.NewArray(ctx, array_uri)
+	if err != nil {
+		return err
+	}
+	defer array.Free()
+
+	err = array.Create(schema)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rasterSubarray sets the query subarray to the full extent of the raster.
+func (rg *RasterGeometry) rasterSubarray(array *tiledb.Array, query *tiledb.Query) error {
+	subarr, err := array.NewSubarray()
+	if err != nil {
+		return err
+	}
+	defer subarr.Free()
+
+	subarr.AddRangeByName("Row", tiledb.MakeRange(uint64(0), rg.Rows-uint64(1)))
+	subarr.AddRangeByName("Column", tiledb.MakeRange(uint64(0), rg.Columns-uint64(1)))
+
+	return query.SetSubarray(subarr)
+}
+
+// writeRasterTileDB creates and writes the raster layers to a dense TileDB
+// array, along with the metadata md serialised as JSON under the key md_key.
+func (rg *RasterGeometry) writeRasterTileDB(ctx *tiledb.Context, array_uri string, layers any, md_key string, md any) error {
+	err := rg.rasterTdbArray(ctx, array_uri, layers)
+	if err != nil {
+		return err
+	}
+
+	array, err := ArrayOpenWrite(ctx, array_uri)
+	if err != nil {
+		return err
+	}
+	defer array.Free()
+	defer array.Close()
+
+	query, err := tiledb.NewQuery(ctx, array)
+	if err != nil {
+		return err
+	}
+	defer query.Free()
+
+	err = query.SetLayout(tiledb.TILEDB_ROW_MAJOR)
+	if err != nil {
+		return err
+	}
+
+	err = rg.rasterSubarray(array, query)
+	if err != nil {
+		return err
+	}
+
+	err = setStructFieldBuffers(query, layers)
+	if err != nil {
+		return err
+	}
+
+	err = query.Submit()
+	if err != nil {
+		return errors.Join(errors.New("Error submitting TileDB query"), err)
+	}
+
+	err = query.Finalize()
+	if err != nil {
+		return errors.Join(errors.New("Error finalising TileDB query"), err)
+	}
+
+	jsn, err := JsonDumps(md)
+	if err != nil {
+		return err
+	}
+
+	return array.PutMetadata(md_key, jsn)
+}
+
+// readRasterTileDB reads a raster previously written by writeRasterTileDB.
+// The metadata stored under md_key is decoded into md, as well as into the
+// returned RasterGeometry (the metadata is expected to embed a RasterGeometry),
+// which is used to allocate each of the layers to the full extent of the
+// raster prior to reading.
+func readRasterTileDB(ctx *tiledb.Context, array_uri string, md_key string, md any, layers any) (RasterGeometry, error) {
+	var rg RasterGeometry
+
+	array, err := tiledb.NewArray(ctx, array_uri)
+	if err != nil {
+		return rg, err
+	}
+	defer array.Free()
+
+	err = array.Open(tiledb.TILEDB_READ)
+	if err != nil {
+		return rg, errors.Join(errors.New("Error opening (r) raster TileDB array"), err)
+	}
+	defer array.Close()
+
+	_, _, value, err := array.GetMetadata(md_key)
+	if err != nil {
+		return rg, errors.Join(errors.New("Error reading raster metadata: "+md_key), err)
+	}
+
+	jsn, ok := value.(string)
+	if !ok {
+		return rg, errors.New("Raster metadata is not a JSON string: " + md_key)
+	}
+
+	err = json.Unmarshal([]byte(jsn), md)
+	if err != nil {
+		return rg, err
+	}
+
+	err = json.Unmarshal([]byte(jsn), &rg)
+	if err != nil {
+		return rg, err
+	}
+
+	if rg.Columns == 0 || rg.Rows == 0 {
+		return rg, errors.New("Raster has no cells")
+	}
+
+	ncells := int(rg.Columns * rg.Rows)
+	values := reflect.ValueOf(layers).Elem()
+	for i := 0; i < values.NumField(); i++ {
+		field := values.Field(i)
+		field.Set(reflect.MakeSlice(field.Type(), ncells, ncells))
+	}
+
+	query, err := tiledb.NewQuery(ctx, array)
+	if err != nil {
+		return rg, err
+	}
+	defer query.Free()
+
+	err = query.SetLayout(tiledb.TILEDB_ROW_MAJOR)
+	if err != nil {
+		return rg, err
+	}
+
+	err = rg.rasterSubarray(array, query)
+	if err != nil {
+		return rg, err
+	}
+
+	err = setStructFieldBuffers(query, layers)
+	if err != nil {
+		return rg, err
+	}
+
+	err = query.Submit()
+	if err != nil {
+		return rg, errors.Join(errors.New("Error submitting TileDB query"), err)
+	}
+
+	status, err := query.Status()
+	if err != nil {
+		return rg, err
+	}
+	if status != tiledb.TILEDB_COMPLETED {
+		return rg, errors.New("Incomplete read of the raster TileDB array")
+	}
+
+	return rg, nil
+}
+
+// geoTiff constructs a GeoTiff of the raster geometry, without any bands,
+// using NaN as the no data value.
+func (rg *RasterGeometry) geoTiff(compression TiffCompression) GeoTiff {
+	return GeoTiff{
+		Columns:     rg.Columns,
+		Rows:        rg.Rows,
+		X_origin:    rg.X_origin,
+		Y_origin:    rg.Y_origin,
+		Resolution:  rg.Resolution,
+		Crs:         rg.Crs,
+		Projection:  rg.Projection,
+		Nodata:      math.NaN(),
+		Compression: compression,
+	}
+}
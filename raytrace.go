@@ -0,0 +1,362 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+)
+
+// RayTracer traces acoustic rays through a sound velocity profile that is
+// modelled as a series of layers, each with a constant sound speed gradient.
+// Below the deepest observation the sound speed is held constant.
+type RayTracer struct {
+	depth    []float64
+	velocity []float64
+}
+
+// RayTracedBeams contains the beam positions, relative to the vessel, as
+// recomputed by a RayTracer. AcrossTrack is positive to starboard, AlongTrack
+// is positive forward, and Z is the negated depth relative to the waterline,
+// making it comparable to the BeamArray fields of the same name.
+// Beams that could not be traced are set to NaN.
+type RayTracedBeams struct {
+	AcrossTrack []float64
+	AlongTrack  []float64
+	Z           []float64
+}
+
+// NewRayTracer constructs a RayTracer from a sound velocity profile of depths
+// (metres, positive down) and sound speeds (metres/second).
+// Depths must be strictly increasing. If the profile starts below the surface,
+// the shallowest sound speed is extended up to the surface.
+func NewRayTracer(depth, velocity []float64) (*RayTracer, error) {
+	if len(depth) == 0 || len(depth) != len(velocity) {
+		return nil, errors.Join(ErrRayTrace, errors.New("Sound velocity profile requires equal length depth and velocity"))
+	}
+
+	rt := RayTracer{
+		depth:    make([]float64, 0, len(depth)+1),
+		velocity: make([]float64, 0, len(depth)+1),
+	}
+
+	if depth[0] > 0.0 {
+		rt.depth = append(rt.depth, 0.0)
+		rt.velocity = append(rt.velocity, velocity[0])
+	}
+
+	for i := range depth {
+		if velocity[i] <= 0.0 {
+			return nil, errors.Join(ErrRayTrace, errors.New("Sound velocity must be positive"))
+		}
+		if i > 0 && depth[i] <= depth[i-1] {
+			return nil, errors.Join(ErrRayTrace, errors.New("Sound velocity profile depths must be strictly increasing"))
+		}
+		rt.depth = append(rt.depth, depth[i])
+		rt.velocity = append(rt.velocity, velocity[i])
+	}
+
+	return &rt, nil
+}
+
+// RayTracer constructs a RayTracer from the profile at index idx.
+func (s *SoundVelocityProfile) RayTracer(idx int) (*RayTracer, error) {
+	if idx < 0 || idx >= len(s.Depth) {
+		return nil, errors.Join(ErrRayTrace, errors.New("Sound velocity profile index out of range"))
+	}
+
+	depth := make([]float64, len(s.Depth[idx]))
+	velocity := make([]float64, len(s.Sound_velocity[idx]))
+	for i := range depth {
+		depth[i] = float64(s.Depth[idx][i])
+	}
+	for i := range velocity {
+		velocity[i] = float64(s.Sound_velocity[idx][i])
+	}
+
+	return NewRayTracer(depth, velocity)
+}
+
+// velocityAt linearly interpolates the sound speed at depth z, returning the
+// index of the layer containing z.
+func (rt *RayTracer) velocityAt(z float64) (float64, int) {
+	n := len(rt.depth)
+	if z <= rt.depth[0] {
+		return rt.velocity[0], 0
+	}
+
+	for i := 0; i < n-1; i++ {
+		if z < rt.depth[i+1] {
+			frac := (z - rt.depth[i]) / (rt.depth[i+1] - rt.depth[i])
+			return rt.velocity[i] + frac*(rt.velocity[i+1]-rt.velocity[i]), i
+		}
+	}
+
+	return rt.velocity[n-1], n - 1
+}
+
+// layerTime computes the one-way travel time and horizontal distance of a ray
+// with ray parameter p, travelling from sound speed c1 to c2 through a layer
+// of thickness dz. The returned bool is false if the ray turns within the layer.
+func layerTime(p, c1, c2, dz float64) (float64, float64, bool) {
+	sin1 := p * c1
+	sin2 := p * c2
+	if sin1 >= 1.0 || sin2 >= 1.0 {
+		return 0.0, 0.0, false
+	}
+	cos1 := math.Sqrt(1.0 - sin1*sin1)
+	cos2 := math.Sqrt(1.0 - sin2*sin2)
+
+	g := (c2 - c1) / dz
+	if math.Abs(g) < 1e-9 {
+		// constant sound speed; straight line
+		dt := dz / (c1 * cos1)
+		dx := dz * sin1 / cos1
+		return dt, dx, true
+	}
+
+	dt := math.Log((c2/c1)*(1.0+cos1)/(1.0+cos2)) / g
+	dx := 0.0
+	if p > 0.0 {
+		dx = (cos1 - cos2) / (p * g)
+	}
+
+	return dt, dx, true
+}
+
+// layerPartial computes the depth and horizontal distance travelled by a ray
+// with ray parameter p after travelling for time t, starting at sound speed c1
+// within a layer of sound speed gradient g (or constant sound speed if g is
+// zero). The returned bool is false if the ray turns within the layer.
+func layerPartial(p, c1, g, t float64) (float64, float64, bool) {
+	sin1 := p * c1
+	if sin1 >= 1.0 {
+		return 0.0, 0.0, false
+	}
+	cos1 := math.Sqrt(1.0 - sin1*sin1)
+
+	if math.Abs(g) < 1e-9 {
+		dz := t * c1 * cos1
+		return dz, t * c1 * sin1, true
+	}
+
+	// inverting t = ln((c/c1) * (1 + cos1) / (1 + cos)) / g for c, where sin = p*c
+	k := math.Exp(g*t) * c1 / (1.0 + cos1)
+	c := 2.0 * k / (1.0 + k*k*p*p)
+
+	sin2 := p * c
+	if sin2 >= 1.0 {
+		return 0.0, 0.0, false
+	}
+	cos2 := math.Sqrt(1.0 - sin2*sin2)
+
+	dz := (c - c1) / g
+	dx := 0.0
+	if p > 0.0 {
+		dx = (cos1 - cos2) / (p * g)
+	}
+
+	return dz, dx, true
+}
+
+// Trace traces a single ray launched from a transducer at transducer_depth
+// (metres below the waterline) at launch_angle (degrees from vertical), for
+// the two-way travel time (seconds).
+// The horizontal distance and the depth below the waterline of the end point
+// are returned. The returned bool is false if the ray could not be traced,
+// eg the ray turned horizontal before the travel time was exhausted.
+func (rt *RayTracer) Trace(launch_angle, two_way_time, transducer_depth float64) (float64, float64, bool) {
+	if !(two_way_time > 0.0) || math.IsNaN(launch_angle) || math.Abs(launch_angle) >= 90.0 {
+		return 0.0, 0.0, false
+	}
+
+	c0, layer := rt.velocityAt(transducer_depth)
+	p := math.Sin(math.Abs(launch_angle)*math.Pi/180.0) / c0
+	remaining := two_way_time / 2.0
+
+	z := transducer_depth
+	c := c0
+	x := 0.0
+	n := len(rt.depth)
+
+	for i := layer; i < n-1; i++ {
+		if z >= rt.depth[i+1] {
+			continue
+		}
+
+		dz := rt.depth[i+1] - z
+		c2 := rt.velocity[i+1]
+		dt, dx, ok := layerTime(p, c, c2, dz)
+		if !ok {
+			return 0.0, 0.0, false
+		}
+
+		if dt >= remaining {
+			g := (rt.velocity[i+1] - rt.velocity[i]) / (rt.depth[i+1] - rt.depth[i])
+			pz, px, ok := layerPartial(p, c, g, remaining)
+			if !ok {
+				return 0.0, 0.0, false
+			}
+			return x + px, z + pz, true
+		}
+
+		remaining -= dt
+		x += dx
+		z = rt.depth[i+1]
+		c = c2
+	}
+
+	// beneath the profile, the sound speed is held constant
+	pz, px, ok := layerPartial(p, c, 0.0, remaining)
+	if !ok {
+		return 0.0, 0.0, false
+	}
+
+	return x + px, z + pz, true
+}
+
+// TracePing recomputes the across track, along track and Z of each beam for
+// the pings contained within PingData, using the TravelTime, BeamAngle and
+// BeamAngleForward (if present) beam arrays.
+// The transducer depth is taken as the ping's depth corrector.
+// If angles_from_vertical is false, the beam angles are considered relative to
+// the transducer, and the ping's roll and pitch are added to the across and
+// forward beam angles respectively. The roll and pitch are taken from the
+// PingAttitude if it has been interpolated, falling back to the PingHeader
+// where the roll or pitch couldn't be interpolated. The beams of a ping whose roll or pitch is
+// null are set to NaN.
+// As the sign convention of BeamAngle varies between data providers, the side
+// of each beam is taken from the sign of the recorded AcrossTrack if present,
+// otherwise the BeamAngle is considered positive to starboard.
+// The beams are assumed to be contiguous for each ping, with Number_beams per
+// ping, i.e. prior to any padding for dense arrays.
+func (rt *RayTracer) TracePing(pd *PingData, angles_from_vertical bool) (RayTracedBeams, error) {
+	var beams RayTracedBeams
+
+	ba := &pd.Beam_array
+	n := len(ba.TravelTime)
+	if n == 0 || len(ba.BeamAngle) != n {
+		return beams, errors.Join(ErrRayTrace, errors.New("TravelTime and BeamAngle are required for ray tracing"))
+	}
+
+	has_forward := len(ba.BeamAngleForward) == n
+	has_across := len(ba.AcrossTrack) == n
+
+	beams.AcrossTrack = make([]float64, n)
+	beams.AlongTrack = make([]float64, n)
+	beams.Z = make([]float64, n)
+
+	hdr := &pd.Ping_headers
+	att := &pd.Ping_attitude
+	npings := len(hdr.Number_beams)
+	has_attitude := len(att.Attitude_roll) == npings && len(att.Attitude_pitch) == npings
+
+	start := 0
+	for i, nbeams := range hdr.Number_beams {
+		end := start + int(nbeams)
+		if end > n {
+			return beams, errors.Join(ErrRayTrace, errors.New("Number of beams exceeds the number of travel times"))
+		}
+
+		transducer_depth := hdr.Depth_corrector[i]
+		if transducer_depth == NULL_DEPTH_CORRECTOR_F64 {
+			transducer_depth = 0.0
+		}
+
+		roll := 0.0
+		pitch := 0.0
+		if !angles_from_vertical {
+			roll_f32, pitch_f32 := hdr.Roll[i], hdr.Pitch[i]
+			if has_attitude && !math.IsNaN(float64(att.Attitude_roll[i])) && !math.IsNaN(float64(att.Attitude_pitch[i])) {
+				roll_f32, pitch_f32 = att.Attitude_roll[i], att.Attitude_pitch[i]
+			}
+
+			if roll_f32 == NULL_ROLL_F32 || pitch_f32 == NULL_PITCH_F32 || math.IsNaN(float64(roll_f32)) || math.IsNaN(float64(pitch_f32)) {
+				for j := start; j < end; j++ {
+					beams.AcrossTrack[j] = math.NaN()
+					beams.AlongTrack[j] = math.NaN()
+					beams.Z[j] = math.NaN()
+				}
+				start = end
+				continue
+			}
+
+			roll = float64(roll_f32)
+			pitch = float64(pitch_f32)
+		}
+
+		for j := start; j < end; j++ {
+			across_angle := float64(ba.BeamAngle[j])
+			if has_across && ba.AcrossTrack[j] != 0.0 {
+				across_angle = math.Copysign(across_angle, ba.AcrossTrack[j])
+			}
+			across_angle += roll
+
+			forward_angle := pitch
+			if has_forward {
+				forward_angle += float64(ba.BeamAngleForward[j])
+			}
+
+			beams.AcrossTrack[j], beams.AlongTrack[j], beams.Z[j] = rt.traceBeam(across_angle, forward_angle, ba.TravelTime[j], transducer_depth)
+		}
+
+		start = end
+	}
+
+	return beams, nil
+}
+
+// traceBeam traces a beam given its across track and forward angles (degrees
+// from vertical). The angles define the direction cosines of the beam, from
+// which the launch angle from vertical and the azimuth relative to the vessel
+// are derived.
+func (rt *RayTracer) traceBeam(across_angle, forward_angle, two_way_time, transducer_depth float64) (float64, float64, float64) {
+	deg2rad := math.Pi / 180.0
+	nan := math.NaN()
+
+	// direction cosines; along (x), across (y) and down (z)
+	ux := math.Sin(forward_angle * deg2rad)
+	uy := math.Sin(across_angle * deg2rad)
+	uz2 := 1.0 - ux*ux - uy*uy
+	if uz2 <= 0.0 {
+		return nan, nan, nan
+	}
+
+	launch_angle := math.Acos(math.Sqrt(uz2)) / deg2rad
+	horizontal, depth, ok := rt.Trace(launch_angle, two_way_time, transducer_depth)
+	if !ok {
+		return nan, nan, nan
+	}
+
+	across := 0.0
+	along := 0.0
+	h := math.Hypot(ux, uy)
+	if h > 0.0 {
+		across = horizontal * uy / h
+		along = horizontal * ux / h
+	}
+
+	return across, along, -depth
+}
+
+// Residuals computes the difference between the ray traced beams and the
+// recorded beam array (ray traced minus recorded), for use in validating
+// the ray tracing or identifying the use of an incorrect sound velocity
+// profile. Fields not present in the BeamArray are set to NaN.
+func (rb *RayTracedBeams) Residuals(ba *BeamArray) RayTracedBeams {
+	diff := func(traced, recorded []float64) []float64 {
+		res := make([]float64, len(traced))
+		for i := range traced {
+			if len(recorded) != len(traced) {
+				res[i] = math.NaN()
+				continue
+			}
+			res[i] = traced[i] - recorded[i]
+		}
+		return res
+	}
+
+	return RayTracedBeams{
+		AcrossTrack: diff(rb.AcrossTrack, ba.AcrossTrack),
+		AlongTrack:  diff(rb.AlongTrack, ba.AlongTrack),
+		Z:           diff(rb.Z, ba.Z),
+	}
+}
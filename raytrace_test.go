@@ -0,0 +1,246 @@
+package gsf
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testSoundSpeed      = 1500.0
+	testSeafloorDepth   = 50.0
+	testTransducerDepth = 2.0
+)
+
+// testBeamAngles are the beam angles from vertical (degrees), positive to starboard.
+var testBeamAngles = []float64{-60.0, -45.0, -30.0, -10.0, 0.0, 10.0, 30.0, 45.0, 60.0}
+
+// flatSeafloorPings constructs pings observing a flat seafloor through a
+// constant sound speed water column, such that the stored AcrossTrack and Z
+// are known exactly. The BeamAngle is relative to the transducer, i.e. the
+// angle from vertical less the roll.
+func flatSeafloorPings(rolls []float32) PingData {
+	var pd PingData
+
+	nbeams := len(testBeamAngles)
+	deg2rad := math.Pi / 180.0
+	height := testSeafloorDepth - testTransducerDepth
+
+	for _, roll := range rolls {
+		pd.Ping_headers.Number_beams = append(pd.Ping_headers.Number_beams, uint16(nbeams))
+		pd.Ping_headers.Depth_corrector = append(pd.Ping_headers.Depth_corrector, testTransducerDepth)
+		pd.Ping_headers.Roll = append(pd.Ping_headers.Roll, roll)
+		pd.Ping_headers.Pitch = append(pd.Ping_headers.Pitch, 0.0)
+
+		for _, angle := range testBeamAngles {
+			rad := angle * deg2rad
+			slant_range := height / math.Cos(rad)
+
+			ba := &pd.Beam_array
+			ba.TravelTime = append(ba.TravelTime, 2.0*slant_range/testSoundSpeed)
+			ba.BeamAngle = append(ba.BeamAngle, float32(angle)-roll)
+			ba.AcrossTrack = append(ba.AcrossTrack, height*math.Tan(rad))
+			ba.AlongTrack = append(ba.AlongTrack, 0.0)
+			ba.Z = append(ba.Z, -testSeafloorDepth)
+		}
+	}
+
+	return pd
+}
+
+// checkResiduals reports any traced beam of the given pings that differs from
+// the stored beam by more than 1mm.
+func checkResiduals(t *testing.T, pd *PingData, traced *RayTracedBeams, pings []int) {
+	t.Helper()
+
+	residuals := traced.Residuals(&pd.Beam_array)
+	nbeams := len(testBeamAngles)
+
+	for _, ping := range pings {
+		for i := ping * nbeams; i < (ping+1)*nbeams; i++ {
+			if math.Abs(residuals.AcrossTrack[i]) > 1e-3 || math.Abs(residuals.AlongTrack[i]) > 1e-3 || math.Abs(residuals.Z[i]) > 1e-3 {
+				t.Errorf("ping %d, beam %d: residuals (%.6f, %.6f, %.6f) exceed 1mm", ping, i, residuals.AcrossTrack[i], residuals.AlongTrack[i], residuals.Z[i])
+			}
+		}
+	}
+}
+
+// checkNaN reports any traced beam of the given pings that isn't NaN.
+func checkNaN(t *testing.T, traced *RayTracedBeams, pings []int) {
+	t.Helper()
+
+	nbeams := len(testBeamAngles)
+
+	for _, ping := range pings {
+		for i := ping * nbeams; i < (ping+1)*nbeams; i++ {
+			if !math.IsNaN(traced.AcrossTrack[i]) || !math.IsNaN(traced.AlongTrack[i]) || !math.IsNaN(traced.Z[i]) {
+				t.Errorf("ping %d, beam %d: expected NaN, got (%v, %v, %v)", ping, i, traced.AcrossTrack[i], traced.AlongTrack[i], traced.Z[i])
+			}
+		}
+	}
+}
+
+func constantRayTracer(t *testing.T) *RayTracer {
+	t.Helper()
+
+	rt, err := NewRayTracer([]float64{0.0, 100.0}, []float64{testSoundSpeed, testSoundSpeed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rt
+}
+
+// TestTracePing checks the ray traced beams against the stored AcrossTrack
+// and Z, with the beam angles from vertical, and relative to the transducer
+// with the roll applied.
+func TestTracePing(t *testing.T) {
+	rt := constantRayTracer(t)
+
+	pd := flatSeafloorPings([]float32{0.0, 0.0})
+	traced, err := rt.TracePing(&pd, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResiduals(t, &pd, &traced, []int{0, 1})
+
+	pd = flatSeafloorPings([]float32{5.0, -3.5})
+	traced, err = rt.TracePing(&pd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResiduals(t, &pd, &traced, []int{0, 1})
+}
+
+// TestTracePingNullAttitude checks that a ping with a null roll or pitch
+// isn't traced, rather than adding 99 degrees to its beam angles.
+func TestTracePingNullAttitude(t *testing.T) {
+	rt := constantRayTracer(t)
+
+	pd := flatSeafloorPings([]float32{5.0, 0.0, 0.0})
+	pd.Ping_headers.Roll[1] = NULL_ROLL_F32
+	pd.Ping_headers.Pitch[2] = NULL_PITCH_F32
+
+	traced, err := rt.TracePing(&pd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResiduals(t, &pd, &traced, []int{0})
+	checkNaN(t, &traced, []int{1, 2})
+}
+
+// TestTracePingInterpolatedAttitude checks that the interpolated attitude
+// takes precedence over the PingHeader, and that the PingHeader is used
+// where the attitude has a gap.
+func TestTracePingInterpolatedAttitude(t *testing.T) {
+	rt := constantRayTracer(t)
+	nan := float32(math.NaN())
+
+	pd := flatSeafloorPings([]float32{5.0, 2.0})
+	pd.Ping_headers.Roll[0] = NULL_ROLL_F32
+	pd.Ping_attitude = PingAttitude{
+		Attitude_pitch:   []float32{0.0, nan},
+		Attitude_roll:    []float32{5.0, nan},
+		Attitude_heave:   []float32{0.0, nan},
+		Attitude_heading: []float32{0.0, nan},
+		Attitude_gap:     []uint8{0, 1},
+	}
+
+	traced, err := rt.TracePing(&pd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResiduals(t, &pd, &traced, []int{0, 1})
+}
+
+// arcLayer computes the one-way travel time and horizontal distance of a ray
+// with ray parameter p through a layer of constant sound speed gradient g,
+// from sound speed c1 to c2. The ray follows a circular arc of radius 1/(p*g),
+// such that the horizontal distance is R(cos1 - cos2) and the travel time is
+// ln(tan(theta2/2) / tan(theta1/2)) / g, where sin(theta) = p*c.
+// A vertical ray travels for ln(c2/c1) / g.
+func arcLayer(p, c1, c2, g float64) (float64, float64) {
+	if p == 0.0 {
+		return math.Log(c2/c1) / g, 0.0
+	}
+
+	theta1 := math.Asin(p * c1)
+	theta2 := math.Asin(p * c2)
+	dt := math.Log(math.Tan(theta2/2.0)/math.Tan(theta1/2.0)) / g
+	dx := (math.Cos(theta1) - math.Cos(theta2)) / (p * g)
+
+	return dt, dx
+}
+
+// TestTraceGradient checks rays traced through a two layer profile, with
+// a positive then a negative sound speed gradient, against the analytic
+// circular arc solution. The rays end part way through the first layer,
+// part way through the second layer, and beneath the profile where the sound
+// speed is held constant.
+func TestTraceGradient(t *testing.T) {
+	depth := []float64{0.0, 40.0, 100.0}
+	velocity := []float64{1500.0, 1520.0, 1490.0}
+	gradient := []float64{20.0 / 40.0, -30.0 / 60.0}
+
+	rt, err := NewRayTracer(depth, velocity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sound speed at z within the profile
+	speed := func(z float64) float64 {
+		if z < depth[1] {
+			return velocity[0] + gradient[0]*z
+		}
+		return velocity[1] + gradient[1]*(z-depth[1])
+	}
+
+	tests := []struct {
+		name             string
+		transducer_depth float64
+		end_depth        float64
+	}{
+		{"first layer", 0.0, 25.0},
+		{"second layer", 0.0, 70.0},
+		{"beneath the profile", 0.0, 130.0},
+		{"second layer from a submerged transducer", 6.0, 85.0},
+	}
+
+	for _, test := range tests {
+		for _, angle := range []float64{0.0, 20.0, 45.0, 60.0} {
+			c0 := speed(test.transducer_depth)
+			p := math.Sin(angle*math.Pi/180.0) / c0
+
+			// accumulate the analytic travel time and horizontal distance
+			// through each layer down to the end depth
+			one_way := 0.0
+			horizontal := 0.0
+			top := test.transducer_depth
+			for i := 0; i < len(gradient) && top < test.end_depth; i++ {
+				bottom := math.Min(depth[i+1], test.end_depth)
+				if bottom <= top {
+					continue
+				}
+				dt, dx := arcLayer(p, speed(top), speed(bottom), gradient[i])
+				one_way += dt
+				horizontal += dx
+				top = bottom
+			}
+			if test.end_depth > depth[2] {
+				// straight line beneath the profile
+				cos := math.Sqrt(1.0 - p*velocity[2]*p*velocity[2])
+				dz := test.end_depth - depth[2]
+				one_way += dz / (velocity[2] * cos)
+				horizontal += dz * p * velocity[2] / cos
+			}
+
+			x, z, ok := rt.Trace(angle, 2.0*one_way, test.transducer_depth)
+			if !ok {
+				t.Errorf("%s, %v degrees: failed to trace", test.name, angle)
+				continue
+			}
+			if math.Abs(x-horizontal) > 1e-6 || math.Abs(z-test.end_depth) > 1e-6 {
+				t.Errorf("%s, %v degrees: got (%.9f, %.9f), want (%.9f, %.9f)", test.name, angle, x, z, horizontal, test.end_depth)
+			}
+		}
+	}
+}
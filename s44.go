@@ -0,0 +1,300 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// S44Order identifies an IHO S-44 (edition 6.1.0) survey order.
+type S44Order string
+
+const (
+	S44_EXCLUSIVE S44Order = "exclusive"
+	S44_SPECIAL   S44Order = "special"
+	S44_ORDER_1A  S44Order = "1a"
+	S44_ORDER_1B  S44Order = "1b"
+	S44_ORDER_2   S44Order = "2"
+)
+
+// S44Orders lists the supported S-44 survey orders.
+var S44Orders = []S44Order{
+	S44_EXCLUSIVE,
+	S44_SPECIAL,
+	S44_ORDER_1A,
+	S44_ORDER_1B,
+	S44_ORDER_2,
+}
+
+// S44Limits are the uncertainty limits (95% confidence level) of an S-44
+// survey order. The total vertical uncertainty (TVU) limit at depth d is
+// sqrt(Tvu_a^2 + (Tvu_b * d)^2), and the total horizontal uncertainty (THU)
+// limit is Thu_constant + Thu_depth_factor * d.
+type S44Limits struct {
+	Tvu_a            float64
+	Tvu_b            float64
+	Thu_constant     float64
+	Thu_depth_factor float64
+}
+
+// S44OrderLimits maps each S44Order to its S44Limits.
+var S44OrderLimits = map[S44Order]S44Limits{
+	S44_EXCLUSIVE: {Tvu_a: 0.15, Tvu_b: 0.0075, Thu_constant: 1.0, Thu_depth_factor: 0.0},
+	S44_SPECIAL:   {Tvu_a: 0.25, Tvu_b: 0.0075, Thu_constant: 2.0, Thu_depth_factor: 0.0},
+	S44_ORDER_1A:  {Tvu_a: 0.5, Tvu_b: 0.013, Thu_constant: 5.0, Thu_depth_factor: 0.05},
+	S44_ORDER_1B:  {Tvu_a: 0.5, Tvu_b: 0.013, Thu_constant: 5.0, Thu_depth_factor: 0.05},
+	S44_ORDER_2:   {Tvu_a: 1.0, Tvu_b: 0.023, Thu_constant: 20.0, Thu_depth_factor: 0.1},
+}
+
+// Tvu is the maximum allowable total vertical uncertainty at depth.
+func (sl S44Limits) Tvu(depth float64) float64 {
+	return math.Hypot(sl.Tvu_a, sl.Tvu_b*depth)
+}
+
+// Thu is the maximum allowable total horizontal uncertainty at depth.
+func (sl S44Limits) Thu(depth float64) float64 {
+	return sl.Thu_constant + sl.Thu_depth_factor*depth
+}
+
+// S44Result is the enumeration of the S-44 compliance of a beam.
+type S44Result uint8
+
+const (
+	S44_NOT_ASSESSED S44Result = iota
+	S44_COMPLIANT
+	S44_TVU_EXCEEDED
+	S44_THU_EXCEEDED
+	S44_TVU_THU_EXCEEDED
+)
+
+// S44Results maps each S44Result to its name.
+var S44Results = map[S44Result]string{
+	S44_NOT_ASSESSED:     "not_assessed",
+	S44_COMPLIANT:        "compliant",
+	S44_TVU_EXCEEDED:     "tvu_exceeded",
+	S44_THU_EXCEEDED:     "thu_exceeded",
+	S44_TVU_THU_EXCEEDED: "tvu_thu_exceeded",
+}
+
+// S44Attrs contains the S-44 compliance (S44Result) of each beam, written
+// alongside the beam data.
+type S44Attrs struct {
+	S44Compliance []uint8 `tiledb:"dtype=uint8,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// PingS44 contains the S-44 compliance of each ping; the number of beams
+// assessed, the number of those that are compliant, and the proportion of
+// the assessed beams that are compliant (NaN if no beams were assessed).
+type PingS44 struct {
+	S44_assessed  []uint16  `tiledb:"dtype=uint16,ftype=attr" filters:"zstd(level=16)"`
+	S44_compliant []uint16  `tiledb:"dtype=uint16,ftype=attr" filters:"zstd(level=16)"`
+	S44_pass_rate []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// S44Compliance is the per-file S-44 compliance assessment.
+// Tvu_assessed and Thu_assessed are the number of assessed beams that had a
+// vertical and horizontal uncertainty respectively. Pass_rate is the
+// proportion of the assessed beams that are compliant, and the ping pass
+// rates are summarised by Ping_pass_rate_min and Ping_pass_rate_mean over
+// the pings containing assessed beams. Pass rates are zero if nothing was
+// assessed.
+type S44Compliance struct {
+	Order               S44Order
+	Limits              S44Limits
+	Uncertainty_scale   float64
+	Beams               uint64
+	Assessed            uint64
+	Tvu_assessed        uint64
+	Thu_assessed        uint64
+	Compliant           uint64
+	Tvu_exceeded        uint64
+	Thu_exceeded        uint64
+	Pass_rate           float64
+	Pings               uint64
+	Pings_assessed      uint64
+	Pings_compliant     uint64
+	Ping_pass_rate_min  float64
+	Ping_pass_rate_mean float64
+}
+
+// S44Assessor assesses the uncertainty of each beam against the TVU and THU
+// limits of an S-44 survey order, as a function of the beam's depth (|Z|),
+// streaming over chunks of PingData.
+// The uncertainties are the VerticalError and HorizontalError, falling back
+// to the SonarVertUncertainty and SonarHorzUncertainty for beams without
+// them, and are multiplied by Uncertainty_scale to give the 95% confidence
+// level required by S-44 (e.g. 1.96 for uncertainties recorded at 1 sigma).
+// A beam is assessed against whichever of the TVU and THU it has an
+// uncertainty for. Beams that are rejected by their BeamFlags, have a null
+// depth, or have neither uncertainty are not assessed.
+type S44Assessor struct {
+	Order             S44Order
+	Uncertainty_scale float64
+	limits            S44Limits
+	summary           S44Compliance
+	sum_pass_rate     float64
+}
+
+// NewS44Assessor constructs an S44Assessor for the S-44 survey order.
+func NewS44Assessor(order S44Order, uncertainty_scale float64) (*S44Assessor, error) {
+	limits, ok := S44OrderLimits[order]
+	if !ok {
+		return nil, errors.Join(ErrS44, errors.New("Unsupported S-44 order: "+string(order)))
+	}
+
+	if !(uncertainty_scale > 0.0) {
+		return nil, errors.Join(ErrS44, errors.New("Uncertainty scale must be positive"))
+	}
+
+	sa := S44Assessor{
+		Order:             order,
+		Uncertainty_scale: uncertainty_scale,
+		limits:            limits,
+		summary: S44Compliance{
+			Order:             order,
+			Limits:            limits,
+			Uncertainty_scale: uncertainty_scale,
+		},
+	}
+
+	return &sa, nil
+}
+
+// beamUncertainty selects the uncertainty of beam i, using the sonar's
+// uncertainty if the primary uncertainty is null. Null uncertainties are
+// not positive; ok is false if neither uncertainty is available.
+func beamUncertainty(primary, sonar []float32, i int) (uncertainty float64, ok bool) {
+	if i < len(primary) && primary[i] > 0.0 {
+		return float64(primary[i]), true
+	}
+
+	if i < len(sonar) && sonar[i] > 0.0 {
+		return float64(sonar[i]), true
+	}
+
+	return 0.0, false
+}
+
+// Assess computes the S-44 compliance of each beam and each ping contained
+// within the PingData, and accumulates the per-file totals. Padded beams
+// (dense beam data) are not assessed.
+func (sa *S44Assessor) Assess(pd *PingData) (S44Attrs, PingS44) {
+	ba := &pd.Beam_array
+	nbeams := len(pd.Lon_lat.Longitude)
+	npings := len(pd.Ping_headers.Number_beams)
+
+	beams := S44Attrs{S44Compliance: make([]uint8, nbeams)}
+	pings := PingS44{
+		S44_assessed:  make([]uint16, npings),
+		S44_compliant: make([]uint16, npings),
+		S44_pass_rate: make([]float32, npings),
+	}
+	for i := range pings.S44_pass_rate {
+		pings.S44_pass_rate[i] = float32(math.NaN())
+	}
+	sa.summary.Pings += uint64(npings)
+
+	if len(ba.Z) != nbeams {
+		return beams, pings
+	}
+
+	has_flags := len(ba.BeamFlags) == nbeams
+
+	for ping, rng := range pd.pingBeamRanges() {
+		sa.summary.Beams += uint64(rng[1] - rng[0])
+
+		for i := rng[0]; i < rng[1]; i++ {
+			if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+				continue
+			}
+
+			z := ba.Z[i]
+			if z == NULL_DEPTH_F64 || math.IsNaN(z) {
+				continue
+			}
+			depth := math.Abs(z)
+
+			tvu, has_tvu := beamUncertainty(ba.VerticalError, ba.SonarVertUncertainty, i)
+			thu, has_thu := beamUncertainty(ba.HorizontalError, ba.SonarHorzUncertainty, i)
+			if !has_tvu && !has_thu {
+				continue
+			}
+
+			tvu_exceeded := has_tvu && tvu*sa.Uncertainty_scale > sa.limits.Tvu(depth)
+			thu_exceeded := has_thu && thu*sa.Uncertainty_scale > sa.limits.Thu(depth)
+
+			result := S44_COMPLIANT
+			switch {
+			case tvu_exceeded && thu_exceeded:
+				result = S44_TVU_THU_EXCEEDED
+			case tvu_exceeded:
+				result = S44_TVU_EXCEEDED
+			case thu_exceeded:
+				result = S44_THU_EXCEEDED
+			}
+			beams.S44Compliance[i] = uint8(result)
+
+			pings.S44_assessed[ping]++
+			sa.summary.Assessed++
+			if has_tvu {
+				sa.summary.Tvu_assessed++
+			}
+			if has_thu {
+				sa.summary.Thu_assessed++
+			}
+			if tvu_exceeded {
+				sa.summary.Tvu_exceeded++
+			}
+			if thu_exceeded {
+				sa.summary.Thu_exceeded++
+			}
+			if result == S44_COMPLIANT {
+				pings.S44_compliant[ping]++
+				sa.summary.Compliant++
+			}
+		}
+
+		if pings.S44_assessed[ping] == 0 {
+			continue
+		}
+
+		pass_rate := float64(pings.S44_compliant[ping]) / float64(pings.S44_assessed[ping])
+		pings.S44_pass_rate[ping] = float32(pass_rate)
+
+		sa.summary.Pings_assessed++
+		if pings.S44_compliant[ping] == pings.S44_assessed[ping] {
+			sa.summary.Pings_compliant++
+		}
+		if sa.summary.Pings_assessed == 1 {
+			sa.summary.Ping_pass_rate_min = pass_rate
+		}
+		sa.summary.Ping_pass_rate_min = math.Min(sa.summary.Ping_pass_rate_min, pass_rate)
+		sa.sum_pass_rate += pass_rate
+	}
+
+	return beams, pings
+}
+
+// S44Compliance returns the per-file S-44 compliance assessment of the pings
+// assessed so far.
+func (sa *S44Assessor) S44Compliance() S44Compliance {
+	sc := sa.summary
+	if sc.Assessed > 0 {
+		sc.Pass_rate = float64(sc.Compliant) / float64(sc.Assessed)
+	}
+	if sc.Pings_assessed > 0 {
+		sc.Ping_pass_rate_mean = sa.sum_pass_rate / float64(sc.Pings_assessed)
+	}
+
+	return sc
+}
+
+// String summarises the compliance, e.g. "order 1a: 98.50% of 1000 beams compliant".
+func (sc S44Compliance) String() string {
+	rate := "n/a"
+	if sc.Assessed > 0 {
+		rate = strconv.FormatFloat(sc.Pass_rate*100.0, 'f', 2, 64) + "%"
+	}
+
+	return "order " + string(sc.Order) + ": " + rate + " of " + strconv.FormatUint(sc.Assessed, 10) + " beams compliant"
+}
@@ -77,6 +77,12 @@ func chunkedBeamArray(t any, length int, beam_names []string) error {
 // schemaAttrs is a helper func for defining a tiledb.ArraySchema based on the
 // input type.
 func schemaAttrs(t any, schema *tiledb.ArraySchema, ctx *tiledb.Context) error {
+	return schemaNullableAttrs(t, schema, ctx, false)
+}
+
+// schemaNullableAttrs is a helper func for defining a tiledb.ArraySchema based
+// on the input type, optionally creating each attribute as nullable.
+func schemaNullableAttrs(t any, schema *tiledb.ArraySchema, ctx *tiledb.Context, nullable bool) error {
 	var (
 		field_tdb_defs map[string]stgpsr.Definition
 		def            stgpsr.Definition
@@ -116,7 +122,7 @@ func schemaAttrs(t any, schema *tiledb.ArraySchema, ctx *tiledb.Context) error {
 			continue
 		}
 
-		err := CreateAttr(name, field_filt_defs, field_tdb_defs, schema, ctx)
+		err := createAttr(name, field_filt_defs, field_tdb_defs, schema, ctx, nullable)
 		if err != nil {
 			return errors.Join(ErrCreateAttributeTdb, err)
 		}
@@ -307,7 +313,9 @@ func baseLonLatSchema(ctx *tiledb.Context) (schema *tiledb.ArraySchema, err erro
 }
 
 // beamAttachAttrs attaches the attributes to a schema for the BeamArray.
-func beamAttachAttrs(schema *tiledb.ArraySchema, ctx *tiledb.Context, beam_subrecords []string, contains_intensity bool) (err error) {
+// If nullable is true, the attributes (other than the beam flags) are created
+// as nullable attributes so that rejected beams can be written as nulls.
+func beamAttachAttrs(schema *tiledb.ArraySchema, ctx *tiledb.Context, beam_subrecords []string, contains_intensity, nullable bool) (err error) {
 	var (
 		field_tdb_defs map[string]stgpsr.Definition
 		def            stgpsr.Definition
@@ -321,7 +329,7 @@ func beamAttachAttrs(schema *tiledb.ArraySchema, ctx *tiledb.Context, beam_subre
 		return err
 	}
 	if dense == tiledb.TILEDB_DENSE {
-		err = schemaAttrs(&XY{}, schema, ctx)
+		err = schemaNullableAttrs(&XY{}, schema, ctx, nullable)
 		if err != nil {
 			err_pbn := errors.New("Error attaching X & Y attributes")
 			return errors.Join(err, ErrCreateAttributeTdb, err_pbn)
@@ -371,7 +379,10 @@ func beamAttachAttrs(schema *tiledb.ArraySchema, ctx *tiledb.Context, beam_subre
 			continue
 		}
 
-		err := CreateAttr(name, field_filt_defs, field_tdb_defs, schema, ctx)
+		// the beam flags remain populated, recording why a beam is null
+		is_flags := name == "BeamFlags" || name == "QualityFlags"
+
+		err := createAttr(name, field_filt_defs, field_tdb_defs, schema, ctx, nullable && !is_flags)
 		if err != nil {
 			return errors.Join(ErrCreateAttributeTdb, err)
 		}
@@ -379,7 +390,7 @@ func beamAttachAttrs(schema *tiledb.ArraySchema, ctx *tiledb.Context, beam_subre
 
 	// processing the brb intensity data
 	if contains_intensity {
-		err = schemaAttrs(&BrbIntensity{}, schema, ctx)
+		err = schemaNullableAttrs(&BrbIntensity{}, schema, ctx, nullable)
 		if err != nil {
 			err_brb := errors.New("Error attaching BrbIntensity attributes")
 			return errors.Join(err, ErrCreateAttributeTdb, err_brb)
@@ -396,8 +407,11 @@ func beamAttachAttrs(schema *tiledb.ArraySchema, ctx *tiledb.Context, beam_subre
 	return nil
 }
 
-// phTdbArray sets of the PingHeaders TileDB array.
-func phTdbArray(ctx *tiledb.Context, array_uri string, npings uint64) error {
+// phTdbArray sets of the PingHeaders TileDB array, including the
+// PingStatistics and PingHead attributes.
+// The PingAttitude, PingSvp, PingRejected and PingS44 attributes are included
+// as required by the outputs.
+func phTdbArray(ctx *tiledb.Context, array_uri string, npings uint64, outputs *OutputOptions) error {
 	schema, err := basePidSchema(ctx, npings)
 	if err != nil {
 		return err
@@ -410,6 +424,50 @@ func phTdbArray(ctx *tiledb.Context, array_uri string, npings uint64) error {
 		return errors.Join(err, errn)
 	}
 
+	err = schemaAttrs(&PingStatistics{}, schema, ctx)
+	if err != nil {
+		errn := errors.New("Error creating PingStatistics attributes")
+		return errors.Join(err, errn)
+	}
+
+	err = schemaAttrs(&PingHead{}, schema, ctx)
+	if err != nil {
+		errn := errors.New("Error creating PingHead attributes")
+		return errors.Join(err, errn)
+	}
+
+	if outputs.Interpolated_attitude {
+		err = schemaAttrs(&PingAttitude{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error creating PingAttitude attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
+	if outputs.Svp_selection != "" {
+		err = schemaAttrs(&PingSvp{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error creating PingSvp attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
+	if outputs.Reject_policy.excludes() {
+		err = schemaAttrs(&PingRejected{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error creating PingRejected attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
+	if outputs.S44_order != "" {
+		err = schemaAttrs(&PingS44{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error creating PingS44 attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
 	err = schema.Check()
 	if err != nil {
 		errn := errors.New("Error checking PingHeaders schema")
@@ -437,6 +495,14 @@ func phTdbArray(ctx *tiledb.Context, array_uri string, npings uint64) error {
 		return err
 	}
 
+	// record the policy used to associate each ping with an SVP
+	if outputs.Svp_selection != "" {
+		err = WriteArrayMetadata(ctx, array_uri, "Svp_Selection", outputs.Svp_selection)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -531,13 +597,15 @@ func senImgTdbArray(ctx *tiledb.Context, array_uri string, npings uint64, sensor
 }
 
 // beamTdbArray sets up the BeamArray TileDB array.
-func beamTdbArray(ctx *tiledb.Context, array_uri string, beam_subrecords []string, contains_intensity, dense_bd bool, npings uint64, max_beams uint16) error {
+func beamTdbArray(ctx *tiledb.Context, array_uri string, beam_subrecords []string, contains_intensity, dense_bd bool, npings uint64, max_beams uint16, sref *SpatialReference, outputs *OutputOptions, projected_dims bool) error {
 	var (
 		schema *tiledb.ArraySchema
 		err    error
 		md     map[string]string
 	)
 
+	proj := sref.Projection
+
 	if dense_bd {
 		schema, err = basePingBeamSchema(ctx, npings, max_beams)
 		if err != nil {
@@ -555,12 +623,51 @@ func beamTdbArray(ctx *tiledb.Context, array_uri string, beam_subrecords []strin
 	}
 	defer schema.Free()
 
-	err = beamAttachAttrs(schema, ctx, beam_subrecords, contains_intensity)
+	// rejected beams are written as nulls
+	nullable := dense_bd && outputs.Reject_policy == REJECT_NULL
+
+	err = beamAttachAttrs(schema, ctx, beam_subrecords, contains_intensity, nullable)
 	if err != nil {
 		errn := errors.New("Error attaching beam data attributes")
 		return errors.Join(err, errn)
 	}
 
+	// projected coordinates; either as the X & Y dimensions of the sparse array
+	// with longitude and latitude as attributes, or as Easting & Northing attributes
+	projected_dims = projected_dims && !dense_bd && proj != nil
+	if projected_dims {
+		err = schemaAttrs(&LonLatAttrs{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error attaching Longitude & Latitude attributes")
+			return errors.Join(err, errn)
+		}
+	} else if proj != nil {
+		err = schemaNullableAttrs(&EastingNorthing{}, schema, ctx, nullable)
+		if err != nil {
+			errn := errors.New("Error attaching Easting & Northing attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
+	// decoded beam flags, written alongside the raw BeamFlags
+	decoded_flags := outputs.Decoded_flags && lo.Contains(beam_subrecords, SubRecordNames[BEAM_FLAGS])
+	if decoded_flags {
+		err = schemaAttrs(&BeamFlagAttrs{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error attaching decoded BeamFlags attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
+	// S-44 compliance of each beam
+	if outputs.S44_order != "" {
+		err = schemaAttrs(&S44Attrs{}, schema, ctx)
+		if err != nil {
+			errn := errors.New("Error attaching S-44 compliance attributes")
+			return errors.Join(err, errn)
+		}
+	}
+
 	err = schema.Check()
 	if err != nil {
 		errn := errors.New("Error checking beam array TileDB schema")
@@ -588,12 +695,71 @@ func beamTdbArray(ctx *tiledb.Context, array_uri string, beam_subrecords []strin
 		return err
 	}
 
+	// record the vertical reference of Z
+	err = WriteArrayMetadata(ctx, array_uri, "Vertical_Reference", sref.Vertical)
+	if err != nil {
+		return err
+	}
+
+	// record the projection so that the projected coordinates can be interpreted
+	if proj != nil {
+		err = WriteArrayMetadata(ctx, array_uri, "Projection", proj)
+		if err != nil {
+			return err
+		}
+
+		err = WriteArrayMetadata(ctx, array_uri, "Projected_Dimensions", projected_dims)
+		if err != nil {
+			return err
+		}
+	}
+
+	// record how the beams rejected by their beam flags were handled
+	if outputs.Reject_policy.excludes() {
+		err = WriteArrayMetadata(ctx, array_uri, "Reject_Policy", outputs.Reject_policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	// record the enumerations so that FlagCategory & FlagReason can be interpreted
+	if decoded_flags {
+		err = WriteArrayMetadata(ctx, array_uri, "Beam_Flag_Categories", BeamFlagCategories)
+		if err != nil {
+			return err
+		}
+
+		err = WriteArrayMetadata(ctx, array_uri, "Beam_Flag_Reasons", BeamFlagReasons)
+		if err != nil {
+			return err
+		}
+	}
+
+	// record the order and enumeration so that S44Compliance can be interpreted
+	if outputs.S44_order != "" {
+		err = WriteArrayMetadata(ctx, array_uri, "S44_Order", outputs.S44_order)
+		if err != nil {
+			return err
+		}
+
+		err = WriteArrayMetadata(ctx, array_uri, "S44_Results", S44Results)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // pingTdbArrays orchestrates the creation of the PingHeaders, SensorMetadata,
 // SensorImageryMetadata and the BeamArray TileDB arrays.
-func (fi *FileInfo) pingTdbArrays(ctx *tiledb.Context, ph_uri, s_md_uri, si_md_uri, bd_uri string, dense_bd bool) (err error) {
+// If sref.Projection is not nil, the BeamArray will contain the projected
+// coordinates, and if projected_dims is true (sparse arrays only) they will be
+// used as the X & Y dimensional axes.
+// If outputs.Interpolated_attitude is true, the PingHeaders will contain the
+// PingAttitude, and if outputs.Svp_selection is set, the PingSvp.
+// The BeamArray is not created if bd_uri is empty.
+func (fi *FileInfo) pingTdbArrays(ctx *tiledb.Context, ph_uri, s_md_uri, si_md_uri, bd_uri string, dense_bd bool, sref *SpatialReference, outputs *OutputOptions, projected_dims bool) (err error) {
 	beam_subrecords := fi.SubRecord_Schema
 	contains_intensity := lo.Contains(beam_subrecords, SubRecordNames[INTENSITY_SERIES])
 	rec_name := RecordNames[SWATH_BATHYMETRY_PING]
@@ -601,7 +767,7 @@ func (fi *FileInfo) pingTdbArrays(ctx *tiledb.Context, ph_uri, s_md_uri, si_md_u
 	sensor_id := SubRecordID(fi.Metadata.Sensor_Info.Sensor_ID)
 	max_beams := fi.Metadata.Quality_Info.Min_Max_Beams[1]
 
-	err = phTdbArray(ctx, ph_uri, npings)
+	err = phTdbArray(ctx, ph_uri, npings, outputs)
 	if err != nil {
 		err_ph := errors.New("Error creating PingHeaders TileDB array")
 		return errors.Join(err, err_ph)
@@ -621,7 +787,12 @@ func (fi *FileInfo) pingTdbArrays(ctx *tiledb.Context, ph_uri, s_md_uri, si_md_u
 		}
 	}
 
-	err = beamTdbArray(ctx, bd_uri, beam_subrecords, contains_intensity, dense_bd, npings, max_beams)
+	// the beam array is created elsewhere when split by head
+	if bd_uri == "" {
+		return nil
+	}
+
+	err = beamTdbArray(ctx, bd_uri, beam_subrecords, contains_intensity, dense_bd, npings, max_beams, sref, outputs, projected_dims)
 	if err != nil {
 		err_ba := errors.New("Error creating TileDB beam array")
 		return errors.Join(err, err_ba)
@@ -0,0 +1,585 @@
+package gsf
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+
+	tiledb "github.com/TileDB-Inc/TileDB-Go"
+	"github.com/samber/lo"
+)
+
+// Sink is the interface for an output backend of the conversion pipeline.
+// The decoded GSF data is handed to a Sink in the order of; metadata,
+// attitude, SVP, and then the ping data in chunks of PING_CHUNK_SIZE pings.
+// OpenPings is called prior to the first ping chunk being written, and Close
+// is called by the owner of the Sink once all data has been written.
+type Sink interface {
+	// WriteMetadata receives the file level metadata and processing info.
+	WriteMetadata(fi *FileInfo, proc_info *ProcessingInfo) error
+
+	// WriteAttitude receives the attitude records for the whole file.
+	WriteAttitude(att *Attitude) error
+
+	// WriteSvp receives the sound velocity profile records for the whole file.
+	WriteSvp(svp *SoundVelocityProfile) error
+
+	// OpenPings prepares the Sink for receiving ping data. The spatial
+	// reference describes the beam coordinates and Z values of the ping data,
+	// and the output options the optional ping and beam data.
+	OpenPings(fi *FileInfo, sref *SpatialReference, outputs *OutputOptions) error
+
+	// Dense indicates whether the beam data for each ping is to be padded
+	// to the maximum number of beams found across the GSF file.
+	Dense() bool
+
+	// WritePings receives a chunk of pings along with the ping and beam ids.
+	WritePings(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error
+
+	// Close finalises any outputs.
+	Close() error
+}
+
+// SpatialReference describes the horizontal and vertical reference of the
+// beam data handed to a Sink. If Projection is not nil, the ping data will
+// contain the projected beam coordinates.
+type SpatialReference struct {
+	Georef     GeorefMethod
+	Projection *Projection
+	Vertical   VerticalReduction
+}
+
+// spatialReference constructs the SpatialReference of the beam data as read
+// by the GsfFile.
+func (g *GsfFile) spatialReference() SpatialReference {
+	sref := SpatialReference{
+		Georef:     g.Georef,
+		Projection: g.Projection,
+		Vertical:   VerticalReduction{Reference: VREF_RECORDED},
+	}
+
+	if g.Vertical != nil {
+		sref.Vertical = *g.Vertical
+	}
+
+	return sref
+}
+
+// OutputOptions describes the optional ping and beam data handed to a Sink,
+// as produced by the PingProcessing. If Interpolated_attitude is true, the
+// ping data will contain the PingAttitude, and if Svp_selection is not empty,
+// the ping data will contain the PingSvp. If Decoded_flags is true, the ping
+// data will contain the BeamFlagAttrs (if BeamFlags exist). If the
+// Reject_policy excludes rejected beams, the ping data will contain the
+// PingRejected. If S44_order is not empty, the ping data will contain the
+// S44Attrs and PingS44.
+type OutputOptions struct {
+	Interpolated_attitude bool
+	Svp_selection         SvpSelection
+	Decoded_flags         bool
+	Reject_policy         RejectPolicy
+	S44_order             S44Order
+}
+
+// outputOptions constructs the OutputOptions of the ping data as produced by
+// the PingProcessing.
+func (pp *PingProcessing) outputOptions() OutputOptions {
+	outputs := OutputOptions{
+		Interpolated_attitude: pp.Attitude != nil,
+		Decoded_flags:         pp.Decode_flags,
+		Reject_policy:         pp.Reject_policy,
+	}
+
+	if pp.Svp != nil {
+		outputs.Svp_selection = pp.Svp.Selection
+	}
+
+	if pp.S44 != nil {
+		outputs.S44_order = pp.S44.Order
+	}
+
+	return outputs
+}
+
+// SbpToSink reads and decodes the SWATH_BATHYMETRY_PING records in chunks
+// and writes each chunk to the Sink. The decoding loop is common to every
+// Sink, so new outputs only need to implement the Sink interface.
+func (g *GsfFile) SbpToSink(fi *FileInfo, sink Sink) error {
+	sref := g.spatialReference()
+	outputs := g.Processing.outputOptions()
+	err := outputs.Reject_policy.check(sink.Dense())
+	if err != nil {
+		return err
+	}
+
+	err = sink.OpenPings(fi, &sref, &outputs)
+	if err != nil {
+		return err
+	}
+
+	err = g.pingChunks(fi, sink.Dense(), func(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error {
+		err := sink.WritePings(ping_data_chunk, ping_beam_ids)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingData chunk"))
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// ToSink decodes the metadata, attitude, SVP and swath bathymetry ping
+// records of the GSF file and writes them to the Sink.
+// The Sink is not closed, that is left to the caller.
+func (g *GsfFile) ToSink(fi *FileInfo, proc_info *ProcessingInfo, sink Sink) error {
+	err := sink.WriteMetadata(fi, proc_info)
+	if err != nil {
+		return err
+	}
+
+	att := g.AttitudeRecords(fi)
+	err = sink.WriteAttitude(&att)
+	if err != nil {
+		return err
+	}
+
+	// profiles held by the resolver may have had their positions inferred
+	var svp SoundVelocityProfile
+	if g.Processing.Svp != nil {
+		svp = *g.Processing.Svp.Profiles
+	} else {
+		svp = g.SoundVelocityProfileRecords(fi)
+	}
+	err = sink.WriteSvp(&svp)
+	if err != nil {
+		return err
+	}
+
+	return g.SbpToSink(fi, sink)
+}
+
+// TileDBSink writes the GSF data as TileDB arrays that are members of a
+// TileDB group.
+// If Grid_resolution is greater than zero, the beam data is additionally
+// binned into a Grid that is written to the group as Grid.tiledb on Close.
+// Likewise, if Mosaic_resolution is greater than zero, the backscatter given
+// by Mosaic_source is placed into a Mosaic that is written to the group as
+// Mosaic.tiledb on Close.
+// If Split_heads is true, the beam data of each sonar head (see PingHead) is
+// written to its own beam array, BeamData_Head<id>.tiledb, using the
+// Head_ping_number as the PingNumber, such that the [ping, beam] layout of
+// dense beam data is contiguous for each head. The ping domain of each head's
+// array is sized to the total number of pings, as the number of pings of each
+// head is unknown until the pings have been read.
+type TileDBSink struct {
+	Grid_resolution    float64
+	Mosaic_resolution  float64
+	Mosaic_source      BackscatterSource
+	Mosaic_normalise   bool
+	Split_heads        bool
+	gridder            *Gridder
+	mosaicker          *Mosaicker
+	ctx                *tiledb.Context
+	grp                *tiledb.Group
+	grp_uri            string
+	dense_bd           bool
+	projected_dims     bool
+	owns_grp           bool
+	contains_intensity bool
+	sensor_id          SubRecordID
+	sref               SpatialReference
+	outputs            OutputOptions
+	beam_subrecords    []string
+	npings             uint64
+	max_beams          uint16
+	ph_array           *tiledb.Array
+	s_md_array         *tiledb.Array
+	si_md_array        *tiledb.Array
+	bd_array           *tiledb.Array
+	head_arrays        map[uint8]*tiledb.Array
+}
+
+// NewTileDBSink creates a TileDB group at grp_uri and opens it in write mode.
+// The group is closed when the Sink is closed.
+// When dense_bd is true, the beam data is written to a dense array using
+// [ping, beam] as the dimensional axes, otherwise a sparse array is used.
+// When projected_dims is true, and the GSF file has a Projection, the sparse
+// array will use the projected coordinates as the dimensional axes.
+func NewTileDBSink(ctx *tiledb.Context, grp_uri string, dense_bd, projected_dims bool) (*TileDBSink, error) {
+	grp, err := tiledb.NewGroup(ctx, grp_uri)
+	if err != nil {
+		return nil, err
+	}
+
+	err = grp.Create()
+	if err != nil {
+		grp.Free()
+		return nil, errors.Join(err, errors.New("Error creating tiledb group"))
+	}
+
+	err = grp.Open(tiledb.TILEDB_WRITE)
+	if err != nil {
+		grp.Free()
+		return nil, errors.Join(err, errors.New("Error opening tiledb group in write mode"))
+	}
+
+	sink := TileDBSink{
+		ctx:            ctx,
+		grp:            grp,
+		grp_uri:        grp_uri,
+		dense_bd:       dense_bd,
+		projected_dims: projected_dims,
+		owns_grp:       true,
+	}
+
+	return &sink, nil
+}
+
+// WriteMetadata writes the GSF data processing information to the group
+// metadata.
+func (ts *TileDBSink) WriteMetadata(fi *FileInfo, proc_info *ProcessingInfo) error {
+	jsn, err := JsonIndentDumps(proc_info)
+	if err != nil {
+		return err
+	}
+
+	return ts.grp.PutMetadata("Data-Processing-Information", jsn)
+}
+
+// WriteAttitude writes the attitude data to a TileDB array and adds it to the
+// group.
+func (ts *TileDBSink) WriteAttitude(att *Attitude) error {
+	att_name := "Attitude.tiledb"
+	err := att.ToTileDB(filepath.Join(ts.grp_uri, att_name), ts.ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ts.grp.AddMember(att_name, "Attitude", true)
+	if err != nil {
+		return errors.Join(err, errors.New("Error adding attitude to group"))
+	}
+
+	return nil
+}
+
+// WriteSvp writes the sound velocity profile data to a TileDB array and adds
+// it to the group.
+func (ts *TileDBSink) WriteSvp(svp *SoundVelocityProfile) error {
+	svp_name := "SVP.tiledb"
+	err := svp.ToTileDB(filepath.Join(ts.grp_uri, svp_name), ts.ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ts.grp.AddMember(svp_name, "SVP", true)
+	if err != nil {
+		return errors.Join(err, errors.New("Error adding svp to group"))
+	}
+
+	return nil
+}
+
+// OpenPings creates the PingHeader, SensorMetadata, SensorImageryMetadata
+// (if intensity exists) and BeamData TileDB arrays, adds them to the group,
+// and opens them for writing. If Split_heads is true, the beam array of each
+// head is instead created as the head is encountered by WritePings.
+func (ts *TileDBSink) OpenPings(fi *FileInfo, sref *SpatialReference, outputs *OutputOptions) error {
+	ts.contains_intensity = lo.Contains(fi.SubRecord_Schema, SubRecordNames[INTENSITY_SERIES])
+	ts.sensor_id = SubRecordID(fi.Metadata.Sensor_Info.Sensor_ID)
+	ts.sref = *sref
+	ts.outputs = *outputs
+	ts.beam_subrecords = fi.SubRecord_Schema
+	ts.npings = fi.Record_Counts[RecordNames[SWATH_BATHYMETRY_PING]]
+	ts.max_beams = fi.Metadata.Quality_Info.Min_Max_Beams[1]
+
+	// output locations
+	ph_name := "PingHeader.tiledb"
+	ph_aname := "PingHeader"
+	s_md_name := "SensorMetadata.tiledb"
+	s_md_aname := "SensorMetadata"
+	si_md_name := "SensorImageryMetadata.tiledb"
+	si_md_aname := "SensorImageryMetadata"
+	bd_name := "BeamData.tiledb"
+	bd_aname := "BeamData"
+	ph_uri := filepath.Join(ts.grp_uri, ph_name)
+	s_md_uri := filepath.Join(ts.grp_uri, s_md_name)
+	si_md_uri := filepath.Join(ts.grp_uri, si_md_name)
+	bd_uri := filepath.Join(ts.grp_uri, bd_name)
+	if ts.Split_heads {
+		bd_uri = ""
+		ts.head_arrays = make(map[uint8]*tiledb.Array)
+	}
+
+	err := fi.pingTdbArrays(ts.ctx, ph_uri, s_md_uri, si_md_uri, bd_uri, ts.dense_bd, sref, outputs, ts.projected_dims)
+	if err != nil {
+		return errors.Join(err, errors.New("Error creating PingData TileDB arrays"))
+	}
+
+	// add arrays to tiledb group
+	err = ts.grp.AddMember(ph_name, ph_aname, true)
+	if err != nil {
+		return errors.Join(err, errors.New("Error adding ping headers to group"))
+	}
+	err = ts.grp.AddMember(s_md_name, s_md_aname, true)
+	if err != nil {
+		return errors.Join(err, errors.New("Error adding sensor metadata to group"))
+	}
+	if !ts.Split_heads {
+		err = ts.grp.AddMember(bd_name, bd_aname, true)
+		if err != nil {
+			return errors.Join(err, errors.New("Error adding beam data to group"))
+		}
+	}
+
+	// open the arrays for writing
+
+	// PingHeaders
+	ts.ph_array, err = ArrayOpenWrite(ts.ctx, ph_uri)
+	if err != nil {
+		return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) PingHeaders TileDB array"))
+	}
+
+	// SensorMetadata
+	ts.s_md_array, err = ArrayOpenWrite(ts.ctx, s_md_uri)
+	if err != nil {
+		return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) SensorMetadata TileDB array"))
+	}
+
+	// SensorImageryMetadata (only exists if intensity exists)
+	if ts.contains_intensity {
+		err = ts.grp.AddMember(si_md_name, si_md_aname, true)
+		if err != nil {
+			return errors.Join(err, errors.New("Error adding sensor imagery metadata to group"))
+		}
+
+		ts.si_md_array, err = ArrayOpenWrite(ts.ctx, si_md_uri)
+		if err != nil {
+			return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) SensorImageryMetadata TileDB array"))
+		}
+	}
+
+	// beam data; BeamArray, LonLat, PingBeamNumbers, BrbIntensity
+	if !ts.Split_heads {
+		ts.bd_array, err = ArrayOpenWrite(ts.ctx, bd_uri)
+		if err != nil {
+			return errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) TileDB beam array"))
+		}
+	}
+
+	if ts.Grid_resolution > 0.0 {
+		ts.gridder, err = NewGridder(ts.Grid_resolution, sref, fi.Metadata.CRS)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ts.Mosaic_resolution > 0.0 {
+		ts.mosaicker, err = NewMosaicker(ts.Mosaic_resolution, sref, fi.Metadata.CRS, ts.Mosaic_source, ts.Mosaic_normalise)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Dense returns true if the beam data is written to a dense array.
+func (ts *TileDBSink) Dense() bool {
+	return ts.dense_bd
+}
+
+// headArray retrieves the beam array of a head, creating the array, adding it
+// to the group and opening it for writing if the head hasn't been encountered.
+// The head id is recorded in the array metadata.
+func (ts *TileDBSink) headArray(head uint8) (*tiledb.Array, error) {
+	array, ok := ts.head_arrays[head]
+	if ok {
+		return array, nil
+	}
+
+	bd_aname := "BeamData_Head" + strconv.Itoa(int(head))
+	bd_name := bd_aname + ".tiledb"
+	bd_uri := filepath.Join(ts.grp_uri, bd_name)
+
+	err := beamTdbArray(ts.ctx, bd_uri, ts.beam_subrecords, ts.contains_intensity, ts.dense_bd, ts.npings, ts.max_beams, &ts.sref, &ts.outputs, ts.projected_dims)
+	if err != nil {
+		return nil, errors.Join(err, ErrSplitHeads, errors.New("Error creating TileDB beam array for head: "+strconv.Itoa(int(head))))
+	}
+
+	err = WriteArrayMetadata(ts.ctx, bd_uri, "Head_id", head)
+	if err != nil {
+		return nil, errors.Join(err, ErrSplitHeads)
+	}
+
+	err = ts.grp.AddMember(bd_name, bd_aname, true)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("Error adding beam data to group"))
+	}
+
+	array, err = ArrayOpenWrite(ts.ctx, bd_uri)
+	if err != nil {
+		return nil, errors.Join(err, ErrWriteBdTdb, errors.New("Error opening (w) TileDB beam array"))
+	}
+	ts.head_arrays[head] = array
+
+	return array, nil
+}
+
+// writeHeads serialises a chunk of pings to the TileDB arrays, with the
+// beam data of each head written to the head's beam array.
+func (ts *TileDBSink) writeHeads(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error {
+	err := ping_data_chunk.pingMetadataToTileDB(
+		ts.ph_array,
+		ts.s_md_array,
+		ts.si_md_array,
+		ts.ctx,
+		ts.sensor_id,
+		ts.contains_intensity,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, head := range ping_data_chunk.Ping_head.Heads() {
+		head_data, head_ids, ok := ping_data_chunk.headBeams(head, ping_beam_ids)
+		if !ok {
+			return errors.Join(ErrSplitHeads, errors.New("Unable to determine the beams of each ping"))
+		}
+		if len(head_ids.PingNumber) == 0 {
+			continue
+		}
+
+		array, err := ts.headArray(head)
+		if err != nil {
+			return err
+		}
+
+		err = head_data.beamDataToTileDB(array, ts.ctx, head_ids, ts.outputs.Reject_policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WritePings serialises a chunk of pings to the TileDB arrays, and if
+// required, bins the beam data into the grid and the backscatter into the
+// mosaic.
+func (ts *TileDBSink) WritePings(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error {
+	if ts.gridder != nil {
+		ts.gridder.Add(ping_data_chunk)
+	}
+	if ts.mosaicker != nil {
+		ts.mosaicker.Add(ping_data_chunk)
+	}
+
+	if ts.Split_heads {
+		return ts.writeHeads(ping_data_chunk, ping_beam_ids)
+	}
+
+	return ping_data_chunk.toTileDB(
+		ts.ph_array,
+		ts.s_md_array,
+		ts.si_md_array,
+		ts.bd_array,
+		ts.ctx,
+		ping_beam_ids,
+		ts.sensor_id,
+		ts.contains_intensity,
+		ts.outputs.Reject_policy,
+	)
+}
+
+// closePings closes and frees the ping data arrays.
+func (ts *TileDBSink) closePings() error {
+	var errs []error
+
+	arrays := []*tiledb.Array{ts.ph_array, ts.s_md_array, ts.si_md_array, ts.bd_array}
+	arrays = append(arrays, lo.Values(ts.head_arrays)...)
+	for _, array := range arrays {
+		if array == nil {
+			continue
+		}
+		errs = append(errs, array.Close())
+		array.Free()
+	}
+
+	ts.ph_array = nil
+	ts.s_md_array = nil
+	ts.si_md_array = nil
+	ts.bd_array = nil
+	ts.head_arrays = nil
+
+	return errors.Join(errs...)
+}
+
+// closeGrid writes the grid (if any soundings were binned) to a TileDB array
+// and adds it to the group.
+func (ts *TileDBSink) closeGrid() error {
+	if ts.gridder == nil {
+		return nil
+	}
+
+	grid, ok := ts.gridder.Grid()
+	ts.gridder = nil
+	if !ok {
+		return nil
+	}
+
+	grid_name := "Grid.tiledb"
+	err := grid.ToTileDB(filepath.Join(ts.grp_uri, grid_name), ts.ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ts.grp.AddMember(grid_name, "Grid", true)
+	if err != nil {
+		return errors.Join(err, errors.New("Error adding grid to group"))
+	}
+
+	return nil
+}
+
+// closeMosaic writes the mosaic (if any backscatter was placed) to a TileDB
+// array and adds it to the group.
+func (ts *TileDBSink) closeMosaic() error {
+	if ts.mosaicker == nil {
+		return nil
+	}
+
+	mosaic, ok := ts.mosaicker.Mosaic()
+	ts.mosaicker = nil
+	if !ok {
+		return nil
+	}
+
+	mosaic_name := "Mosaic.tiledb"
+	err := mosaic.ToTileDB(filepath.Join(ts.grp_uri, mosaic_name), ts.ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ts.grp.AddMember(mosaic_name, "Mosaic", true)
+	if err != nil {
+		return errors.Join(err, errors.New("Error adding mosaic to group"))
+	}
+
+	return nil
+}
+
+// Close closes the ping data arrays, writes the grid and mosaic (if required),
+// and closes the TileDB group if it was created by NewTileDBSink.
+func (ts *TileDBSink) Close() error {
+	err := errors.Join(ts.closePings(), ts.closeGrid(), ts.closeMosaic())
+
+	if ts.owns_grp && ts.grp != nil {
+		err = errors.Join(err, ts.grp.Close())
+		ts.grp.Free()
+		ts.grp = nil
+	}
+
+	return err
+}
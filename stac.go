@@ -0,0 +1,214 @@
+package gsf
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+
+	tiledb "github.com/TileDB-Inc/TileDB-Go"
+)
+
+const (
+	STAC_VERSION        = "1.0.0"
+	STAC_PROJ_EXTENSION = "https://stac-extensions.github.io/projection/v1.1.0/schema.json"
+)
+
+// StacAsset is a minimal representation of a STAC Asset object.
+type StacAsset struct {
+	Href  string   `json:"href"`
+	Title string   `json:"title,omitempty"`
+	Type  string   `json:"type,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// StacLink is a minimal representation of a STAC Link object.
+type StacLink struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+// StacItem is a minimal representation of a STAC Item, which is a GeoJSON
+// Feature with additional fields describing the temporal extent and assets.
+type StacItem struct {
+	Type            string               `json:"type"`
+	Stac_version    string               `json:"stac_version"`
+	Stac_extensions []string             `json:"stac_extensions"`
+	Id              string               `json:"id"`
+	Geometry        *GeoJsonGeometry     `json:"geometry"`
+	Bbox            []float64            `json:"bbox,omitempty"`
+	Properties      map[string]any       `json:"properties"`
+	Links           []StacLink           `json:"links"`
+	Assets          map[string]StacAsset `json:"assets"`
+}
+
+// bboxPolygon constructs a GeoJSON Polygon from a [west, south, east, north]
+// bounding box.
+func bboxPolygon(bbox []float64) *GeoJsonGeometry {
+	ring := [][]float64{
+		{bbox[0], bbox[1]},
+		{bbox[2], bbox[1]},
+		{bbox[2], bbox[3]},
+		{bbox[0], bbox[3]},
+		{bbox[0], bbox[1]},
+	}
+
+	return &GeoJsonGeometry{Type: "Polygon", Coordinates: [][][]float64{ring}}
+}
+
+// lonLatBbox calculates the [west, south, east, north] bounding box of the
+// LonLat coordinates. Nil is returned if there are no coordinates.
+func lonLatBbox(ll *LonLat) []float64 {
+	if len(ll.Longitude) == 0 {
+		return nil
+	}
+
+	bbox := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for i := range ll.Longitude {
+		bbox[0] = math.Min(bbox[0], ll.Longitude[i])
+		bbox[1] = math.Min(bbox[1], ll.Latitude[i])
+		bbox[2] = math.Max(bbox[2], ll.Longitude[i])
+		bbox[3] = math.Max(bbox[3], ll.Latitude[i])
+	}
+
+	return bbox
+}
+
+// surveyBbox returns the [west, south, east, north] bounding box of the
+// survey, sourced from the SWATH_BATHY_SUMMARY record, or the SwathCoverage
+// if the GSF file contains no summary record.
+// Nil is returned if neither contain any coordinates.
+func surveyBbox(fi *FileInfo, coverage *SwathCoverage) []float64 {
+	if fi.Metadata.Record_Counts[RecordNames[SWATH_BATHY_SUMMARY]] > 0 {
+		summary := &fi.Metadata.Swath_Summary
+		return []float64{summary.Min_longitude, summary.Min_latitude, summary.Max_longitude, summary.Max_latitude}
+	}
+
+	return coverage.bbox()
+}
+
+// bbox returns the [west, south, east, north] bounding box of the swath
+// footprint, or the trackline if no footprint could be constructed.
+// Nil is returned if neither contain any coordinates.
+func (sc *SwathCoverage) bbox() []float64 {
+	bbox := lonLatBbox(&sc.Footprint)
+	if bbox == nil {
+		bbox = lonLatBbox(&sc.Trackline)
+	}
+
+	return bbox
+}
+
+// SurveyCentroid returns the centre of the survey bounding box.
+// The returned bool is false if the survey extent is unknown.
+func SurveyCentroid(fi *FileInfo, coverage *SwathCoverage) (float64, float64, bool) {
+	bbox := surveyBbox(fi, coverage)
+	if bbox == nil {
+		return 0.0, 0.0, false
+	}
+
+	return (bbox[0] + bbox[2]) / 2.0, (bbox[1] + bbox[3]) / 2.0, true
+}
+
+// NewStacItem constructs a STAC Item for a GSF file.
+// The spatial and temporal extents are sourced from the SWATH_BATHY_SUMMARY
+// record, and fall back to the SwathCoverage derived from the ping headers when
+// the GSF file contains no summary record. The geometry is the swath footprint,
+// or the bounding box if no footprint could be constructed.
+// The supplied assets are attached to the item as is.
+func NewStacItem(fi *FileInfo, coverage *SwathCoverage, assets map[string]StacAsset) StacItem {
+	var geometry *GeoJsonGeometry
+
+	summary := &fi.Metadata.Swath_Summary
+	start_datetime := summary.Start_datetime
+	end_datetime := summary.End_datetime
+
+	bbox := surveyBbox(fi, coverage)
+	if fi.Metadata.Record_Counts[RecordNames[SWATH_BATHY_SUMMARY]] == 0 {
+		start_datetime = coverage.Start_datetime
+		end_datetime = coverage.End_datetime
+	}
+
+	geometry = coverage.FootprintGeometry()
+	if geometry == nil && bbox != nil {
+		geometry = bboxPolygon(bbox)
+	}
+
+	properties := map[string]any{
+		"datetime":             nil,
+		"start_datetime":       start_datetime,
+		"end_datetime":         end_datetime,
+		"instruments":          []string{fi.Metadata.Sensor_Info.Sensor_Name},
+		"gsf:sensor_id":        fi.Metadata.Sensor_Info.Sensor_ID,
+		"gsf:version":          fi.Metadata.GSF_Details.GSF_Version,
+		"gsf:horizontal_datum": fi.Metadata.CRS.Horizontal_Datum,
+		"gsf:vertical_datum":   fi.Metadata.CRS.Vertical_Datum,
+		"proj:epsg":            nil,
+	}
+
+	epsg, ok := fi.Metadata.CRS.Epsg()
+	if ok {
+		properties["proj:epsg"] = epsg
+	}
+
+	if bbox != nil {
+		// coordinates are geographic, so the projected bbox is the same
+		properties["proj:bbox"] = bbox
+	}
+
+	if assets == nil {
+		assets = make(map[string]StacAsset)
+	}
+
+	item := StacItem{
+		Type:            "Feature",
+		Stac_version:    STAC_VERSION,
+		Stac_extensions: []string{STAC_PROJ_EXTENSION},
+		Id:              filepath.Base(fi.Metadata.GSF_Details.GSF_URI),
+		Geometry:        geometry,
+		Bbox:            bbox,
+		Properties:      properties,
+		Links:           make([]StacLink, 0),
+		Assets:          assets,
+	}
+
+	return item
+}
+
+// TileDBGroupAssets constructs a STAC Asset for each member of a TileDB
+// group, keyed by the member name.
+func TileDBGroupAssets(ctx *tiledb.Context, grp_uri string) (map[string]StacAsset, error) {
+	assets := make(map[string]StacAsset)
+
+	grp, err := tiledb.NewGroup(ctx, grp_uri)
+	if err != nil {
+		return assets, err
+	}
+	defer grp.Free()
+
+	err = grp.Open(tiledb.TILEDB_READ)
+	if err != nil {
+		return assets, errors.Join(err, errors.New("Error opening tiledb group in read mode"))
+	}
+
+	count, err := grp.GetMemberCount()
+	if err != nil {
+		return assets, err
+	}
+
+	for i := uint64(0); i < count; i++ {
+		uri, name, _, err := grp.GetMemberFromIndex(i)
+		if err != nil {
+			return assets, errors.Join(err, errors.New("Error retrieving tiledb group member"))
+		}
+
+		assets[name] = StacAsset{
+			Href:  uri,
+			Title: name,
+			Type:  "application/x-tiledb",
+			Roles: []string{"data"},
+		}
+	}
+
+	return assets, nil
+}
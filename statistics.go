@@ -0,0 +1,134 @@
+package gsf
+
+import (
+	"math"
+)
+
+// PingStatistics contains summary statistics of the beams of each ping,
+// enabling pings to be assessed without reading the beam data.
+// Depths are the negated Z values (positive down), and only the valid beams
+// (a non-null Z, and not rejected by the BeamFlags) are included.
+// Swath_width is the distance between the AcrossTrack extremes of the valid
+// beams, Flagged_beams is the number of beams rejected by their BeamFlags,
+// and Nadir_depth is the depth of the Centre_beam (if valid).
+// Statistics that can't be computed are NaN.
+type PingStatistics struct {
+	Depth_min           []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+	Depth_max           []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+	Depth_mean          []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+	Swath_width         []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+	Valid_beams         []uint16  `tiledb:"dtype=uint16,ftype=attr" filters:"zstd(level=16)"`
+	Flagged_beams       []uint16  `tiledb:"dtype=uint16,ftype=attr" filters:"zstd(level=16)"`
+	Vertical_error_mean []float32 `tiledb:"dtype=float32,ftype=attr" filters:"zstd(level=16)"`
+	Nadir_depth         []float64 `tiledb:"dtype=float64,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// newPingStatistics initialises the PingStatistics for npings, with each
+// statistic set to NaN and each count to zero.
+func newPingStatistics(npings int) PingStatistics {
+	ps := PingStatistics{
+		Depth_min:           make([]float64, npings),
+		Depth_max:           make([]float64, npings),
+		Depth_mean:          make([]float64, npings),
+		Swath_width:         make([]float64, npings),
+		Valid_beams:         make([]uint16, npings),
+		Flagged_beams:       make([]uint16, npings),
+		Vertical_error_mean: make([]float32, npings),
+		Nadir_depth:         make([]float64, npings),
+	}
+
+	nan := math.NaN()
+	for i := 0; i < npings; i++ {
+		ps.Depth_min[i] = nan
+		ps.Depth_max[i] = nan
+		ps.Depth_mean[i] = nan
+		ps.Swath_width[i] = nan
+		ps.Vertical_error_mean[i] = float32(nan)
+		ps.Nadir_depth[i] = nan
+	}
+
+	return ps
+}
+
+// pingStatistics computes the PingStatistics for each ping contained within
+// the PingData. Padded beams (dense beam data) are excluded.
+func (pd *PingData) pingStatistics() PingStatistics {
+	hdr := &pd.Ping_headers
+	ba := &pd.Beam_array
+	ps := newPingStatistics(len(hdr.Number_beams))
+
+	nbeams := len(pd.Lon_lat.Longitude)
+	if len(ba.Z) != nbeams {
+		return ps
+	}
+
+	has_flags := len(ba.BeamFlags) == nbeams
+	has_across := len(ba.AcrossTrack) == nbeams
+	has_error := len(ba.VerticalError) == nbeams
+
+	for ping, rng := range pd.pingBeamRanges() {
+		var (
+			valid      uint16
+			sum_depth  float64
+			n_errors   uint16
+			sum_error  float64
+			min_across float64 = math.Inf(1)
+			max_across float64 = math.Inf(-1)
+		)
+
+		centre := -1
+		if ping < len(hdr.Centre_beam) && int(hdr.Centre_beam[ping]) < rng[1]-rng[0] {
+			centre = rng[0] + int(hdr.Centre_beam[ping])
+		}
+
+		for i := rng[0]; i < rng[1]; i++ {
+			if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+				ps.Flagged_beams[ping]++
+				continue
+			}
+
+			z := ba.Z[i]
+			if z == NULL_DEPTH_F64 || math.IsNaN(z) {
+				continue
+			}
+
+			depth := -z
+			if valid == 0 {
+				ps.Depth_min[ping] = depth
+				ps.Depth_max[ping] = depth
+			}
+			valid++
+			sum_depth += depth
+			ps.Depth_min[ping] = math.Min(ps.Depth_min[ping], depth)
+			ps.Depth_max[ping] = math.Max(ps.Depth_max[ping], depth)
+
+			if i == centre {
+				ps.Nadir_depth[ping] = depth
+			}
+
+			if has_across && !math.IsNaN(ba.AcrossTrack[i]) {
+				min_across = math.Min(min_across, ba.AcrossTrack[i])
+				max_across = math.Max(max_across, ba.AcrossTrack[i])
+			}
+
+			// null vertical errors are not positive, being zero when padded
+			if has_error && ba.VerticalError[i] > 0.0 {
+				n_errors++
+				sum_error += float64(ba.VerticalError[i])
+			}
+		}
+
+		ps.Valid_beams[ping] = valid
+		if valid > 0 {
+			ps.Depth_mean[ping] = sum_depth / float64(valid)
+		}
+		if max_across >= min_across {
+			ps.Swath_width[ping] = max_across - min_across
+		}
+		if n_errors > 0 {
+			ps.Vertical_error_mean[ping] = float32(sum_error / float64(n_errors))
+		}
+	}
+
+	return ps
+}
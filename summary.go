@@ -3,6 +3,10 @@ package gsf
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"log"
+	"math"
+	"strconv"
 	"time"
 )
 
@@ -55,3 +59,169 @@ func DecodeSwathBathySummary(reader *bytes.Reader) SwathBathySummary {
 
 	return summary
 }
+
+// SummaryTolerances are the tolerances used when comparing the stored
+// SWATH_BATHY_SUMMARY against the summary computed from the ping data.
+// Time is in seconds, Position in degrees and Depth in metres.
+type SummaryTolerances struct {
+	Time     float64
+	Position float64
+	Depth    float64
+}
+
+// DEFAULT_SUMMARY_TOLERANCES are the tolerances used by the converter.
+// The positional tolerance accounts for differences in the georeferencing
+// of the beams between the software that wrote the GSF file and this module.
+var DEFAULT_SUMMARY_TOLERANCES = SummaryTolerances{
+	Time:     1.0,
+	Position: 0.001,
+	Depth:    0.5,
+}
+
+// SummaryDiscrepancy is a SwathBathySummary field whose stored and computed
+// values differ by more than the Tolerance. Difference is computed minus stored,
+// in the units of the tolerance.
+type SummaryDiscrepancy struct {
+	Field      string
+	Difference float64
+	Tolerance  float64
+}
+
+// SummaryValidation contains the comparison of the stored SWATH_BATHY_SUMMARY
+// against the summary computed from the ping data. Summary_Present is false if
+// the GSF file doesn't contain a SWATH_BATHY_SUMMARY record, in which case no
+// comparison is made. Consistent is true if the stored summary exists and
+// there are no discrepancies.
+type SummaryValidation struct {
+	Summary_Present  bool
+	Computed_Summary SwathBathySummary
+	Tolerances       SummaryTolerances
+	Consistent       bool
+	Discrepancies    []SummaryDiscrepancy
+}
+
+// ComputeSwathSummary reads every SWATH_BATHYMETRY_PING record and computes
+// the temporal, longitude/latitude and depth extents of the data, for
+// comparison against the stored SWATH_BATHY_SUMMARY record.
+// The temporal extent uses the ping timestamps, and the spatial and depth
+// extents use the beams that are not rejected (see BeamFlag.IsRejected, if
+// the beam flags exist) with a valid position and Z value. Depths are the
+// negated Z values (positive down). Any vertical reduction or georeferencing
+// method set on the GsfFile is applied when reading the pings, so for a
+// like for like comparison these should be unset.
+// Pings that fail to decode are logged and skipped. An error is returned
+// if no valid beams are found.
+func (g *GsfFile) ComputeSwathSummary(fi *FileInfo) (SwathBathySummary, error) {
+	var (
+		summary SwathBathySummary
+		valid   bool
+	)
+
+	npings := fi.Record_Counts[RecordNames[SWATH_BATHYMETRY_PING]]
+
+	// get the original starting point so we can jump back when done
+	original_pos, _ := Tell(g.Stream)
+
+	for idx := uint64(0); idx < npings; idx++ {
+		ping_data, err := g.readPing(fi, idx)
+		if err != nil {
+			errn := errors.New("Error reading ping: " + strconv.Itoa(int(idx)))
+			log.Println(errors.Join(err, errn))
+			log.Println("Skipping PingID: ", idx)
+			continue
+		}
+
+		timestamp := ping_data.Ping_headers.Timestamp[0]
+		if summary.Start_datetime.IsZero() || timestamp.Before(summary.Start_datetime) {
+			summary.Start_datetime = timestamp
+		}
+		if timestamp.After(summary.End_datetime) {
+			summary.End_datetime = timestamp
+		}
+
+		ba := &ping_data.Beam_array
+		lon := ping_data.Lon_lat.Longitude
+		lat := ping_data.Lon_lat.Latitude
+		if len(ba.Z) != len(lon) {
+			continue
+		}
+		has_flags := len(ba.BeamFlags) == len(ba.Z)
+
+		for i, z := range ba.Z {
+			if z == NULL_DEPTH_F64 || math.IsNaN(z) {
+				continue
+			}
+			if has_flags && BeamFlag(ba.BeamFlags[i]).IsRejected() {
+				continue
+			}
+			if lon[i] == NULL_LONGITUDE_F64 || lat[i] == NULL_LATITUDE_F64 {
+				continue
+			}
+			if math.IsNaN(lon[i]) || math.IsNaN(lat[i]) {
+				continue
+			}
+
+			depth := -z
+			if !valid {
+				summary.Min_longitude = lon[i]
+				summary.Max_longitude = lon[i]
+				summary.Min_latitude = lat[i]
+				summary.Max_latitude = lat[i]
+				summary.Min_depth = depth
+				summary.Max_depth = depth
+				valid = true
+			}
+
+			summary.Min_longitude = math.Min(summary.Min_longitude, lon[i])
+			summary.Max_longitude = math.Max(summary.Max_longitude, lon[i])
+			summary.Min_latitude = math.Min(summary.Min_latitude, lat[i])
+			summary.Max_latitude = math.Max(summary.Max_latitude, lat[i])
+			summary.Min_depth = math.Min(summary.Min_depth, depth)
+			summary.Max_depth = math.Max(summary.Max_depth, depth)
+		}
+	}
+
+	// reset file position
+	_, _ = g.Stream.Seek(original_pos, 0)
+
+	if !valid {
+		return summary, errors.Join(ErrSwathSummary, errors.New("No valid beams found"))
+	}
+
+	return summary, nil
+}
+
+// SummaryQA compares the stored SWATH_BATHY_SUMMARY against the computed
+// summary, reporting the fields that differ by more than the tolerances, and
+// records the result in the QualityInfo.
+func (fi *FileInfo) SummaryQA(computed SwathBathySummary, tolerances SummaryTolerances) {
+	sv := SummaryValidation{
+		Summary_Present:  fi.Record_Counts[RecordNames[SWATH_BATHY_SUMMARY]] > 0,
+		Computed_Summary: computed,
+		Tolerances:       tolerances,
+		Discrepancies:    make([]SummaryDiscrepancy, 0),
+	}
+
+	if sv.Summary_Present {
+		stored := &fi.Metadata.Swath_Summary
+
+		compare := func(field string, difference, tolerance float64) {
+			if math.Abs(difference) > tolerance {
+				sv.Discrepancies = append(sv.Discrepancies, SummaryDiscrepancy{field, difference, tolerance})
+			}
+		}
+
+		compare("Start_datetime", computed.Start_datetime.Sub(stored.Start_datetime).Seconds(), tolerances.Time)
+		compare("End_datetime", computed.End_datetime.Sub(stored.End_datetime).Seconds(), tolerances.Time)
+		compare("Min_longitude", computed.Min_longitude-stored.Min_longitude, tolerances.Position)
+		compare("Max_longitude", computed.Max_longitude-stored.Max_longitude, tolerances.Position)
+		compare("Min_latitude", computed.Min_latitude-stored.Min_latitude, tolerances.Position)
+		compare("Max_latitude", computed.Max_latitude-stored.Max_latitude, tolerances.Position)
+		compare("Min_depth", computed.Min_depth-stored.Min_depth, tolerances.Depth)
+		compare("Max_depth", computed.Max_depth-stored.Max_depth, tolerances.Depth)
+
+		sv.Consistent = len(sv.Discrepancies) == 0
+	}
+
+	fi.Metadata.Quality_Info.Summary_Validation = sv
+}
@@ -0,0 +1,304 @@
+package gsf
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// The attributes of a SurveyFile that are compared across the files of a
+// survey, and reported as outliers.
+const (
+	OUTLIER_GSF_VERSION       = "GSF_Version"
+	OUTLIER_SENSOR            = "Sensor_Info"
+	OUTLIER_CRS               = "CRS"
+	OUTLIER_SUBRECORD_SCHEMA  = "SubRecord_Schema"
+	OUTLIER_BEAM_COUNT        = "Beam_Count"
+	OUTLIER_TIME_OVERLAP      = "Time_Overlap"
+	OUTLIER_NO_PINGS          = "No_Pings"
+	OUTLIER_DUPLICATE_PINGS   = "Duplicate_Pings"
+	OUTLIER_INCONSISTENT      = "Inconsistent_Schema"
+	OUTLIER_NAVIGATION_EVENTS = "Navigation_Events"
+	OUTLIER_READ_FAILURE      = "Read_Failure"
+)
+
+// SurveyFile summarises the metadata of a single GSF file of a survey.
+// The time coverage is given by the ping timestamps. Outliers lists the
+// attributes in which the file differs from the survey's consensus, or that
+// indicate a quality concern with the file.
+// Read_error contains the reason a file failed to be read, in which case the
+// file is only reported as a read failure.
+type SurveyFile struct {
+	GSF_URI          string
+	GSF_Version      string
+	Sensor_Info      SensorInfo
+	CRS              Crs
+	SubRecord_Schema []string
+	Quality_Info     QualityInfo
+	Pings            uint64
+	Start_datetime   time.Time
+	End_datetime     time.Time
+	Read_error       string
+	Outliers         []string
+}
+
+// SurveyFile constructs the SurveyFile summary of the FileInfo, enabling the
+// (comparatively large) FileInfo to be discarded when collating many files.
+func (fi *FileInfo) SurveyFile() SurveyFile {
+	sf := SurveyFile{
+		GSF_URI:          fi.GSF_Details.GSF_URI,
+		GSF_Version:      fi.GSF_Details.GSF_Version,
+		Sensor_Info:      fi.Sensor_Info,
+		CRS:              fi.CRS,
+		SubRecord_Schema: fi.SubRecord_Schema,
+		Quality_Info:     fi.Quality_Info,
+		Pings:            uint64(len(fi.Ping_Info)),
+		Outliers:         make([]string, 0),
+	}
+
+	for i, ping := range fi.Ping_Info {
+		if i == 0 || ping.Timestamp.Before(sf.Start_datetime) {
+			sf.Start_datetime = ping.Timestamp
+		}
+		if i == 0 || ping.Timestamp.After(sf.End_datetime) {
+			sf.End_datetime = ping.Timestamp
+		}
+	}
+
+	return sf
+}
+
+// maxBeams returns the maximum number of beams of the file's pings.
+func (sf *SurveyFile) maxBeams() uint16 {
+	if len(sf.Quality_Info.Min_Max_Beams) < 2 {
+		return 0
+	}
+	return sf.Quality_Info.Min_Max_Beams[1]
+}
+
+// schemaKey constructs an order independent key of the file's subrecord schema.
+func (sf *SurveyFile) schemaKey() string {
+	schema := append([]string{}, sf.SubRecord_Schema...)
+	sort.Strings(schema)
+	return strings.Join(schema, ",")
+}
+
+// SurveyConsensus contains the most common value of each compared attribute
+// across the files of a survey. Max_beams is the maximum number of beams per
+// ping.
+type SurveyConsensus struct {
+	GSF_Version      string
+	Sensor_Info      SensorInfo
+	CRS              Crs
+	SubRecord_Schema []string
+	Max_beams        uint16
+}
+
+// SurveyOverlap identifies two files whose time coverage overlaps, which can
+// indicate a file that has been duplicated or split inconsistently.
+type SurveyOverlap struct {
+	GSF_URI_A string
+	GSF_URI_B string
+	Overlap   float64
+}
+
+// SurveyReport is a consolidated report of the metadata of the GSF files of
+// a survey, ordered by their start time, highlighting the files that differ
+// from the survey's consensus. Variants counts the files for each distinct
+// value of the compared attributes, e.g. Variants["GSF_Version"]["GSF-v03.09"].
+// Consistent is true if no file has any outliers.
+type SurveyReport struct {
+	Files          []SurveyFile
+	Consensus      SurveyConsensus
+	Variants       map[string]map[string]int
+	Overlaps       []SurveyOverlap
+	Start_datetime time.Time
+	End_datetime   time.Time
+	Pings          uint64
+	Outlier_files  int
+	Consistent     bool
+}
+
+// surveyAttribute defines how an attribute of a SurveyFile is compared
+// across the files of a survey; key identifies the attribute's value, and
+// consensus records the value of a file as the survey's consensus.
+type surveyAttribute struct {
+	name      string
+	key       func(sf *SurveyFile) string
+	consensus func(sc *SurveyConsensus, sf *SurveyFile)
+}
+
+// surveyAttributes lists the attributes that are expected to be consistent
+// across the files of a survey.
+var surveyAttributes = []surveyAttribute{
+	{
+		name:      OUTLIER_GSF_VERSION,
+		key:       func(sf *SurveyFile) string { return sf.GSF_Version },
+		consensus: func(sc *SurveyConsensus, sf *SurveyFile) { sc.GSF_Version = sf.GSF_Version },
+	},
+	{
+		name: OUTLIER_SENSOR,
+		key: func(sf *SurveyFile) string {
+			return strconv.Itoa(int(sf.Sensor_Info.Sensor_ID)) + ": " + sf.Sensor_Info.Sensor_Name
+		},
+		consensus: func(sc *SurveyConsensus, sf *SurveyFile) { sc.Sensor_Info = sf.Sensor_Info },
+	},
+	{
+		name:      OUTLIER_CRS,
+		key:       func(sf *SurveyFile) string { return sf.CRS.Horizontal_Datum + "; " + sf.CRS.Vertical_Datum },
+		consensus: func(sc *SurveyConsensus, sf *SurveyFile) { sc.CRS = sf.CRS },
+	},
+	{
+		name:      OUTLIER_SUBRECORD_SCHEMA,
+		key:       func(sf *SurveyFile) string { return sf.schemaKey() },
+		consensus: func(sc *SurveyConsensus, sf *SurveyFile) { sc.SubRecord_Schema = sf.SubRecord_Schema },
+	},
+	{
+		name:      OUTLIER_BEAM_COUNT,
+		key:       func(sf *SurveyFile) string { return strconv.Itoa(int(sf.maxBeams())) },
+		consensus: func(sc *SurveyConsensus, sf *SurveyFile) { sc.Max_beams = sf.maxBeams() },
+	},
+}
+
+// modeIndex returns the index of the first file having the most common key,
+// along with the number of files for each key.
+func modeIndex(files []SurveyFile, key func(sf *SurveyFile) string) (int, map[string]int) {
+	counts := make(map[string]int)
+	for i := range files {
+		counts[key(&files[i])]++
+	}
+
+	idx, best := 0, 0
+	for i := range files {
+		if n := counts[key(&files[i])]; n > best {
+			idx, best = i, n
+		}
+	}
+
+	return idx, counts
+}
+
+// NewSurveyReport compares the files of a survey, identifying the consensus
+// of the GSF version, sensor, CRS, subrecord schema and beam count, and
+// reporting the files that differ from it as outliers. Files whose time
+// coverage overlaps another file, or that contain no pings, duplicate pings,
+// an inconsistent schema, or navigation QA events are also reported as
+// outliers. Files that failed to be read are reported as read failures, and
+// are excluded from the consensus and the comparisons.
+func NewSurveyReport(files []SurveyFile) SurveyReport {
+	report := SurveyReport{
+		Files:    files,
+		Variants: make(map[string]map[string]int),
+		Overlaps: make([]SurveyOverlap, 0),
+	}
+
+	if len(files) == 0 {
+		report.Consistent = true
+		return report
+	}
+
+	// files that failed to be read are ordered last, and only compared
+	// against the survey as a read failure
+	sort.SliceStable(files, func(i, j int) bool {
+		if (files[i].Read_error == "") != (files[j].Read_error == "") {
+			return files[i].Read_error == ""
+		}
+		return files[i].Start_datetime.Before(files[j].Start_datetime)
+	})
+
+	nread := len(files)
+	for i := range files {
+		if files[i].Read_error != "" {
+			files[i].Outliers = append(files[i].Outliers, OUTLIER_READ_FAILURE)
+			if i < nread {
+				nread = i
+			}
+		}
+	}
+	read := files[:nread]
+
+	for _, attr := range surveyAttributes {
+		if len(read) == 0 {
+			break
+		}
+
+		idx, counts := modeIndex(read, attr.key)
+		report.Variants[attr.name] = counts
+
+		attr.consensus(&report.Consensus, &read[idx])
+
+		consensus := attr.key(&read[idx])
+		for i := range read {
+			if attr.key(&read[i]) != consensus {
+				read[i].Outliers = append(read[i].Outliers, attr.name)
+			}
+		}
+	}
+
+	// files are ordered by start time, so only the subsequent files that
+	// start before the end of a file can overlap it
+	initialise := true
+	for i := range read {
+		sf := &read[i]
+		if sf.Pings == 0 {
+			sf.Outliers = append(sf.Outliers, OUTLIER_NO_PINGS)
+			continue
+		}
+
+		report.Pings += sf.Pings
+		if initialise || sf.Start_datetime.Before(report.Start_datetime) {
+			report.Start_datetime = sf.Start_datetime
+		}
+		if initialise || sf.End_datetime.After(report.End_datetime) {
+			report.End_datetime = sf.End_datetime
+		}
+		initialise = false
+
+		for j := i + 1; j < len(read); j++ {
+			other := &read[j]
+			if other.Pings == 0 {
+				continue
+			}
+			if !other.Start_datetime.Before(sf.End_datetime) {
+				break
+			}
+
+			end := sf.End_datetime
+			if other.End_datetime.Before(end) {
+				end = other.End_datetime
+			}
+
+			report.Overlaps = append(report.Overlaps, SurveyOverlap{
+				GSF_URI_A: sf.GSF_URI,
+				GSF_URI_B: other.GSF_URI,
+				Overlap:   end.Sub(other.Start_datetime).Seconds(),
+			})
+			sf.Outliers = append(sf.Outliers, OUTLIER_TIME_OVERLAP)
+			other.Outliers = append(other.Outliers, OUTLIER_TIME_OVERLAP)
+		}
+
+		qa := &sf.Quality_Info
+		if qa.Duplicate_Pings {
+			sf.Outliers = append(sf.Outliers, OUTLIER_DUPLICATE_PINGS)
+		}
+		if !qa.Consistent_Schema {
+			sf.Outliers = append(sf.Outliers, OUTLIER_INCONSISTENT)
+		}
+		if qa.Navigation.Events() > 0 {
+			sf.Outliers = append(sf.Outliers, OUTLIER_NAVIGATION_EVENTS)
+		}
+	}
+
+	for i := range files {
+		files[i].Outliers = lo.Uniq(files[i].Outliers)
+		if len(files[i].Outliers) > 0 {
+			report.Outlier_files++
+		}
+	}
+	report.Consistent = report.Outlier_files == 0
+
+	return report
+}
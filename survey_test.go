@@ -0,0 +1,63 @@
+package gsf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// TestNewSurveyReportReadFailure checks that a file that failed to be read
+// is reported only as a read failure, and doesn't influence the consensus
+// or the outliers of the other files.
+func TestNewSurveyReportReadFailure(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	survey_file := func(uri string, offset time.Duration) SurveyFile {
+		return SurveyFile{
+			GSF_URI:          uri,
+			GSF_Version:      "GSF-v03.09",
+			Sensor_Info:      SensorInfo{Sensor_ID: 1, Sensor_Name: "sensor"},
+			CRS:              Crs{Horizontal_Datum: "WGS84", Vertical_Datum: "UNKNOWN"},
+			SubRecord_Schema: []string{"DEPTH"},
+			Quality_Info:     QualityInfo{Min_Max_Beams: []uint16{256, 256}, Consistent_Schema: true},
+			Pings:            100,
+			Start_datetime:   start.Add(offset),
+			End_datetime:     start.Add(offset + time.Minute),
+			Outliers:         make([]string, 0),
+		}
+	}
+
+	// the failures outnumber the readable files, so would otherwise form the consensus
+	files := []SurveyFile{
+		{GSF_URI: "failed-a.gsf", Read_error: "corrupt record"},
+		survey_file("line-1.gsf", 0),
+		{GSF_URI: "failed-b.gsf", Read_error: "corrupt record"},
+		{GSF_URI: "failed-c.gsf", Read_error: "corrupt record"},
+		survey_file("line-2.gsf", 2*time.Minute),
+	}
+
+	report := NewSurveyReport(files)
+
+	if report.Consensus.GSF_Version != "GSF-v03.09" || report.Consensus.Max_beams != 256 {
+		t.Errorf("consensus = %+v, expected that of the readable files", report.Consensus)
+	}
+
+	for _, sf := range report.Files {
+		if sf.Read_error != "" {
+			if len(sf.Outliers) != 1 || sf.Outliers[0] != OUTLIER_READ_FAILURE {
+				t.Errorf("%s: outliers = %v, want [%s]", sf.GSF_URI, sf.Outliers, OUTLIER_READ_FAILURE)
+			}
+		} else if len(sf.Outliers) > 0 {
+			t.Errorf("%s: unexpected outliers %v", sf.GSF_URI, sf.Outliers)
+		}
+	}
+
+	if report.Outlier_files != 3 || report.Pings != 200 {
+		t.Errorf("outlier files = %d, pings = %d, want 3 and 200", report.Outlier_files, report.Pings)
+	}
+
+	if lo.Sum(lo.Values(report.Variants[OUTLIER_GSF_VERSION])) != 2 {
+		t.Errorf("variants = %v, expected only the readable files", report.Variants[OUTLIER_GSF_VERSION])
+	}
+}
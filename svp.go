@@ -8,6 +8,7 @@ import (
 	"time"
 
 	tiledb "github.com/TileDB-Inc/TileDB-Go"
+	"github.com/samber/lo"
 	stgpsr "github.com/yuin/stagparser"
 )
 
@@ -508,3 +509,219 @@ func (s *SoundVelocityProfile) ToTileDB(file_uri string, ctx *tiledb.Context) er
 
 	return nil
 }
+
+// SvpSelection identifies the policy used to associate a sound velocity
+// profile with each ping.
+type SvpSelection string
+
+const (
+	// SVP_APPLIED_TIME selects the most recent profile applied at, or prior
+	// to, the ping's timestamp.
+	SVP_APPLIED_TIME SvpSelection = "applied_time"
+
+	// SVP_OBSERVATION_TIME selects the profile observed closest in time to
+	// the ping's timestamp.
+	SVP_OBSERVATION_TIME SvpSelection = "observation_time"
+
+	// SVP_DISTANCE selects the profile observed closest to the ping's position.
+	SVP_DISTANCE SvpSelection = "distance"
+)
+
+// SvpSelections lists the supported SVP selection policies.
+var SvpSelections = []SvpSelection{
+	SVP_APPLIED_TIME,
+	SVP_OBSERVATION_TIME,
+	SVP_DISTANCE,
+}
+
+// NULL_SVP_INDEX indicates that no sound velocity profile could be associated
+// with a ping.
+const NULL_SVP_INDEX int32 = -1
+
+// PingSvp contains the index (row number) of the sound velocity profile
+// associated with each ping. It is intended as an additional PingHeaders column.
+type PingSvp struct {
+	Svp_index []int32 `tiledb:"dtype=int32,ftype=attr" filters:"zstd(level=16)"`
+}
+
+// SvpResolver associates each ping with a sound velocity profile using the
+// selection policy.
+type SvpResolver struct {
+	Selection SvpSelection
+	Profiles  *SoundVelocityProfile
+}
+
+// NewSvpResolver constructs a SvpResolver for the sound velocity profiles
+// using the selection policy.
+func NewSvpResolver(selection SvpSelection, svp *SoundVelocityProfile) (SvpResolver, error) {
+	var resolver SvpResolver
+
+	if !lo.Contains(SvpSelections, selection) {
+		return resolver, errors.Join(ErrSvpSelection, errors.New("Unsupported SVP selection: "+string(selection)))
+	}
+
+	resolver.Selection = selection
+	resolver.Profiles = svp
+
+	return resolver, nil
+}
+
+// positionMissing returns true if the position of the profile idx is null,
+// or is the (0, 0) position commonly recorded when the position is unknown.
+func (s *SoundVelocityProfile) positionMissing(idx int) bool {
+	lon := s.Longitude[idx]
+	lat := s.Latitude[idx]
+
+	if lon == NULL_LONGITUDE_F64 || lat == NULL_LATITUDE_F64 {
+		return true
+	}
+
+	return lon == 0.0 && lat == 0.0
+}
+
+// InferPositions backfills the missing positions of the sound velocity
+// profiles using the position of the ping closest in time to the profile's
+// observation time. The ping timestamps and positions are those of the vessel
+// reference point. Pings with a null position are ignored.
+// The number of profiles whose position was inferred is returned.
+func (s *SoundVelocityProfile) InferPositions(timestamps []time.Time, lon, lat []float64) int {
+	count := 0
+
+	for i := range s.Observation_timestamp {
+		if !s.positionMissing(i) {
+			continue
+		}
+
+		nearest := -1
+		var min_dt time.Duration
+		for j, t := range timestamps {
+			if lon[j] == NULL_LONGITUDE_F64 || lat[j] == NULL_LATITUDE_F64 {
+				continue
+			}
+
+			dt := t.Sub(s.Observation_timestamp[i])
+			if dt < 0 {
+				dt = -dt
+			}
+
+			if nearest == -1 || dt < min_dt {
+				nearest = j
+				min_dt = dt
+			}
+		}
+
+		if nearest == -1 {
+			continue
+		}
+
+		s.Longitude[i] = lon[nearest]
+		s.Latitude[i] = lat[nearest]
+		count++
+	}
+
+	return count
+}
+
+// index selects the profile for a single ping.
+func (sr *SvpResolver) index(t time.Time, lon, lat float64) int32 {
+	s := sr.Profiles
+	idx := NULL_SVP_INDEX
+
+	switch sr.Selection {
+	case SVP_APPLIED_TIME:
+		for i, applied := range s.Applied_timestamp {
+			if applied.After(t) {
+				continue
+			}
+			if idx == NULL_SVP_INDEX || applied.After(s.Applied_timestamp[idx]) {
+				idx = int32(i)
+			}
+		}
+	case SVP_OBSERVATION_TIME:
+		var min_dt time.Duration
+		for i, observed := range s.Observation_timestamp {
+			dt := t.Sub(observed)
+			if dt < 0 {
+				dt = -dt
+			}
+			if idx == NULL_SVP_INDEX || dt < min_dt {
+				idx = int32(i)
+				min_dt = dt
+			}
+		}
+	case SVP_DISTANCE:
+		if lon == NULL_LONGITUDE_F64 || lat == NULL_LATITUDE_F64 {
+			return NULL_SVP_INDEX
+		}
+
+		min_dist := 0.0
+		for i := range s.Longitude {
+			if s.positionMissing(i) {
+				continue
+			}
+			dist := GreatCircleDistance(lon, lat, s.Longitude[i], s.Latitude[i])
+			if idx == NULL_SVP_INDEX || dist < min_dist {
+				idx = int32(i)
+				min_dist = dist
+			}
+		}
+	}
+
+	return idx
+}
+
+// Resolve associates each ping, given by its timestamp and position, with a
+// sound velocity profile. Pings that can't be associated with a profile, eg
+// pings prior to the first applied profile, are given NULL_SVP_INDEX.
+// For the SVP_DISTANCE policy, profiles with missing positions are ignored,
+// so InferPositions should be called beforehand.
+func (sr *SvpResolver) Resolve(timestamps []time.Time, lon, lat []float64) PingSvp {
+	ps := PingSvp{Svp_index: make([]int32, len(timestamps))}
+
+	for i, t := range timestamps {
+		ps.Svp_index[i] = sr.index(t, lon[i], lat[i])
+	}
+
+	return ps
+}
+
+// PingPositions decodes the header of every SWATH_BATHYMETRY_PING record,
+// returning the timestamp and position of each ping.
+func (g *GsfFile) PingPositions(fi *FileInfo) ([]time.Time, []float64, []float64) {
+	records := fi.Record_Index[RecordNames[SWATH_BATHYMETRY_PING]]
+	timestamps := make([]time.Time, 0, len(records))
+	lon := make([]float64, 0, len(records))
+	lat := make([]float64, 0, len(records))
+
+	// get the original starting point so we can jump back when done
+	original_pos, _ := Tell(g.Stream)
+
+	for _, rec := range records {
+		buffer := g.RecBuf(rec)
+		hdr := decode_ping_hdr(bytes.NewReader(buffer), fi.Metadata.GSF_Details)
+
+		timestamps = append(timestamps, hdr.Timestamp)
+		lon = append(lon, hdr.Longitude)
+		lat = append(lat, hdr.Latitude)
+	}
+
+	// reset file position
+	_, _ = g.Stream.Seek(original_pos, 0)
+
+	return timestamps, lon, lat
+}
+
+// SvpResolver decodes the sound velocity profiles of the GSF file, backfills
+// any missing profile positions from the ping positions, and constructs a
+// SvpResolver using the selection policy. The number of profiles whose
+// position was inferred is also returned.
+func (g *GsfFile) SvpResolver(fi *FileInfo, selection SvpSelection) (SvpResolver, int, error) {
+	svp := g.SoundVelocityProfileRecords(fi)
+
+	timestamps, lon, lat := g.PingPositions(fi)
+	inferred := svp.InferPositions(timestamps, lon, lat)
+
+	resolver, err := NewSvpResolver(selection, &svp)
+
+	return resolver, inferred, err
+}
@@ -190,6 +190,20 @@ func CreateAttr(
 	schema *tiledb.ArraySchema,
 	ctx *tiledb.Context,
 ) error {
+	return createAttr(field_name, filter_defs, tiledb_defs, schema, ctx, false)
+}
+
+// createAttr creates the attribute as per CreateAttr. If nullable is true,
+// the attribute is created as nullable, requiring a validity buffer to be
+// set when writing.
+func createAttr(
+	field_name string,
+	filter_defs []stgpsr.Definition,
+	tiledb_defs map[string]stgpsr.Definition,
+	schema *tiledb.ArraySchema,
+	ctx *tiledb.Context,
+	nullable bool,
+) error {
 
 	var (
 		tdb_dtype tiledb.Datatype
@@ -363,6 +377,13 @@ func CreateAttr(
 		}
 	}
 
+	if nullable {
+		err = attr.SetNullable(true)
+		if err != nil {
+			return errors.Join(ErrNewAttr, err)
+		}
+	}
+
 	// attach filter pipeline to attr
 	err = AttachFilters(attr_filts, attr)
 	if err != nil {
@@ -0,0 +1,200 @@
+package gsf
+
+import (
+	"errors"
+)
+
+// VerticalReference identifies the vertical reference of the beam Z values.
+type VerticalReference string
+
+const (
+	// VREF_RECORDED leaves the depths as recorded in the GSF file; relative to
+	// the waterline, or relative to the vertical datum if the tide corrector
+	// has already been applied (see the TIDE_CORRECTION processing parameter).
+	VREF_RECORDED VerticalReference = "recorded"
+
+	// VREF_WATERLINE reduces the depths to the instantaneous waterline.
+	VREF_WATERLINE VerticalReference = "waterline"
+
+	// VREF_CHART_DATUM reduces the depths to the vertical (chart) datum using
+	// the tide corrector, or the GPS tide corrector if no tide corrector exists.
+	VREF_CHART_DATUM VerticalReference = "chart_datum"
+
+	// VREF_ELLIPSOID reduces the depths to the ellipsoid using the separation
+	// between the chart datum and the ellipsoid, or if unavailable, the
+	// height of the vessel reference point above the ellipsoid.
+	VREF_ELLIPSOID VerticalReference = "ellipsoid"
+
+	// VREF_VESSEL reduces the depths to the vessel reference point by removing
+	// the depth corrector (draft, dynamic draft).
+	VREF_VESSEL VerticalReference = "vessel_reference_point"
+)
+
+// VerticalReferences lists the supported vertical references.
+var VerticalReferences = []VerticalReference{
+	VREF_RECORDED,
+	VREF_WATERLINE,
+	VREF_CHART_DATUM,
+	VREF_ELLIPSOID,
+	VREF_VESSEL,
+}
+
+// VerticalReduction defines the vertical reference that the beam Z values
+// are to be reduced to, and whether the depths recorded in the GSF file
+// already have the tide corrector applied.
+//
+// The sign conventions follow the GSF specification, where depths are
+// positive down, and the tide and depth correctors are the values that are
+// added to the depths. Z is the negated depth (positive up). Therefore:
+//
+//	Z_waterline = Z_recorded + tide (only if the tide has been applied)
+//	Z_chart_datum = Z_waterline - tide
+//	Z_vessel = Z_waterline + depth_corrector
+//	Z_ellipsoid = Z_chart_datum + separation, or Z_vessel + height
+//
+// where the separation is positive when the chart datum is above the
+// ellipsoid, and the height is that of the vessel reference point above the
+// ellipsoid. Heave is assumed to be accounted for within the depth corrector.
+type VerticalReduction struct {
+	Reference    VerticalReference
+	Tide_applied bool
+}
+
+// TideApplied interrogates the processing parameters to determine whether
+// the depths recorded in the GSF file have had the tide corrector applied.
+func TideApplied(proc_info *ProcessingInfo) bool {
+	val, ok := proc_info.Processing_Parameters["tide_correction"]
+	if !ok {
+		return false
+	}
+
+	tc, ok := val.(string)
+
+	return ok && tc == "applied"
+}
+
+// NewVerticalReduction constructs a VerticalReduction for the given vertical
+// reference, determining whether the tide has been applied from the GSF
+// processing parameters.
+func NewVerticalReduction(reference VerticalReference, proc_info *ProcessingInfo) (VerticalReduction, error) {
+	var vr VerticalReduction
+
+	valid := false
+	for _, ref := range VerticalReferences {
+		if ref == reference {
+			valid = true
+		}
+	}
+	if !valid {
+		return vr, errors.Join(ErrVerticalReference, errors.New("Unsupported vertical reference: "+string(reference)))
+	}
+
+	vr.Reference = reference
+	vr.Tide_applied = TideApplied(proc_info)
+
+	return vr, nil
+}
+
+// tide returns the tide corrector for the ping idx, falling back to the GPS
+// tide corrector if the tide corrector is null.
+func (ph *PingHeaders) tide(idx int) (float64, bool) {
+	if ph.Tide_corrector[idx] != NULL_TIDE_CORRECTOR_F32 {
+		return float64(ph.Tide_corrector[idx]), true
+	}
+
+	if ph.GPS_tide_corrector[idx] != NULL_GPS_TIDE_CORRECTOR {
+		return ph.GPS_tide_corrector[idx], true
+	}
+
+	return 0.0, false
+}
+
+// VerticalOffset calculates the offset to add to the recorded Z values of the
+// ping idx in order to reduce them to the vertical reference.
+// The returned bool is false if the required correctors are null.
+func (ph *PingHeaders) VerticalOffset(idx int, vr *VerticalReduction) (float64, bool) {
+	if vr.Reference == VREF_RECORDED {
+		return 0.0, true
+	}
+
+	tide, tide_ok := ph.tide(idx)
+
+	// offset from the recorded Z to the waterline
+	waterline := 0.0
+	if vr.Tide_applied {
+		if !tide_ok {
+			return 0.0, false
+		}
+		waterline = tide
+	}
+
+	depth_corrector := ph.Depth_corrector[idx]
+	dc_ok := depth_corrector != NULL_DEPTH_CORRECTOR_F64
+
+	switch vr.Reference {
+	case VREF_WATERLINE:
+		return waterline, true
+	case VREF_CHART_DATUM:
+		if !tide_ok {
+			return 0.0, false
+		}
+		return waterline - tide, true
+	case VREF_VESSEL:
+		if !dc_ok {
+			return 0.0, false
+		}
+		return waterline + depth_corrector, true
+	case VREF_ELLIPSOID:
+		sep := ph.Separation[idx]
+		if tide_ok && sep != NULL_SEP {
+			return waterline - tide + sep, true
+		}
+
+		height := ph.Height[idx]
+		if dc_ok && height != NULL_HEIGHT {
+			return waterline + depth_corrector + height, true
+		}
+	}
+
+	return 0.0, false
+}
+
+// ReduceVertical reduces the beam Z values to the vertical reference.
+// The beams are assumed to be contiguous for each ping, with Number_beams per
+// ping, i.e. the reduction is applied prior to any padding for dense arrays.
+// Null depths are left as is, and the Z values of pings whose correctors are
+// null are set to NULL_DEPTH_F64.
+func (pd *PingData) ReduceVertical(vr *VerticalReduction) error {
+	if vr.Reference == VREF_RECORDED {
+		return nil
+	}
+
+	z := pd.Beam_array.Z
+	if len(z) == 0 {
+		return nil
+	}
+
+	start := 0
+	for i, nbeams := range pd.Ping_headers.Number_beams {
+		end := start + int(nbeams)
+		if end > len(z) {
+			return errors.Join(ErrVerticalReference, errors.New("Number of beams exceeds the number of Z values"))
+		}
+
+		offset, ok := pd.Ping_headers.VerticalOffset(i, vr)
+		for j := start; j < end; j++ {
+			if z[j] == NULL_DEPTH_F64 {
+				continue
+			}
+			if !ok {
+				z[j] = NULL_DEPTH_F64
+				continue
+			}
+			z[j] += offset
+		}
+
+		start = end
+	}
+
+	return nil
+}
@@ -0,0 +1,882 @@
+package gsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/samber/lo"
+)
+
+const (
+	// ZARR_ZSTD_LEVEL is the compression level used for every Zarr chunk,
+	// and matches the level used for the TileDB attributes.
+	ZARR_ZSTD_LEVEL = 16
+
+	// ZARR_RAGGED_CHUNK is the number of elements per chunk for the
+	// flattened values of variable length fields.
+	ZARR_RAGGED_CHUNK = 1048576
+
+	// ZARR_TIME_UNITS describes the int64 encoding of timestamps, following
+	// the CF conventions so that tools such as xarray can decode them.
+	ZARR_TIME_UNITS = "nanoseconds since 1970-01-01T00:00:00Z"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// zarrNamedConfig is the {name, configuration} object used throughout the
+// Zarr v3 metadata for the chunk grid, chunk key encoding and codecs.
+type zarrNamedConfig struct {
+	Name          string         `json:"name"`
+	Configuration map[string]any `json:"configuration"`
+}
+
+// zarrArrayMetadata is the content of a Zarr v3 array zarr.json document.
+type zarrArrayMetadata struct {
+	Zarr_format        int               `json:"zarr_format"`
+	Node_type          string            `json:"node_type"`
+	Shape              []uint64          `json:"shape"`
+	Data_type          string            `json:"data_type"`
+	Chunk_grid         zarrNamedConfig   `json:"chunk_grid"`
+	Chunk_key_encoding zarrNamedConfig   `json:"chunk_key_encoding"`
+	Fill_value         any               `json:"fill_value"`
+	Codecs             []zarrNamedConfig `json:"codecs"`
+	Attributes         map[string]any    `json:"attributes"`
+	Dimension_names    []string          `json:"dimension_names"`
+}
+
+// zarrGroupMetadata is the content of a Zarr v3 group zarr.json document.
+type zarrGroupMetadata struct {
+	Zarr_format int            `json:"zarr_format"`
+	Node_type   string         `json:"node_type"`
+	Attributes  map[string]any `json:"attributes"`
+}
+
+// writeZarrJson serialises the metadata document to a zarr.json file
+// within the directory given by path.
+func writeZarrJson(path string, md any) error {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return errors.Join(ErrWriteZarr, err)
+	}
+
+	jsn, err := json.MarshalIndent(md, "", "    ")
+	if err != nil {
+		return errors.Join(ErrWriteZarr, err)
+	}
+
+	err = os.WriteFile(filepath.Join(path, "zarr.json"), jsn, 0644)
+	if err != nil {
+		return errors.Join(ErrWriteZarr, err)
+	}
+
+	return nil
+}
+
+// WriteZarrGroup creates a Zarr v3 group at path, with the supplied
+// attributes. Calling it on an existing group overwrites the attributes.
+func WriteZarrGroup(path string, attrs map[string]any) error {
+	if attrs == nil {
+		attrs = make(map[string]any)
+	}
+
+	md := zarrGroupMetadata{Zarr_format: 3, Node_type: "group", Attributes: attrs}
+
+	return writeZarrJson(path, md)
+}
+
+// newZstdEncoder creates the zstd encoder used for compressing Zarr chunks.
+func newZstdEncoder() (*zstd.Encoder, error) {
+	return zstd.NewWriter(
+		nil,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(ZARR_ZSTD_LEVEL)),
+		zstd.WithEncoderCRC(false),
+	)
+}
+
+// zarrArray is an appendable Zarr v3 array, where rows are appended along the
+// first axis and the trailing axes (if any) are fixed. Whole chunks are
+// compressed and written as soon as enough rows have been appended; the
+// final partial chunk and the zarr.json document are written by close.
+type zarrArray struct {
+	path       string
+	dtype      string
+	itemsize   uint64
+	row_shape  []uint64
+	row_width  uint64
+	chunk_rows uint64
+	dim_names  []string
+	attrs      map[string]any
+	nrows      uint64
+	nchunks    uint64
+	buffer     []byte
+	encoder    *zstd.Encoder
+}
+
+// newZarrArray initialises a zarrArray. The dtype is the name of a Go numeric
+// kind (eg uint16, float64) which coincide with the Zarr v3 data type names.
+func newZarrArray(path string, dtype reflect.Kind, row_shape []uint64, chunk_rows uint64, dim_names []string, attrs map[string]any, encoder *zstd.Encoder) (*zarrArray, error) {
+	var itemsize uint64
+
+	switch dtype {
+	case reflect.Int8, reflect.Uint8:
+		itemsize = 1
+	case reflect.Int16, reflect.Uint16:
+		itemsize = 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		itemsize = 4
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		itemsize = 8
+	default:
+		return nil, errors.Join(ErrDtype, errors.New(dtype.String()))
+	}
+
+	row_width := uint64(1)
+	for _, v := range row_shape {
+		row_width *= v
+	}
+
+	if attrs == nil {
+		attrs = make(map[string]any)
+	}
+
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, errors.Join(ErrWriteZarr, err)
+	}
+
+	za := zarrArray{
+		path:       path,
+		dtype:      dtype.String(),
+		itemsize:   itemsize,
+		row_shape:  row_shape,
+		row_width:  row_width,
+		chunk_rows: chunk_rows,
+		dim_names:  dim_names,
+		attrs:      attrs,
+		encoder:    encoder,
+	}
+
+	return &za, nil
+}
+
+// chunkKey constructs the chunk key for the nth chunk along the first axis
+// using the default chunk key encoding; eg c/3/0 for a 2D array.
+func (za *zarrArray) chunkKey(n uint64) string {
+	key := filepath.Join("c", strconv.FormatUint(n, 10))
+	for range za.row_shape {
+		key = filepath.Join(key, "0")
+	}
+
+	return key
+}
+
+// writeChunk compresses and writes a single whole chunk.
+func (za *zarrArray) writeChunk(data []byte) error {
+	chunk_uri := filepath.Join(za.path, za.chunkKey(za.nchunks))
+
+	err := os.MkdirAll(filepath.Dir(chunk_uri), 0755)
+	if err != nil {
+		return errors.Join(ErrWriteZarr, err)
+	}
+
+	err = os.WriteFile(chunk_uri, za.encoder.EncodeAll(data, nil), 0644)
+	if err != nil {
+		return errors.Join(ErrWriteZarr, err)
+	}
+
+	za.nchunks++
+
+	return nil
+}
+
+// append appends a slice of data to the array. The slice length must be a
+// multiple of the row width (the product of the trailing axes).
+func (za *zarrArray) append(data any) error {
+	n := uint64(reflect.ValueOf(data).Len())
+	if n%za.row_width != 0 {
+		return errors.Join(ErrWriteZarr, errors.New("Data length isn't a multiple of the row width: "+za.path))
+	}
+
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.LittleEndian, data)
+	if err != nil {
+		return errors.Join(ErrWriteZarr, err)
+	}
+
+	za.buffer = append(za.buffer, buf.Bytes()...)
+	za.nrows += n / za.row_width
+
+	chunk_bytes := int(za.chunk_rows * za.row_width * za.itemsize)
+	for len(za.buffer) >= chunk_bytes {
+		err = za.writeChunk(za.buffer[:chunk_bytes])
+		if err != nil {
+			return err
+		}
+		za.buffer = append(za.buffer[:0], za.buffer[chunk_bytes:]...)
+	}
+
+	return nil
+}
+
+// close writes the final partial chunk (padded with the fill value), and the
+// zarr.json array metadata document.
+func (za *zarrArray) close() error {
+	if len(za.buffer) > 0 {
+		chunk_bytes := int(za.chunk_rows * za.row_width * za.itemsize)
+		padded := make([]byte, chunk_bytes)
+		copy(padded, za.buffer)
+
+		err := za.writeChunk(padded)
+		if err != nil {
+			return err
+		}
+		za.buffer = nil
+	}
+
+	shape := append([]uint64{za.nrows}, za.row_shape...)
+	chunk_shape := append([]uint64{za.chunk_rows}, za.row_shape...)
+
+	md := zarrArrayMetadata{
+		Zarr_format: 3,
+		Node_type:   "array",
+		Shape:       shape,
+		Data_type:   za.dtype,
+		Chunk_grid: zarrNamedConfig{
+			Name:          "regular",
+			Configuration: map[string]any{"chunk_shape": chunk_shape},
+		},
+		Chunk_key_encoding: zarrNamedConfig{
+			Name:          "default",
+			Configuration: map[string]any{"separator": "/"},
+		},
+		Fill_value: 0,
+		Codecs: []zarrNamedConfig{
+			{Name: "bytes", Configuration: map[string]any{"endian": "little"}},
+			{Name: "zstd", Configuration: map[string]any{"level": ZARR_ZSTD_LEVEL, "checksum": false}},
+		},
+		Attributes:      za.attrs,
+		Dimension_names: za.dim_names,
+	}
+
+	return writeZarrJson(za.path, md)
+}
+
+// zarrTable is a Zarr v3 group containing a Zarr array for every field of a
+// struct of slices, akin to the attributes of a TileDB array. All arrays
+// share the same leading axis (eg PING_ID), and optionally trailing axes (eg
+// BeamNumber).
+// Variable length fields ([][]T or []string) are stored following the CF
+// contiguous ragged array representation; the flattened values and a
+// <name>_count array holding the number of values for each row.
+// Arrays are created upon the first append.
+type zarrTable struct {
+	path       string
+	dim_names  []string
+	row_shape  []uint64
+	chunk_rows uint64
+	arrays     map[string]*zarrArray
+	encoder    *zstd.Encoder
+}
+
+// newZarrTable initialises the zarrTable and creates the Zarr group at path.
+func newZarrTable(path string, dim_names []string, row_shape []uint64, attrs map[string]any, encoder *zstd.Encoder) (*zarrTable, error) {
+	err := WriteZarrGroup(path, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	zt := zarrTable{
+		path:       path,
+		dim_names:  dim_names,
+		row_shape:  row_shape,
+		chunk_rows: uint64(PING_CHUNK_SIZE),
+		arrays:     make(map[string]*zarrArray),
+		encoder:    encoder,
+	}
+
+	return &zt, nil
+}
+
+// array retrieves the named array, creating it if it doesn't exist.
+func (zt *zarrTable) array(name string, dtype reflect.Kind, ragged bool, attrs map[string]any) (*zarrArray, error) {
+	var err error
+
+	za, ok := zt.arrays[name]
+	if ok {
+		return za, nil
+	}
+
+	path := filepath.Join(zt.path, name)
+	if ragged {
+		za, err = newZarrArray(path, dtype, nil, ZARR_RAGGED_CHUNK, []string{name + "_sample"}, attrs, zt.encoder)
+	} else {
+		za, err = newZarrArray(path, dtype, zt.row_shape, zt.chunk_rows, zt.dim_names, attrs, zt.encoder)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zt.arrays[name] = za
+
+	return za, nil
+}
+
+// zarrValues converts a reflected slice into a slice that can be binary
+// encoded, along with the array attributes required to interpret it.
+// Timestamps are converted to int64 nanoseconds since the UNIX epoch.
+func zarrValues(slc reflect.Value) (any, reflect.Kind, map[string]any) {
+	if slc.Type().Elem() == timeType {
+		n := slc.Len()
+		timestamps := make([]int64, n)
+		for i := 0; i < n; i++ {
+			timestamps[i] = slc.Index(i).Interface().(time.Time).UnixNano()
+		}
+		return timestamps, reflect.Int64, map[string]any{"units": ZARR_TIME_UNITS}
+	}
+
+	return slc.Interface(), slc.Type().Elem().Kind(), nil
+}
+
+// appendField appends a slice of values for the named field.
+func (zt *zarrTable) appendField(name string, slc reflect.Value) error {
+	data, dtype, attrs := zarrValues(slc)
+
+	za, err := zt.array(name, dtype, false, attrs)
+	if err != nil {
+		return err
+	}
+
+	return za.append(data)
+}
+
+// appendRagged appends the flattened values and the per row counts for a
+// variable length field.
+func (zt *zarrTable) appendRagged(name string, flat reflect.Value, counts []uint64, attrs map[string]any) error {
+	data, dtype, val_attrs := zarrValues(flat)
+	if attrs == nil {
+		attrs = make(map[string]any)
+	}
+	for k, v := range val_attrs {
+		attrs[k] = v
+	}
+	attrs["count_variable"] = name + "_count"
+
+	za, err := zt.array(name, dtype, true, attrs)
+	if err != nil {
+		return err
+	}
+
+	err = za.append(data)
+	if err != nil {
+		return err
+	}
+
+	cnt_attrs := map[string]any{"sample_dimension": name + "_sample"}
+	za, err = zt.array(name+"_count", reflect.Uint64, false, cnt_attrs)
+	if err != nil {
+		return err
+	}
+
+	return za.append(counts)
+}
+
+// appendStruct appends every exported slice field of the struct (pointer)
+// t. If names is non-nil, only the named fields are appended.
+func (zt *zarrTable) appendStruct(t any, names []string) error {
+	values := reflect.ValueOf(t).Elem()
+	types := values.Type()
+
+	for i := 0; i < values.NumField(); i++ {
+		fld := values.Field(i)
+		name := types.Field(i).Name
+
+		if !types.Field(i).IsExported() || fld.Kind() != reflect.Slice {
+			continue
+		}
+
+		if names != nil && !lo.Contains(names, name) {
+			continue
+		}
+
+		dims := 0
+		stype := sliceDimsType(fld.Type(), &dims)
+
+		switch dims {
+		case 1:
+			if stype.Kind() == reflect.String {
+				// strings are stored as variable length utf-8 bytes
+				n := fld.Len()
+				counts := make([]uint64, n)
+				flat := make([]uint8, 0)
+				for r := 0; r < n; r++ {
+					str := fld.Index(r).String()
+					counts[r] = uint64(len(str))
+					flat = append(flat, []byte(str)...)
+				}
+				attrs := map[string]any{"encoding": "utf-8"}
+				err := zt.appendRagged(name, reflect.ValueOf(flat), counts, attrs)
+				if err != nil {
+					return errors.Join(err, errors.New(name))
+				}
+				continue
+			}
+
+			err := zt.appendField(name, fld)
+			if err != nil {
+				return errors.Join(err, errors.New(name))
+			}
+		case 2:
+			n := fld.Len()
+			counts := make([]uint64, n)
+			flat := reflect.MakeSlice(reflect.SliceOf(stype), 0, 0)
+			for r := 0; r < n; r++ {
+				row := fld.Index(r)
+				counts[r] = uint64(row.Len())
+				flat = reflect.AppendSlice(flat, row)
+			}
+			err := zt.appendRagged(name, flat, counts, nil)
+			if err != nil {
+				return errors.Join(err, errors.New(name))
+			}
+		default:
+			return errors.Join(ErrDims, errors.New(strconv.Itoa(dims)))
+		}
+	}
+
+	return nil
+}
+
+// close finalises every array within the group.
+func (zt *zarrTable) close() error {
+	for _, za := range zt.arrays {
+		err := za.close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// populatedField returns a pointer to the first struct field (of the struct
+// pointed to by t) containing data. SensorMetadata and SensorImageryMetadata
+// contain a field for every sensor, of which only the field for the sensor
+// that acquired the data is populated.
+func populatedField(t any) (string, any, bool) {
+	values := reflect.ValueOf(t).Elem()
+	types := values.Type()
+
+	for i := 0; i < values.NumField(); i++ {
+		fld := values.Field(i)
+		if fld.Kind() != reflect.Struct {
+			continue
+		}
+
+		for j := 0; j < fld.NumField(); j++ {
+			sub := fld.Field(j)
+			if sub.Kind() == reflect.Slice && sub.Len() > 0 {
+				return types.Field(i).Name, fld.Addr().Interface(), true
+			}
+		}
+	}
+
+	return "", nil, false
+}
+
+// ToZarr writes the Attitude data to a Zarr v3 group, using the same
+// structure as the TileDB array; a single row axis with a Zarr array for
+// each of the Timestamp, Pitch, Roll, Heave and Heading fields.
+func (a *Attitude) ToZarr(path string) error {
+	encoder, err := newZstdEncoder()
+	if err != nil {
+		return errors.Join(ErrWriteAttitudeZarr, err)
+	}
+	defer encoder.Close()
+
+	zt, err := newZarrTable(path, []string{"row"}, nil, nil, encoder)
+	if err != nil {
+		return errors.Join(ErrWriteAttitudeZarr, err)
+	}
+	zt.chunk_rows = 50000
+
+	err = zt.appendStruct(a, nil)
+	if err != nil {
+		return errors.Join(ErrWriteAttitudeZarr, err)
+	}
+
+	err = zt.close()
+	if err != nil {
+		return errors.Join(ErrWriteAttitudeZarr, err)
+	}
+
+	return nil
+}
+
+// ToZarr writes the SoundVelocityProfile data to a Zarr v3 group, using the
+// same structure as the TileDB array. The variable length Depth and
+// Sound_velocity profiles are stored as ragged arrays.
+func (s *SoundVelocityProfile) ToZarr(path string) error {
+	encoder, err := newZstdEncoder()
+	if err != nil {
+		return errors.Join(ErrWriteSvpZarr, err)
+	}
+	defer encoder.Close()
+
+	zt, err := newZarrTable(path, []string{"row"}, nil, nil, encoder)
+	if err != nil {
+		return errors.Join(ErrWriteSvpZarr, err)
+	}
+
+	err = zt.appendStruct(s, nil)
+	if err != nil {
+		return errors.Join(ErrWriteSvpZarr, err)
+	}
+
+	err = zt.close()
+	if err != nil {
+		return errors.Join(ErrWriteSvpZarr, err)
+	}
+
+	return nil
+}
+
+// zarrPingWriter holds the Zarr groups for the ping based data;
+// PingHeader, SensorMetadata, SensorImageryMetadata and BeamData.
+type zarrPingWriter struct {
+	ping_headers          *zarrTable
+	sensor_metadata       *zarrTable
+	sensor_imagery        *zarrTable
+	beam_data             *zarrTable
+	beam_names            []string
+	contains_intensity    bool
+	projected             bool
+	interpolated_attitude bool
+	svp_index             bool
+	decoded_flags         bool
+	s44                   bool
+}
+
+// write appends a chunk of pings to the Zarr groups.
+func (zw *zarrPingWriter) write(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error {
+	err := zw.ping_headers.appendStruct(&ping_data_chunk.Ping_headers, nil)
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing PingHeaders"))
+	}
+
+	err = zw.ping_headers.appendStruct(&ping_data_chunk.Ping_statistics, nil)
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing PingStatistics"))
+	}
+
+	err = zw.ping_headers.appendStruct(&ping_data_chunk.Ping_head, nil)
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing PingHead"))
+	}
+
+	if zw.interpolated_attitude {
+		err = zw.ping_headers.appendStruct(&ping_data_chunk.Ping_attitude, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingAttitude"))
+		}
+	}
+
+	if zw.svp_index {
+		err = zw.ping_headers.appendStruct(&ping_data_chunk.Ping_svp, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingSvp"))
+		}
+	}
+
+	if zw.s44 {
+		err = zw.ping_headers.appendStruct(&ping_data_chunk.Ping_s44, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingS44"))
+		}
+	}
+
+	if len(ping_data_chunk.Ping_rejected.Rejected_beams) > 0 {
+		err = zw.ping_headers.appendStruct(&ping_data_chunk.Ping_rejected, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing PingRejected"))
+		}
+	}
+
+	name, sen_md, ok := populatedField(&ping_data_chunk.Sensor_metadata)
+	if ok {
+		err = zw.sensor_metadata.appendStruct(sen_md, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing SensorMetadata."+name))
+		}
+	}
+
+	// beam data; BeamArray, LonLat, BrbIntensity
+	err = zw.beam_data.appendStruct(&ping_data_chunk.Beam_array, zw.beam_names)
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing beam data"))
+	}
+
+	err = zw.beam_data.appendField("X", reflect.ValueOf(ping_data_chunk.Lon_lat.Longitude))
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing beam data: X"))
+	}
+
+	err = zw.beam_data.appendField("Y", reflect.ValueOf(ping_data_chunk.Lon_lat.Latitude))
+	if err != nil {
+		return errors.Join(err, errors.New("Error writing beam data: Y"))
+	}
+
+	if zw.projected {
+		err = zw.beam_data.appendStruct(&ping_data_chunk.Easting_northing, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing beam data: Easting & Northing"))
+		}
+	}
+
+	if zw.decoded_flags {
+		err = zw.beam_data.appendStruct(&ping_data_chunk.Beam_flags, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing beam data: decoded BeamFlags"))
+		}
+	}
+
+	if zw.s44 {
+		err = zw.beam_data.appendStruct(&ping_data_chunk.Beam_s44, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing beam data: S-44 compliance"))
+		}
+	}
+
+	if zw.contains_intensity {
+		name, sen_img_md, ok := populatedField(&ping_data_chunk.Sensor_imagery_metadata)
+		if ok {
+			err = zw.sensor_imagery.appendStruct(sen_img_md, nil)
+			if err != nil {
+				return errors.Join(err, errors.New("Error writing SensorImageryMetadata."+name))
+			}
+		}
+
+		brb := &ping_data_chunk.Brb_intensity
+		err = zw.beam_data.appendStruct(brb, []string{"BottomDetectIndex", "StartRange", "TsMean"})
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing beam data intensity"))
+		}
+
+		// beams without samples have had a single NaN inserted
+		counts := make([]uint64, len(brb.sample_count))
+		for i, v := range brb.sample_count {
+			counts[i] = uint64(v)
+			if v == uint16(0) {
+				counts[i] = uint64(1)
+			}
+		}
+
+		err = zw.beam_data.appendRagged("TimeSeries", reflect.ValueOf(brb.TimeSeries), counts, nil)
+		if err != nil {
+			return errors.Join(err, errors.New("Error writing beam data: TimeSeries"))
+		}
+	}
+
+	return nil
+}
+
+// close finalises each of the Zarr groups.
+func (zw *zarrPingWriter) close() error {
+	tables := []*zarrTable{zw.ping_headers, zw.sensor_metadata, zw.beam_data}
+	if zw.contains_intensity {
+		tables = append(tables, zw.sensor_imagery)
+	}
+
+	for _, zt := range tables {
+		err := zt.close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ZarrSink writes the GSF data as a Zarr v3 hierarchy on the local
+// filesystem.
+type ZarrSink struct {
+	path    string
+	encoder *zstd.Encoder
+	pings   *zarrPingWriter
+}
+
+// NewZarrSink creates a Zarr v3 group at path.
+func NewZarrSink(path string) (*ZarrSink, error) {
+	err := WriteZarrGroup(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZarrSink{path: path}, nil
+}
+
+// WriteMetadata writes the GSF data processing information to the root
+// group attributes.
+func (zs *ZarrSink) WriteMetadata(fi *FileInfo, proc_info *ProcessingInfo) error {
+	attrs := map[string]any{"Data-Processing-Information": proc_info}
+	return WriteZarrGroup(zs.path, attrs)
+}
+
+// WriteAttitude writes the attitude data to the Attitude group.
+func (zs *ZarrSink) WriteAttitude(att *Attitude) error {
+	return att.ToZarr(filepath.Join(zs.path, "Attitude"))
+}
+
+// WriteSvp writes the sound velocity profile data to the SVP group.
+func (zs *ZarrSink) WriteSvp(svp *SoundVelocityProfile) error {
+	return svp.ToZarr(filepath.Join(zs.path, "SVP"))
+}
+
+// OpenPings creates the PingHeader, SensorMetadata, SensorImageryMetadata
+// (if intensity exists) and BeamData groups.
+// The REJECT_NULL policy isn't supported, as the Zarr arrays aren't nullable,
+// nor is REJECT_DROP, as the beams of each ping are padded to the same length.
+func (zs *ZarrSink) OpenPings(fi *FileInfo, sref *SpatialReference, outputs *OutputOptions) error {
+	var err error
+
+	switch outputs.Reject_policy {
+	case REJECT_NULL:
+		return errors.Join(ErrRejectPolicy, errors.New("Nulling rejected beams is not supported for Zarr"))
+	case REJECT_DROP:
+		return errors.Join(ErrRejectPolicy, errors.New("Dropping rejected beams is not supported for Zarr"))
+	}
+
+	if zs.encoder == nil {
+		zs.encoder, err = newZstdEncoder()
+		if err != nil {
+			return errors.Join(ErrWriteBdZarr, err)
+		}
+	}
+
+	max_beams := uint64(fi.Metadata.Quality_Info.Min_Max_Beams[1])
+	pid_dims := []string{"PING_ID"}
+	beam_dims := []string{"PingNumber", "BeamNumber"}
+
+	zw := zarrPingWriter{
+		contains_intensity:    lo.Contains(fi.SubRecord_Schema, SubRecordNames[INTENSITY_SERIES]),
+		beam_names:            lo.Without(fi.beamSchemaNames(), "IntensitySeries"),
+		projected:             sref.Projection != nil,
+		interpolated_attitude: outputs.Interpolated_attitude,
+		svp_index:             outputs.Svp_selection != "",
+		decoded_flags:         outputs.Decoded_flags && lo.Contains(fi.SubRecord_Schema, SubRecordNames[BEAM_FLAGS]),
+		s44:                   outputs.S44_order != "",
+	}
+
+	// record the vertical reference of Z, and the projection so that the
+	// Easting & Northing can be interpreted
+	bd_attrs := map[string]any{"Vertical_Reference": sref.Vertical}
+	if sref.Projection != nil {
+		bd_attrs["Projection"] = sref.Projection
+	}
+
+	// record the enumerations so that FlagCategory & FlagReason can be interpreted
+	if zw.decoded_flags {
+		bd_attrs["Beam_Flag_Categories"] = BeamFlagCategories
+		bd_attrs["Beam_Flag_Reasons"] = BeamFlagReasons
+	}
+
+	// record the order and enumeration so that S44Compliance can be interpreted
+	if zw.s44 {
+		bd_attrs["S44_Order"] = outputs.S44_order
+		bd_attrs["S44_Results"] = S44Results
+	}
+
+	// record the policy used to associate each ping with an SVP
+	var ph_attrs map[string]any
+	if zw.svp_index {
+		ph_attrs = map[string]any{"Svp_Selection": outputs.Svp_selection}
+	}
+
+	zw.ping_headers, err = newZarrTable(filepath.Join(zs.path, "PingHeader"), pid_dims, nil, ph_attrs, zs.encoder)
+	if err != nil {
+		return errors.Join(ErrWriteBdZarr, err)
+	}
+
+	zw.sensor_metadata, err = newZarrTable(filepath.Join(zs.path, "SensorMetadata"), pid_dims, nil, nil, zs.encoder)
+	if err != nil {
+		return errors.Join(ErrWriteBdZarr, err)
+	}
+
+	if zw.contains_intensity {
+		zw.sensor_imagery, err = newZarrTable(filepath.Join(zs.path, "SensorImageryMetadata"), pid_dims, nil, nil, zs.encoder)
+		if err != nil {
+			return errors.Join(ErrWriteBdZarr, err)
+		}
+	}
+
+	zw.beam_data, err = newZarrTable(filepath.Join(zs.path, "BeamData"), beam_dims, []uint64{max_beams}, bd_attrs, zs.encoder)
+	if err != nil {
+		return errors.Join(ErrWriteBdZarr, err)
+	}
+
+	zs.pings = &zw
+
+	return nil
+}
+
+// Dense returns true, as Zarr only supports dense arrays.
+func (zs *ZarrSink) Dense() bool {
+	return true
+}
+
+// WritePings appends a chunk of pings to the Zarr groups.
+func (zs *ZarrSink) WritePings(ping_data_chunk *PingData, ping_beam_ids *PingBeamNumbers) error {
+	err := zs.pings.write(ping_data_chunk, ping_beam_ids)
+	if err != nil {
+		return errors.Join(ErrWriteBdZarr, err)
+	}
+
+	return nil
+}
+
+// Close finalises the ping data groups and releases the compression encoder.
+func (zs *ZarrSink) Close() error {
+	var err error
+
+	if zs.pings != nil {
+		err = zs.pings.close()
+		if err != nil {
+			err = errors.Join(ErrWriteBdZarr, err)
+		}
+		zs.pings = nil
+	}
+
+	if zs.encoder != nil {
+		zs.encoder.Close()
+		zs.encoder = nil
+	}
+
+	return err
+}
+
+// SbpToZarr converts SwathBathymetryPing Records to Zarr v3 groups within the
+// Zarr group given by path. The layout mirrors the TileDB output, with
+// PingHeader, SensorMetadata and SensorImageryMetadata groups indexed by
+// PING_ID, and the BeamData group indexed by [PingNumber, BeamNumber].
+// As Zarr only supports dense arrays, the beam data is always padded to the
+// maximum number of beams. The BrbIntensity.TimeSeries is stored as a ragged
+// array with a TimeSeries_count array of dimensions [PingNumber, BeamNumber].
+// This is a convenience wrapper around SbpToSink using a ZarrSink.
+func (g *GsfFile) SbpToZarr(fi *FileInfo, path string) error {
+	sink := ZarrSink{path: path}
+	defer sink.Close()
+
+	err := g.SbpToSink(fi, &sink)
+	if err != nil {
+		return err
+	}
+
+	return sink.Close()
+}